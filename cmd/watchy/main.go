@@ -1,18 +1,35 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/ollama/ollama/api"
 	"github.com/parth/watchy/internal/agent"
 	"github.com/parth/watchy/internal/config"
+	"github.com/parth/watchy/internal/daemon"
 	"github.com/parth/watchy/internal/ollama"
+	"github.com/parth/watchy/internal/scheduler"
+	"github.com/parth/watchy/internal/sparkline"
+	"github.com/parth/watchy/internal/stack"
 	"github.com/parth/watchy/internal/task"
 	"github.com/parth/watchy/internal/tick"
 	"github.com/parth/watchy/internal/tui"
+	"golang.org/x/sys/unix"
 )
 
 // version is set via ldflags at build time: -ldflags "-X main.version=v0.2.0"
@@ -24,6 +41,31 @@ const (
 )
 
 func main() {
+	// Log writer helper spawned by watchyd for tasks with log rotation
+	if len(os.Args) > 1 && os.Args[1] == task.LogWriterCommand {
+		if err := task.RunLogWriter(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// Wrapper that applies a task's resource limits before exec'ing it;
+	// only returns if that fails
+	if len(os.Args) > 1 && os.Args[1] == task.LimitsCommand {
+		err := task.RunLimited(os.Args[2:])
+		fmt.Fprintf(os.Stderr, "watchy: %s\n", err)
+		os.Exit(126)
+	}
+	// Wrapper that runs the agent's shell commands in a sandbox
+	if len(os.Args) > 1 && os.Args[1] == agent.SandboxCommand {
+		code, err := agent.RunSandboxed(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "watchy: sandbox: %s\n", err)
+			os.Exit(126)
+		}
+		os.Exit(code)
+	}
+
 	// Check --version early before any setup
 	for _, arg := range os.Args[1:] {
 		if arg == "--version" || arg == "-v" {
@@ -38,18 +80,6 @@ func main() {
 		os.Exit(1)
 	}
 
-	storage, err := task.NewStorage(cfg.DBPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-		os.Exit(1)
-	}
-	defer storage.Close()
-
-	mgr := task.NewManager(storage, cfg.LogsDir)
-
-	// Sync task statuses on startup
-	mgr.SyncTaskStatus()
-
 	// Parse global flags
 	args := os.Args[1:]
 	onlineMode := false
@@ -65,6 +95,27 @@ func main() {
 		}
 	}
 
+	// db inspects the schema itself, so it must run before NewStorage migrates
+	if len(args) > 0 && args[0] == "db" {
+		cmdDB(cfg, args[1:])
+		return
+	}
+
+	// The daemon owns the task processes; everything else is a client of it
+	if len(args) > 0 && args[0] == "daemon" {
+		cmdDaemon(cfg, args[1:])
+		return
+	}
+
+	client, err := daemon.Connect(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var mgr task.Controller = client
+
 	// Determine Ollama host
 	var srv *ollama.Server
 	ollamaHost := ""
@@ -92,6 +143,17 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Error loading ticks: %s\n", err)
 		os.Exit(1)
 	}
+	if cwd, err := os.Getwd(); err == nil {
+		if err := tickStore.LoadProject(cwd); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: project ticks: %s\n", err)
+		}
+	}
+
+	stackStore, err := stack.NewStore(cfg.StacksPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading stacks: %s\n", err)
+		os.Exit(1)
+	}
 
 	cmd := ""
 	if len(args) >= 1 {
@@ -109,19 +171,32 @@ func main() {
 		cmdStop(mgr, subArgs)
 	case "list":
 		cmdList(mgr)
+	case "top":
+		cmdTop(mgr, subArgs)
 	case "logs":
 		cmdLogs(mgr, subArgs)
 	case "ask":
 		cmdAsk(mgr, cfg, ollamaHost, subArgs)
+	case "chat":
+		cmdChat(mgr, cfg, ollamaHost, tickStore, subArgs)
 	case "cleanup":
 		cmdCleanup(mgr, cfg)
 	case "tick":
-		cmdTick(tickStore, subArgs)
+		syncTicks(tickStore)
+		cmdTick(mgr, cfg, tickStore, stackStore, subArgs)
+	case "stack":
+		cmdStack(stackStore, tickStore, subArgs)
+	case "up":
+		syncTicks(tickStore)
+		cmdUp(mgr, stackStore, tickStore, subArgs)
+	case "down":
+		cmdDown(mgr, stackStore, subArgs)
 	case "":
-		cmdTUI(mgr, cfg, ollamaHost, tickStore)
+		cmdTUI(mgr, cfg, ollamaHost, tickStore, false, 0)
 	default:
+		syncTicks(tickStore)
 		if tickStore.Has(cmd) {
-			cmdRunTick(mgr, tickStore, cmd)
+			cmdRunTick(mgr, tickStore, cmd, subArgs)
 		} else {
 			fmt.Fprintf(os.Stderr, "Unknown command: %s\n", cmd)
 			printUsage()
@@ -130,6 +205,18 @@ func main() {
 	}
 }
 
+// syncTicks re-imports the changed files of ticks imported with --sync. Only
+// commands that run or manage ticks sync, so the rest never rewrite ticks.json.
+func syncTicks(store *tick.Store) {
+	changes, err := store.Sync()
+	for _, c := range changes {
+		fmt.Fprintln(os.Stderr, c)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: syncing imported ticks: %s\n", err)
+	}
+}
+
 func printUsage() {
 	fmt.Println(`Usage: watchy [--online] [--model <model>] [command] [args]
 
@@ -141,19 +228,73 @@ Global flags:
   --version, -v         Print version and exit
 
 Commands:
-  start <command> [--name <name>]   Start a background task
+  start [options] <command>         Start a background task
+        [--name <name>]
+        [--restart never|on-failure|always] [--max-restarts <n>]
+        [--stop-signal <signal>] [--stop-timeout <duration>]
+        [--log-max-size <size>] [--log-max-files <n>]
+        [--cwd <dir>] [--env KEY=VALUE]... [--env-file <file>]...
+        [--clear-env] [--shell <shell>]
+        [--ready <probe>] [--ready-interval <duration>]
+        [--ready-timeout <duration>] [--ready-failures <n>]
+        [--ready-grace <duration>] [--wait-ready]
+        [--memory <size>] [--cpus <n>] [--pids <n>] [--nofile <n>]
+        [--timeout <duration>]           (run time including restarts)
+        Options go before the command; the rest is passed to it (-- ends them)
   stop <task-id>                    Stop a running task
+        [--signal INT|TERM|QUIT] [--timeout <duration>]
   list                              List all tasks
+  top [--once] [-d <duration>]      Live CPU, memory, threads and open files of running tasks
   logs <task-id> [-n <lines>]       View task logs
-  ask <task-id> "<question>"        Ask the AI agent about a task
+        [--stdout|--stderr] [--since <10m|time>] [-t]
+  logs -f <task-id>... [--exit-code] Follow task logs until the tasks exit
+  ask [--yes] <task-id> "<question>" Ask the AI agent about a task
+  chat [--resume <id>]              Open the TUI in agent chat, optionally resuming a saved chat
+  chat list                         List saved chats
+  chat export <id> [--format md|json] Print a saved chat as Markdown or JSON
   cleanup                           Clean up old completed tasks
-  tick save <name> <command>        Save a command as a named tick
-  tick list                         List all saved ticks
+  daemon [status|stop]              Run, inspect, or stop the watchyd supervisor
+  db status                         Show the database schema version
+  db migrate [--dry-run]            Apply (or list) pending schema migrations
+  tick save <name> [options] <command>
+                                    Save a command as a named tick
+        [--restart <policy>] [--max-restarts <n>]
+        [--stop-signal <signal>] [--stop-timeout <duration>]
+        [--log-max-size <size>] [--log-max-files <n>]
+        [--cwd <dir>] [--env KEY=VALUE]... [--env-file <file>]...
+        [--clear-env] [--shell <shell>]
+        [--ready <probe>] [--ready-interval <duration>]
+        [--ready-timeout <duration>] [--ready-failures <n>]
+        [--ready-grace <duration>]
+        [--memory <size>] [--cpus <n>] [--pids <n>] [--nofile <n>]
+        [--timeout <duration>]
+        [--schedule <schedule>] [--overlap skip|queue|replace]
+        [--param <name>[=<default>]]... [--description <text>]
+        Options go before the command, as for start
+  tick list                         List all saved ticks and scheduled runs
+  tick show <name>                  Print a tick's settings as YAML
+  tick edit <name>                  Edit a tick in $EDITOR
+  tick history <name>               Past runs of a tick, with success rate and durations
+        [--since <10m|time>] [-n <runs>]
+  tick mv <name> <new-name>         Rename a tick, and its steps in stacks
   tick rm <name>                    Remove a saved tick
-  <tick-name>                       Run a saved tick as a task`)
+  tick schedule <name> <schedule>   Run a tick on a cron or "@every 10m" schedule
+        [--overlap skip|queue|replace]
+  tick unschedule <name>            Stop running a tick on its schedule
+  tick import [path]                Create ticks from a Procfile, package.json, Makefile or justfile
+        [--from procfile|npm|make|justfile] [--prefix <prefix>]
+        [--sync] [--yes]
+  <tick-name> [<name>=<value>|<value>]...
+                                    Run a saved tick as a task, filling in its parameters
+  stack add <stack> <tick>          Add a tick to a stack
+        [--after <tick>[,<tick>...]] [--oneshot]
+  stack rm <stack> [<tick>]         Remove a tick from a stack, or the whole stack
+  stack list                        List all stacks
+  up <stack>                        Start a stack's ticks in dependency order
+  down <stack>                      Stop a stack's tasks in reverse order`)
 }
 
-func cmdStart(mgr *task.Manager, args []string) {
+func cmdStart(mgr task.Controller, args []string) {
 	if len(args) == 0 {
 		fmt.Fprintln(os.Stderr, "Error: command is required")
 		os.Exit(1)
@@ -161,12 +302,130 @@ func cmdStart(mgr *task.Manager, args []string) {
 
 	name := ""
 	command := ""
+	var opts task.StartOptions
+	readySpec := ""
+	var probe task.Probe // --ready-* settings, applied once --ready is parsed
+	waitReady := false
 
-	// Parse --name flag
+	// Options come before the command; what follows its first word is the
+	// command's own (watchy start pytest --timeout 30), apart from --name,
+	// which has always been accepted after it. -- ends the options.
 	for i := 0; i < len(args); i++ {
+		if args[i] == "--" && command == "" {
+			command = strings.Join(args[i+1:], " ")
+			break
+		}
+		if command != "" && (args[i] != "--name" || i+1 == len(args)) {
+			command += " " + args[i]
+			continue
+		}
 		if args[i] == "--name" && i+1 < len(args) {
 			name = args[i+1]
 			i++
+		} else if args[i] == "--restart" && i+1 < len(args) {
+			opts.Restart = args[i+1]
+			i++
+		} else if args[i] == "--max-restarts" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid max restarts: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			opts.MaxRestarts = n
+			i++
+		} else if args[i] == "--stop-signal" && i+1 < len(args) {
+			opts.StopSignal = args[i+1]
+			i++
+		} else if args[i] == "--stop-timeout" && i+1 < len(args) {
+			opts.StopTimeout = parseDuration("stop timeout", args[i+1])
+			i++
+		} else if args[i] == "--log-max-size" && i+1 < len(args) {
+			n, err := task.ParseSize(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+			opts.Log.MaxSize = n
+			i++
+		} else if args[i] == "--log-max-files" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid log max files: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			opts.Log.MaxFiles = n
+			i++
+		} else if args[i] == "--cwd" && i+1 < len(args) {
+			opts.Cwd = absPath(args[i+1])
+			i++
+		} else if args[i] == "--env" && i+1 < len(args) {
+			opts.Env = append(opts.Env, args[i+1])
+			i++
+		} else if args[i] == "--env-file" && i+1 < len(args) {
+			opts.EnvFiles = append(opts.EnvFiles, args[i+1])
+			i++
+		} else if args[i] == "--clear-env" {
+			opts.ClearEnv = true
+		} else if args[i] == "--shell" && i+1 < len(args) {
+			opts.Shell = args[i+1]
+			i++
+		} else if args[i] == "--ready" && i+1 < len(args) {
+			readySpec = args[i+1]
+			i++
+		} else if args[i] == "--ready-interval" && i+1 < len(args) {
+			probe.Interval = parseDuration("ready interval", args[i+1])
+			i++
+		} else if args[i] == "--ready-timeout" && i+1 < len(args) {
+			probe.Timeout = parseDuration("ready timeout", args[i+1])
+			i++
+		} else if args[i] == "--ready-failures" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid ready failures: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			probe.FailureThreshold = n
+			i++
+		} else if args[i] == "--ready-grace" && i+1 < len(args) {
+			probe.Grace = parseDuration("ready grace", args[i+1])
+			i++
+		} else if args[i] == "--wait-ready" {
+			waitReady = true
+		} else if args[i] == "--memory" && i+1 < len(args) {
+			n, err := task.ParseSize(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+			opts.Limits.Memory = max(n, 0)
+			i++
+		} else if args[i] == "--cpus" && i+1 < len(args) {
+			n, err := strconv.ParseFloat(args[i+1], 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid cpus: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			opts.Limits.CPUs = n
+			i++
+		} else if args[i] == "--pids" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid pids: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			opts.Limits.Pids = n
+			i++
+		} else if args[i] == "--nofile" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid nofile: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			opts.Limits.NoFile = n
+			i++
+		} else if args[i] == "--timeout" && i+1 < len(args) {
+			opts.Limits.Timeout = parseDuration("timeout", args[i+1])
+			i++
 		} else {
 			if command != "" {
 				command += " "
@@ -182,16 +441,44 @@ func cmdStart(mgr *task.Manager, args []string) {
 		}
 	}
 
-	taskID, err := mgr.StartTask(name, command)
+	if readySpec != "" {
+		p, err := task.ParseProbe(readySpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		p.Interval, p.Timeout, p.FailureThreshold, p.Grace = probe.Interval, probe.Timeout, probe.FailureThreshold, probe.Grace
+		opts.Ready = p
+	} else if probe != (task.Probe{}) {
+		fmt.Fprintln(os.Stderr, "Error: --ready-* settings need a --ready probe")
+		os.Exit(1)
+	}
+
+	taskID, err := mgr.StartTask(name, command, opts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
 
 	fmt.Printf("Started task %d: %s\n", taskID, name)
+
+	if waitReady {
+		waitForReady(mgr, int(taskID))
+	}
+}
+
+// waitForReady blocks until a task passes its readiness probe, exiting
+// with an error if it becomes unhealthy or ends first
+func waitForReady(mgr task.Controller, id int) {
+	start := time.Now()
+	if _, err := task.WaitReady(mgr, id, 0); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Task %d is ready (%s)\n", id, time.Since(start).Round(100*time.Millisecond))
 }
 
-func cmdStop(mgr *task.Manager, args []string) {
+func cmdStop(mgr task.Controller, args []string) {
 	if len(args) == 0 {
 		fmt.Fprintln(os.Stderr, "Error: task ID is required")
 		os.Exit(1)
@@ -203,15 +490,31 @@ func cmdStop(mgr *task.Manager, args []string) {
 		os.Exit(1)
 	}
 
-	if err := mgr.StopTask(id); err != nil {
+	opts := task.StopOptions{Reason: task.ReasonUserStop}
+	for i := 1; i < len(args); i++ {
+		if args[i] == "--signal" && i+1 < len(args) {
+			opts.Signal = args[i+1]
+			i++
+		} else if args[i] == "--timeout" && i+1 < len(args) {
+			opts.Timeout = parseDuration("timeout", args[i+1])
+			i++
+		}
+	}
+
+	fmt.Printf("Stopping task %d...\n", id)
+	if err := mgr.StopTask(id, opts); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
 
+	if t, err := mgr.GetTask(id); err == nil && t.ExitSummary() != "" {
+		fmt.Printf("Stopped task %d (%s)\n", id, t.ExitSummary())
+		return
+	}
 	fmt.Printf("Stopped task %d\n", id)
 }
 
-func cmdList(mgr *task.Manager) {
+func cmdList(mgr task.Controller) {
 	tasks, err := mgr.ListTasks()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
@@ -223,29 +526,124 @@ func cmdList(mgr *task.Manager) {
 		return
 	}
 
-	fmt.Printf("%-4s %-10s %-30s %-8s %s\n", "ID", "STATUS", "NAME", "PID", "STARTED")
-	fmt.Println(strings.Repeat("-", 80))
+	fmt.Printf("%-4s %-10s %-30s %-8s %-20s %-10s %-4s %s\n", "ID", "STATUS", "NAME", "PID", "STARTED", "EXIT", "RST", "REASON")
+	fmt.Println(strings.Repeat("-", 105))
 	for _, t := range tasks {
-		fmt.Printf("%-4d %-10s %-30s %-8d %s\n",
+		exit := t.ExitSummary()
+		if exit == "" {
+			exit = "-"
+		}
+		reason := t.TerminationReason
+		if reason == "" {
+			reason = "-"
+		}
+		fmt.Printf("%-4d %-10s %-30s %-8d %-20s %-10s %-4d %s\n",
 			t.ID, t.Status, truncate(t.Name, 30), t.PID,
-			t.StartTime.Format("2006-01-02 15:04:05"))
+			t.StartTime.Format("2006-01-02 15:04:05"), exit, t.RestartCount, reason)
 	}
 }
 
-func cmdLogs(mgr *task.Manager, args []string) {
-	if len(args) == 0 {
-		fmt.Fprintln(os.Stderr, "Error: task ID is required")
-		os.Exit(1)
+// topWindow is how much CPU history the sparkline in watchy top covers
+const topWindow = 5 * time.Minute
+
+func cmdTop(mgr task.Controller, args []string) {
+	once := false
+	interval := 2 * time.Second
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--once" {
+			once = true
+		} else if (args[i] == "-d" || args[i] == "--interval") && i+1 < len(args) {
+			interval = parseDuration("interval", args[i+1])
+			i++
+		} else {
+			fmt.Fprintln(os.Stderr, "Usage: watchy top [--once] [-d <duration>]")
+			os.Exit(1)
+		}
 	}
 
-	id, err := strconv.Atoi(args[0])
+	for {
+		out, err := renderTop(mgr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		if once {
+			fmt.Print(out)
+			return
+		}
+		// Clear the screen and redraw from the top left
+		fmt.Print("\033[H\033[2J" + out)
+		time.Sleep(interval)
+	}
+}
+
+// renderTop formats the watchy top table: running tasks, busiest first
+func renderTop(mgr task.Controller) (string, error) {
+	tasks, err := mgr.ListTasks()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: invalid task ID: %s\n", args[0])
-		os.Exit(1)
+		return "", err
 	}
 
-	lines := 50
-	for i := 1; i < len(args); i++ {
+	type row struct {
+		t       *task.Task
+		samples []task.Metric
+	}
+	var rows []row
+	since := time.Now().Add(-topWindow)
+	for _, t := range tasks {
+		if !t.Alive() {
+			continue
+		}
+		samples, err := mgr.TaskMetrics(t.ID, since)
+		if err != nil {
+			continue
+		}
+		rows = append(rows, row{t, samples})
+	}
+	lastCPU := func(r row) float64 {
+		if len(r.samples) == 0 {
+			return -1
+		}
+		return r.samples[len(r.samples)-1].CPU
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return lastCPU(rows[i]) > lastCPU(rows[j])
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "watchy top - %s - %d running\n\n", time.Now().Format("15:04:05"), len(rows))
+	if len(rows) == 0 {
+		b.WriteString("No running tasks\n")
+		return b.String(), nil
+	}
+	fmt.Fprintf(&b, "%-4s %-24s %-10s %6s %7s %5s %5s %5s  %s\n", "ID", "NAME", "STATUS", "CPU%", "MEM", "THR", "FDS", "PROCS", "CPU (5m)")
+	b.WriteString(strings.Repeat("-", 100) + "\n")
+	for _, r := range rows {
+		if len(r.samples) == 0 {
+			fmt.Fprintf(&b, "%-4d %-24s %-10s %6s %7s %5s %5s %5s\n", r.t.ID, truncate(r.t.Name, 24), r.t.Status, "-", "-", "-", "-", "-")
+			continue
+		}
+		cpu := make([]float64, len(r.samples))
+		for i, s := range r.samples {
+			cpu[i] = s.CPU
+		}
+		last := r.samples[len(r.samples)-1]
+		fmt.Fprintf(&b, "%-4d %-24s %-10s %6.1f %7s %5d %5d %5d  %s\n",
+			r.t.ID, truncate(r.t.Name, 24), r.t.Status, last.CPU, task.FormatBytes(last.RSS),
+			last.Threads, last.FDs, last.Procs, sparkline.Render(cpu, max(100, slices.Max(cpu)), 30))
+	}
+	return b.String(), nil
+}
+
+func cmdLogs(mgr task.Controller, args []string) {
+	var ids []int
+	lines := -1
+	var filter task.LogFilter
+	timestamps := false
+	follow := false
+	exitCode := false
+	for i := 0; i < len(args); i++ {
+		var err error
 		if args[i] == "-n" && i+1 < len(args) {
 			lines, err = strconv.Atoi(args[i+1])
 			if err != nil {
@@ -253,52 +651,355 @@ func cmdLogs(mgr *task.Manager, args []string) {
 				os.Exit(1)
 			}
 			i++
+		} else if args[i] == "--stdout" {
+			filter.Stream = task.StreamStdout
+		} else if args[i] == "--stderr" {
+			filter.Stream = task.StreamStderr
+		} else if args[i] == "--since" && i+1 < len(args) {
+			filter.Since, err = parseSince(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+			i++
+		} else if args[i] == "-t" || args[i] == "--timestamps" {
+			timestamps = true
+		} else if args[i] == "-f" || args[i] == "--follow" {
+			follow = true
+		} else if args[i] == "--exit-code" {
+			exitCode = true
+		} else {
+			id, err := strconv.Atoi(args[i])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid task ID: %s\n", args[i])
+				os.Exit(1)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: task ID is required")
+		os.Exit(1)
+	}
+
+	if follow {
+		if !filter.IsZero() || timestamps {
+			fmt.Fprintln(os.Stderr, "Error: -f can't be combined with --stdout, --stderr, --since or -t")
+			os.Exit(1)
 		}
+		if lines < 0 {
+			lines = 10
+		}
+		followLogs(mgr, ids, lines, exitCode)
+		return
+	}
+
+	if len(ids) > 1 {
+		fmt.Fprintln(os.Stderr, "Error: only one task ID is allowed without -f")
+		os.Exit(1)
+	}
+	id := ids[0]
+	if lines < 0 {
+		lines = 50
+	}
+
+	// Plain log unless the stream log is needed
+	if filter.IsZero() && !timestamps {
+		logLines, err := mgr.TailLogs(id, lines)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		for _, line := range logLines {
+			fmt.Println(line)
+		}
+		return
 	}
 
-	logLines, err := mgr.TailLogs(id, lines)
+	logLines, err := mgr.TailLogLines(id, lines, filter)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
+	for _, l := range logLines {
+		if timestamps && !l.Time.IsZero() {
+			fmt.Printf("%s %-6s %s\n", l.Time.Format("2006-01-02 15:04:05.000"), l.Stream, l.Text)
+		} else {
+			fmt.Println(l.Text)
+		}
+	}
+}
+
+// followColors are assigned to followed tasks in order
+var followColors = []lipgloss.Color{"39", "208", "141", "46", "205", "51", "214", "196"}
+
+// followed is a task being followed by followLogs
+type followed struct {
+	id       int
+	prefix   string
+	follower *task.LogFollower
+	task     *task.Task
+}
+
+// followLogs prints each task's last lines and then new output as it is
+// written, until every task has finished. With several tasks each line is
+// prefixed with its task's name. With exitCode, watchy exits with the worst
+// exit code among the tasks.
+func followLogs(mgr task.Controller, ids []int, lines int, exitCode bool) {
+	var tasks []*followed
+	width := 0
+	for _, id := range ids {
+		t, err := mgr.GetTask(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		name := fmt.Sprintf("%d:%s", t.ID, t.Name)
+		if len(name) > 20 {
+			name = name[:17] + "..."
+		}
+		width = max(width, len(name))
+		tasks = append(tasks, &followed{id: id, prefix: name, task: t})
+	}
+	for i, f := range tasks {
+		if len(tasks) == 1 {
+			f.prefix = ""
+			continue
+		}
+		style := lipgloss.NewStyle().Foreground(followColors[i%len(followColors)])
+		f.prefix = style.Render(fmt.Sprintf("%-*s |", width, f.prefix)) + " "
+	}
+
+	emit := func(f *followed, lines []string) {
+		for _, line := range lines {
+			fmt.Println(f.prefix + line)
+		}
+	}
+
+	// Start following before printing the tail, so a line written in between
+	// may show twice but is never lost
+	for _, f := range tasks {
+		f.follower = task.NewLogFollower(f.task.LogPath)
+		defer f.follower.Close()
+	}
+	if lines > 0 {
+		for _, f := range tasks {
+			tail, err := mgr.TailLogs(f.id, lines)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+			emit(f, tail)
+		}
+	}
+
+	worst := 0
+	active := tasks
+	for polls := 0; len(active) > 0; polls++ {
+		time.Sleep(200 * time.Millisecond)
+
+		// Check on the tasks once a second; output keeps flowing meanwhile
+		checkStatus := polls%5 == 0
+		var still []*followed
+		for _, f := range active {
+			newLines, err := f.follower.Poll()
+			emit(f, newLines)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading log for task %d: %s\n", f.id, err)
+			}
+
+			if checkStatus {
+				if t, err := mgr.GetTask(f.id); err == nil {
+					f.task = t
+				}
+			}
+			if f.task.Alive() || f.task.Status == "restarting" {
+				still = append(still, f)
+				continue
+			}
+
+			// Finished: give the log writer a moment to drain, then read the rest
+			time.Sleep(100 * time.Millisecond)
+			newLines, _ = f.follower.Poll()
+			emit(f, newLines)
+			emit(f, f.follower.Flush())
+			worst = max(worst, exitCodeOf(f.task))
+		}
+		active = still
+	}
+
+	if exitCode && worst != 0 {
+		os.Exit(worst)
+	}
+}
+
+// exitCodeOf maps how a task ended to a shell-style exit code: its own exit
+// code, 128+N for a fatal signal, and 0 for tasks that were stopped on purpose
+func exitCodeOf(t *task.Task) int {
+	switch t.TerminationReason {
+	case task.ReasonUserStop, task.ReasonAgentStop:
+		return 0
+	case task.ReasonTimeout:
+		return 124 // as timeout(1) does
+	}
+	if t.ExitCode != nil {
+		return *t.ExitCode
+	}
+	if t.Signal != "" {
+		return 128 + int(unix.SignalNum(t.Signal))
+	}
+	if t.Status == "crashed" {
+		return 1
+	}
+	return 0
+}
 
-	for _, line := range logLines {
-		fmt.Println(line)
+// parseSince parses a --since value: either a duration back from now
+// ("10m", "2h") or a local time ("2006-01-02 15:04", "15:04", RFC 3339)
+func parseSince(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
 	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			now := time.Now()
+			return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value: %s (use e.g. 10m or \"2006-01-02 15:04\")", value)
 }
 
-func cmdAsk(mgr *task.Manager, cfg *config.Config, ollamaHost string, args []string) {
-	if len(args) < 2 {
+func cmdAsk(mgr task.Controller, cfg *config.Config, ollamaHost string, args []string) {
+	var yes bool
+	var rest []string
+	for _, arg := range args {
+		if arg == "--yes" || arg == "-y" {
+			yes = true
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) < 2 {
 		fmt.Fprintln(os.Stderr, "Error: task ID and question are required")
-		fmt.Fprintln(os.Stderr, "Usage: watchy ask <task-id> \"<question>\"")
+		fmt.Fprintln(os.Stderr, "Usage: watchy ask [--yes] <task-id> \"<question>\"")
 		os.Exit(1)
 	}
 
-	id, err := strconv.Atoi(args[0])
+	id, err := strconv.Atoi(rest[0])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: invalid task ID: %s\n", args[0])
+		fmt.Fprintf(os.Stderr, "Error: invalid task ID: %s\n", rest[0])
 		os.Exit(1)
 	}
 
-	question := strings.Join(args[1:], " ")
+	question := strings.Join(rest[1:], " ")
 
-	a, err := agent.NewAgentWithModel(mgr, cfg.Model, ollamaHost)
+	a, err := newAgent(mgr, cfg, ollamaHost)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
+	if yes {
+		a.SetApprover(func(context.Context, agent.ApprovalRequest) (agent.Decision, error) {
+			return agent.Approve, nil
+		})
+	} else {
+		a.SetApprover(approveOnTerminal(bufio.NewReader(os.Stdin)))
+	}
 
 	fmt.Println("Asking agent...")
-	answer, err := a.Ask(id, question)
+	var out streamPrinter
+	answer, err := a.Ask(id, question, out.write)
 	if err != nil {
+		out.end()
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
+	if !out.wrote {
+		fmt.Println(answer)
+	}
+	out.end()
+}
+
+// streamPrinter prints an agent reply as it streams in: the answer to
+// stdout and the model's thinking to stderr, so the answer can be piped
+type streamPrinter struct {
+	wrote    bool // some of the answer has been printed
+	thinking bool // the last thing printed was thinking
+	open     bool // the output doesn't end with a newline
+}
+
+func (p *streamPrinter) write(evt agent.ContentEvent) {
+	if evt.Thinking != "" {
+		fmt.Fprint(os.Stderr, evt.Thinking)
+		p.thinking = true
+		p.open = !strings.HasSuffix(evt.Thinking, "\n")
+	}
+	if evt.Content != "" {
+		if p.thinking {
+			fmt.Fprint(os.Stderr, "\n\n")
+			p.thinking = false
+		}
+		fmt.Print(evt.Content)
+		p.wrote = true
+		p.open = !strings.HasSuffix(evt.Content, "\n")
+	}
+}
+
+// end finishes the output with a newline
+func (p *streamPrinter) end() {
+	if p.open {
+		fmt.Println()
+		p.open = false
+	}
+}
+
+// newAgent creates the agent with the model, sandbox and tool approval
+// policies from the config
+func newAgent(mgr task.Controller, cfg *config.Config, ollamaHost string) (*agent.Agent, error) {
+	policies, err := agent.ParsePolicies(cfg.ToolApproval)
+	if err != nil {
+		return nil, fmt.Errorf("tool_approval in %s: %w", cfg.ConfigPath, err)
+	}
+	a, err := agent.NewAgentWithModel(mgr, cfg.Model, ollamaHost)
+	if err != nil {
+		return nil, err
+	}
+	a.SetSandbox(cfg.AgentSandbox)
+	a.SetPolicies(policies)
+	return a, nil
+}
 
-	fmt.Println(answer)
+// approveOnTerminal asks on the terminal whether the agent may make a tool
+// call. Anything but yes or always, including end of input, denies it.
+func approveOnTerminal(in *bufio.Reader) agent.Approver {
+	return func(ctx context.Context, req agent.ApprovalRequest) (agent.Decision, error) {
+		fmt.Printf("The agent wants to run %s %s\nAllow? [y/N/a(lways)] ", req.Tool, req.Args)
+		answer, err := in.ReadString('\n')
+		if err != nil {
+			fmt.Println()
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return agent.Approve, nil
+		case "a", "always":
+			return agent.ApproveAlways, nil
+		}
+		return agent.Deny, nil
+	}
 }
 
-func cmdTUI(mgr *task.Manager, cfg *config.Config, ollamaHost string, tickStore *tick.Store) {
+// cmdTUI launches the TUI, in the chat pane if chat is set, resuming chat
+// session resume unless it is 0
+func cmdTUI(mgr task.Controller, cfg *config.Config, ollamaHost string, tickStore *tick.Store, chat bool, resume int) {
 	// Run auto-cleanup before starting TUI
 	cleaned, err := mgr.Cleanup(cfg.RetentionDays)
 	if err != nil {
@@ -307,13 +1008,19 @@ func cmdTUI(mgr *task.Manager, cfg *config.Config, ollamaHost string, tickStore
 		fmt.Printf("Cleaned up %d old task(s)\n", cleaned)
 	}
 
-	a, err := agent.NewAgentWithModel(mgr, cfg.Model, ollamaHost)
+	a, err := newAgent(mgr, cfg, ollamaHost)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating agent: %s\n", err)
 		os.Exit(1)
 	}
 
 	model := tui.New(mgr, a, cfg, tickStore)
+	if chat {
+		if err := model.OpenChat(resume); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+	}
 	p := tea.NewProgram(model, tea.WithAltScreen())
 	model.SetProgram(p)
 
@@ -323,9 +1030,168 @@ func cmdTUI(mgr *task.Manager, cfg *config.Config, ollamaHost string, tickStore
 	}
 }
 
-func cmdCleanup(mgr *task.Manager, cfg *config.Config) {
-	count, err := mgr.Cleanup(cfg.RetentionDays)
-	if err != nil {
+func cmdChat(mgr task.Controller, cfg *config.Config, ollamaHost string, tickStore *tick.Store, args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "list":
+			cmdChatList(mgr)
+			return
+		case "export":
+			cmdChatExport(mgr, args[1:])
+			return
+		}
+	}
+
+	resume := 0
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--resume" && i+1 < len(args) {
+			id, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid chat ID: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			resume = id
+			i++
+		} else {
+			fmt.Fprintln(os.Stderr, "Usage:")
+			fmt.Fprintln(os.Stderr, "  watchy chat [--resume <id>]")
+			fmt.Fprintln(os.Stderr, "  watchy chat list")
+			fmt.Fprintln(os.Stderr, "  watchy chat export <id> [--format md|json]")
+			os.Exit(1)
+		}
+	}
+	cmdTUI(mgr, cfg, ollamaHost, tickStore, true, resume)
+}
+
+func cmdChatList(mgr task.Controller) {
+	sessions, err := mgr.ListChatSessions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	if len(sessions) == 0 {
+		fmt.Println("No saved chats")
+		return
+	}
+
+	fmt.Printf("%-4s %-20s %-6s %-5s %-20s %s\n", "ID", "UPDATED", "TASK", "MSGS", "MODEL", "TITLE")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, s := range sessions {
+		taskID := "-"
+		if s.TaskID != 0 {
+			taskID = strconv.Itoa(s.TaskID)
+		}
+		fmt.Printf("%-4d %-20s %-6s %-5d %-20s %s\n",
+			s.ID, s.UpdatedAt.Format("2006-01-02 15:04:05"), taskID, s.MessageCount, truncate(s.Model, 20), s.Title)
+	}
+}
+
+func cmdChatExport(mgr task.Controller, args []string) {
+	format := "md"
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--format" && i+1 < len(args) {
+			format = args[i+1]
+			i++
+		} else {
+			rest = append(rest, args[i])
+		}
+	}
+	if len(rest) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy chat export <id> [--format md|json]")
+		os.Exit(1)
+	}
+	if format != "md" && format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: invalid format %q (use md or json)\n", format)
+		os.Exit(1)
+	}
+	id, err := strconv.Atoi(rest[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid chat ID: %s\n", rest[0])
+		os.Exit(1)
+	}
+
+	cs, err := mgr.GetChatSession(id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	if format == "json" {
+		data, err := json.MarshalIndent(cs, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Print(chatMarkdown(mgr, cs))
+}
+
+// chatMarkdown renders a chat session as a Markdown transcript, with tool
+// calls and results in code blocks
+func chatMarkdown(mgr task.Controller, cs *task.ChatSession) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", cs.Title)
+	fmt.Fprintf(&b, "- Chat: %d\n", cs.ID)
+	if cs.TaskID != 0 {
+		if t, err := mgr.GetTask(cs.TaskID); err == nil {
+			fmt.Fprintf(&b, "- Task: %d (%s)\n", t.ID, t.Name)
+		} else {
+			fmt.Fprintf(&b, "- Task: %d\n", cs.TaskID)
+		}
+	}
+	if cs.Model != "" {
+		fmt.Fprintf(&b, "- Model: %s\n", cs.Model)
+	}
+	fmt.Fprintf(&b, "- Started: %s\n", cs.CreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "- Updated: %s\n", cs.UpdatedAt.Format("2006-01-02 15:04:05"))
+
+	for _, msg := range cs.Messages {
+		switch msg.Role {
+		case "user":
+			fmt.Fprintf(&b, "\n## You\n\n%s\n", strings.TrimSpace(msg.Content))
+		case "assistant":
+			fmt.Fprintf(&b, "\n## Agent\n")
+			if thinking := strings.TrimSpace(msg.Thinking); thinking != "" {
+				fmt.Fprintf(&b, "\n<details><summary>Thinking</summary>\n\n%s\n\n</details>\n", thinking)
+			}
+			if content := strings.TrimSpace(msg.Content); content != "" {
+				fmt.Fprintf(&b, "\n%s\n", content)
+			}
+			var calls []api.ToolCall
+			json.Unmarshal(msg.ToolCalls, &calls)
+			for _, call := range calls {
+				args, _ := json.MarshalIndent(call.Function.Arguments, "", "  ")
+				fmt.Fprintf(&b, "\nTool call `%s`:\n\n%s", call.Function.Name, codeBlock("json", string(args)))
+			}
+		case "tool":
+			fmt.Fprintf(&b, "\nResult of `%s`:\n\n%s", msg.ToolName, codeBlock("", msg.Content))
+		}
+	}
+	return b.String()
+}
+
+// codeBlock fences text, with a fence longer than any run of backticks in it
+func codeBlock(lang, text string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fmt.Sprintf("%s%s\n%s\n%s\n", fence, lang, strings.TrimRight(text, "\n"), fence)
+}
+
+func cmdCleanup(mgr task.Controller, cfg *config.Config) {
+	count, err := mgr.Cleanup(cfg.RetentionDays)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
@@ -333,12 +1199,163 @@ func cmdCleanup(mgr *task.Manager, cfg *config.Config) {
 	fmt.Printf("Cleaned up %d old task(s)\n", count)
 }
 
-func cmdTick(store *tick.Store, args []string) {
+func cmdDaemon(cfg *config.Config, args []string) {
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+
+	switch sub {
+	case "", "run":
+		if err := daemon.Run(cfg, version); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+	case "status":
+		client, err := daemon.Dial(cfg)
+		if err != nil {
+			fmt.Println("watchyd is not running")
+			return
+		}
+		defer client.Close()
+
+		st, err := client.Status()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("watchyd %s running (pid %d, up %s)\n", st.Version, st.PID, time.Since(st.Started).Round(time.Second))
+		fmt.Printf("socket: %s\n", cfg.SocketPath)
+		fmt.Printf("log:    %s\n", cfg.DaemonLogPath)
+	case "stop":
+		client, err := daemon.Dial(cfg)
+		if err != nil {
+			fmt.Println("watchyd is not running")
+			return
+		}
+		defer client.Close()
+
+		if err := client.Shutdown(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Stopped watchyd (running tasks keep running)")
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown daemon subcommand: %s\n", sub)
+		os.Exit(1)
+	}
+}
+
+func cmdDB(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  watchy db status")
+		fmt.Fprintln(os.Stderr, "  watchy db migrate [--dry-run]")
+		os.Exit(1)
+	}
+
+	var readOnly, dryRun bool
+	switch args[0] {
+	case "status":
+		readOnly = true
+	case "migrate":
+		dryRun = len(args) > 1 && args[1] == "--dry-run"
+		readOnly = dryRun
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown db subcommand: %s\n", args[0])
+		os.Exit(1)
+	}
+
+	// Inspecting mustn't create or change the database
+	open := task.OpenStorage
+	if readOnly {
+		open = task.OpenStorageReadOnly
+	}
+	storage, err := open(cfg.DBPath)
+	if readOnly && errors.Is(err, fs.ErrNotExist) {
+		fmt.Printf("No database at %s yet; it is created when the daemon first starts\n", cfg.DBPath)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	defer storage.Close()
+
+	if args[0] == "status" {
+		cmdDBStatus(storage)
+	} else {
+		cmdDBMigrate(storage, dryRun)
+	}
+}
+
+func cmdDBStatus(storage *task.Storage) {
+	version, err := storage.SchemaVersion()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	pending, err := storage.PendingMigrations()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Schema version: %d (latest %d)\n", version, task.LatestSchemaVersion())
+	if len(pending) == 0 {
+		fmt.Println("Up to date")
+		return
+	}
+	fmt.Printf("%d pending migration(s), run: watchy db migrate\n", len(pending))
+}
+
+func cmdDBMigrate(storage *task.Storage, dryRun bool) {
+	pending, err := storage.PendingMigrations()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	if len(pending) == 0 {
+		fmt.Println("No pending migrations")
+		return
+	}
+
+	if dryRun {
+		fmt.Println("Pending migrations:")
+		for _, m := range pending {
+			fmt.Printf("  %3d  %s\n", m.Version, m.Description)
+		}
+		return
+	}
+
+	backup, applied, err := storage.Migrate()
+	if backup != "" {
+		fmt.Printf("Backed up database to %s\n", backup)
+	}
+	for _, m := range applied {
+		fmt.Printf("Applied %3d  %s\n", m.Version, m.Description)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func cmdTick(mgr task.Controller, cfg *config.Config, store *tick.Store, stacks *stack.Store, args []string) {
 	if len(args) == 0 {
 		fmt.Fprintln(os.Stderr, "Usage:")
 		fmt.Fprintln(os.Stderr, "  watchy tick save <name> <command>")
 		fmt.Fprintln(os.Stderr, "  watchy tick list")
+		fmt.Fprintln(os.Stderr, "  watchy tick show <name>")
+		fmt.Fprintln(os.Stderr, "  watchy tick history <name> [--since <10m|time>] [-n <runs>]")
+		fmt.Fprintln(os.Stderr, "  watchy tick edit <name>")
+		fmt.Fprintln(os.Stderr, "  watchy tick mv <name> <new-name>")
 		fmt.Fprintln(os.Stderr, "  watchy tick rm <name>")
+		fmt.Fprintln(os.Stderr, "  watchy tick schedule <name> <schedule> [--overlap skip|queue|replace]")
+		fmt.Fprintln(os.Stderr, "  watchy tick unschedule <name>")
+		fmt.Fprintln(os.Stderr, "  watchy tick import [--from procfile|npm|make|justfile] [--prefix <prefix>] [--sync] [--yes] [path]")
 		os.Exit(1)
 	}
 
@@ -346,9 +1363,23 @@ func cmdTick(store *tick.Store, args []string) {
 	case "save":
 		cmdTickSave(store, args[1:])
 	case "list":
-		cmdTickList(store)
+		cmdTickList(mgr, cfg, store)
+	case "show":
+		cmdTickShow(store, args[1:])
+	case "history":
+		cmdTickHistory(mgr, args[1:])
+	case "edit":
+		cmdTickEdit(store, args[1:])
+	case "mv":
+		cmdTickMv(store, stacks, args[1:])
 	case "rm":
 		cmdTickRm(store, args[1:])
+	case "schedule":
+		cmdTickSchedule(store, args[1:])
+	case "unschedule":
+		cmdTickUnschedule(store, args[1:])
+	case "import":
+		cmdTickImport(store, args[1:])
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown tick subcommand: %s\n", args[0])
 		os.Exit(1)
@@ -356,15 +1387,151 @@ func cmdTick(store *tick.Store, args []string) {
 }
 
 func cmdTickSave(store *tick.Store, args []string) {
-	if len(args) < 2 {
-		fmt.Fprintln(os.Stderr, "Usage: watchy tick save <name> <command>")
+	var t tick.Tick
+	var rest []string
+	// Options come before the command, as for watchy start; -- ends them
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			rest = append(rest, args[i+1:]...)
+			break
+		}
+		if len(rest) >= 2 {
+			rest = append(rest, args[i])
+			continue
+		}
+		if args[i] == "--restart" && i+1 < len(args) {
+			t.Restart = args[i+1]
+			i++
+		} else if args[i] == "--max-restarts" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid max restarts: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			t.MaxRestarts = n
+			i++
+		} else if args[i] == "--stop-signal" && i+1 < len(args) {
+			t.StopSignal = args[i+1]
+			i++
+		} else if args[i] == "--stop-timeout" && i+1 < len(args) {
+			t.StopTimeout = args[i+1]
+			i++
+		} else if args[i] == "--log-max-size" && i+1 < len(args) {
+			t.LogMaxSize = args[i+1]
+			i++
+		} else if args[i] == "--log-max-files" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid log max files: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			t.LogMaxFiles = n
+			i++
+		} else if args[i] == "--cwd" && i+1 < len(args) {
+			t.Cwd = absPath(args[i+1])
+			i++
+		} else if args[i] == "--env" && i+1 < len(args) {
+			t.Env = append(t.Env, args[i+1])
+			i++
+		} else if args[i] == "--env-file" && i+1 < len(args) {
+			t.EnvFiles = append(t.EnvFiles, args[i+1])
+			i++
+		} else if args[i] == "--clear-env" {
+			t.ClearEnv = true
+		} else if args[i] == "--shell" && i+1 < len(args) {
+			t.Shell = args[i+1]
+			i++
+		} else if args[i] == "--ready" && i+1 < len(args) {
+			t.Ready = args[i+1]
+			i++
+		} else if args[i] == "--ready-interval" && i+1 < len(args) {
+			t.ReadyInterval = args[i+1]
+			i++
+		} else if args[i] == "--ready-timeout" && i+1 < len(args) {
+			t.ReadyTimeout = args[i+1]
+			i++
+		} else if args[i] == "--ready-failures" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid ready failures: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			t.ReadyFailures = n
+			i++
+		} else if args[i] == "--ready-grace" && i+1 < len(args) {
+			t.ReadyGrace = args[i+1]
+			i++
+		} else if args[i] == "--memory" && i+1 < len(args) {
+			t.Memory = args[i+1]
+			i++
+		} else if args[i] == "--cpus" && i+1 < len(args) {
+			n, err := strconv.ParseFloat(args[i+1], 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid cpus: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			t.CPUs = n
+			i++
+		} else if args[i] == "--pids" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid pids: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			t.Pids = n
+			i++
+		} else if args[i] == "--nofile" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid nofile: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			t.NoFile = n
+			i++
+		} else if args[i] == "--timeout" && i+1 < len(args) {
+			t.Timeout = args[i+1]
+			i++
+		} else if args[i] == "--schedule" && i+1 < len(args) {
+			t.Schedule = args[i+1]
+			i++
+		} else if args[i] == "--overlap" && i+1 < len(args) {
+			t.Overlap = args[i+1]
+			i++
+		} else if args[i] == "--param" && i+1 < len(args) {
+			p, err := tick.ParseParam(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+			t.Params = append(t.Params, p)
+			i++
+		} else if args[i] == "--description" && i+1 < len(args) {
+			t.Description = args[i+1]
+			i++
+		} else {
+			rest = append(rest, args[i])
+		}
+	}
+
+	if len(rest) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy tick save <name> [--restart <policy>] [--max-restarts <n>]... <command>")
 		os.Exit(1)
 	}
 
-	name := args[0]
-	command := strings.Join(args[1:], " ")
+	name := rest[0]
+	// Parameters given a default can be written as that value in the command
+	command, err := tick.Generalize(strings.Join(rest[1:], " "), t.Params)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	t.Command = command
 
-	if err := store.Save(name, command, ""); err != nil {
+	if err := checkTick(t); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	if err := store.SaveTick(name, t); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
@@ -372,50 +1539,696 @@ func cmdTickSave(store *tick.Store, args []string) {
 	fmt.Printf("Saved tick %q: %s\n", name, command)
 }
 
-func cmdTickList(store *tick.Store) {
-	ticks := store.List()
-	if len(ticks) == 0 {
-		fmt.Println("No ticks saved")
-		fmt.Println("Save one with: watchy tick save <name> <command>")
-		return
+// checkTick validates the tick settings that tick.Store doesn't check
+// itself: start options and schedule
+func checkTick(t tick.Tick) error {
+	opts, err := t.StartOptions()
+	if err != nil {
+		return err
 	}
-
-	fmt.Printf("%-15s %s\n", "NAME", "COMMAND")
-	fmt.Println(strings.Repeat("-", 60))
-	for _, t := range ticks {
-		fmt.Printf("%-15s %s\n", t.Name, t.Tick.Command)
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if t.Schedule != "" {
+		if _, err := scheduler.Parse(t.Schedule); err != nil {
+			return err
+		}
+		if _, err := t.Render(nil); err != nil {
+			return fmt.Errorf("scheduled runs use parameter defaults: %w", err)
+		}
 	}
+	return nil
 }
 
-func cmdTickRm(store *tick.Store, args []string) {
-	if len(args) == 0 {
-		fmt.Fprintln(os.Stderr, "Usage: watchy tick rm <name>")
+func cmdTickShow(store *tick.Store, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy tick show <name>")
 		os.Exit(1)
 	}
-
-	if err := store.Remove(args[0]); err != nil {
+	name := args[0]
+	t, err := store.Get(name)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Removed tick %q\n", args[0])
+	var omit []string
+	if t.CreatedAt.IsZero() {
+		omit = append(omit, "created_at") // project ticks
+	}
+	doc, err := t.YAML(omit...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("# %s (%s)\n", name, tickSource(store.Source(name)))
+	os.Stdout.Write(doc)
 }
 
-func cmdRunTick(mgr *task.Manager, store *tick.Store, name string) {
+// cmdTickEdit opens the tick in $VISUAL or $EDITOR as YAML and saves it
+// back. If the result is invalid, the edited file is kept for another go.
+func cmdTickEdit(store *tick.Store, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy tick edit <name>")
+		os.Exit(1)
+	}
+	name := args[0]
 	t, err := store.Get(name)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
+	if source := store.Source(name); source != "" {
+		fmt.Fprintf(os.Stderr, "Error: tick %q is defined in %s; edit it there\n", name, source)
+		os.Exit(1)
+	}
 
-	taskID, err := mgr.StartTask(name, t.Command)
+	doc, err := t.YAML("created_at", "updated_at", "import")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	original := fmt.Sprintf("# Tick %q. Save and quit to apply it, or empty the file to cancel.\n%s", name, doc)
+	f, err := os.CreateTemp("", "watchy-tick-"+name+"-*.yaml")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	path := f.Name()
+	_, err = f.WriteString(original)
+	f.Close()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Started tick %q as task %d: %s\n", name, taskID, t.Command)
-	fmt.Printf("View logs: watchy logs %d\n", taskID)
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// Through the shell, so editors with flags ("code --wait") work
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s exited with %s; your changes are in %s\n", editor, err, path)
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	if string(data) == original {
+		os.Remove(path)
+		fmt.Printf("Tick %q unchanged\n", name)
+		return
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		os.Remove(path)
+		fmt.Println("Edit cancelled")
+		return
+	}
+
+	edited, err := tick.ParseYAML(data)
+	if err == nil {
+		edited.Import = t.Import
+		err = checkTick(edited)
+	}
+	if err == nil {
+		err = store.Update(name, edited)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		fmt.Fprintf(os.Stderr, "Your changes are in %s\n", path)
+		os.Exit(1)
+	}
+	os.Remove(path)
+	fmt.Printf("Updated tick %q\n", name)
+}
+
+func cmdTickHistory(mgr task.Controller, args []string) {
+	var since time.Time
+	limit := 20
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--since" && i+1 < len(args) {
+			t, err := parseSince(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+			since = t
+			i++
+		} else if args[i] == "-n" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "Error: invalid number of runs: %s\n", args[i+1])
+				os.Exit(1)
+			}
+			limit = n
+			i++
+		} else {
+			rest = append(rest, args[i])
+		}
+	}
+	if len(rest) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy tick history <name> [--since <10m|time>] [-n <runs>]")
+		os.Exit(1)
+	}
+	name := rest[0]
+
+	runs, err := mgr.TickRuns(name, since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	if len(runs) == 0 {
+		fmt.Printf("No runs of tick %q\n", name)
+		return
+	}
+
+	fmt.Printf("%-6s %-20s %-10s %s\n", "TASK", "STARTED", "DURATION", "RESULT")
+	fmt.Println(strings.Repeat("-", 60))
+	for _, t := range runs[:min(limit, len(runs))] {
+		duration := "-"
+		if d, ok := t.Duration(); ok {
+			duration = d.Round(time.Second).String()
+		} else if t.Alive() || t.Status == "restarting" {
+			duration = time.Since(t.CreatedAt).Round(time.Second).String()
+		}
+		result := t.Status
+		if exit := t.ExitSummary(); exit != "" && !t.Alive() {
+			result += ", " + exit
+		}
+		if t.TerminationReason != "" && t.TerminationReason != task.ReasonExited {
+			result += " (" + t.TerminationReason + ")"
+		}
+		fmt.Printf("%-6d %-20s %-10s %s\n", t.ID, t.CreatedAt.Format("2006-01-02 15:04:05"), duration, result)
+	}
+	if len(runs) > limit {
+		fmt.Printf("... %d earlier runs (show them with -n)\n", len(runs)-limit)
+	}
+
+	st := task.Stats(runs)
+	fmt.Println()
+	summary := fmt.Sprintf("%d runs: %d succeeded, %d failed", st.Runs, st.Succeeded, st.Failed)
+	if st.Stopped > 0 {
+		summary += fmt.Sprintf(", %d stopped", st.Stopped)
+	}
+	if st.Running > 0 {
+		summary += fmt.Sprintf(", %d running", st.Running)
+	}
+	if rate := st.SuccessRate(); rate >= 0 {
+		summary += fmt.Sprintf(" (%.0f%% success)", rate*100)
+	}
+	fmt.Println(summary)
+	if st.Succeeded+st.Failed > 0 {
+		fmt.Printf("Duration: p50 %s, p95 %s\n", st.P50.Round(time.Second).String(), st.P95.Round(time.Second).String())
+	}
+}
+
+func cmdTickMv(store *tick.Store, stacks *stack.Store, args []string) {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy tick mv <name> <new-name>")
+		os.Exit(1)
+	}
+	if err := store.Rename(args[0], args[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Renamed tick %q to %q\n", args[0], args[1])
+
+	changed, err := stacks.RenameTick(args[0], args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating stacks: %s\n", err)
+		os.Exit(1)
+	}
+	if len(changed) > 0 {
+		fmt.Printf("Updated stacks: %s\n", strings.Join(changed, ", "))
+	}
+}
+
+func cmdTickList(mgr task.Controller, cfg *config.Config, store *tick.Store) {
+	ticks := store.List()
+	if len(ticks) == 0 {
+		fmt.Println("No ticks saved")
+		fmt.Println("Save one with: watchy tick save <name> <command>")
+		return
+	}
+
+	fmt.Printf("%-15s %-20s %s\n", "NAME", "SOURCE", "COMMAND")
+	fmt.Println(strings.Repeat("-", 80))
+	shadowing := false
+	for _, t := range ticks {
+		command := t.Tick.Command
+		if params := t.Tick.Parameters(); len(params) > 0 {
+			names := make([]string, len(params))
+			for i, p := range params {
+				names[i] = p.String()
+			}
+			command += "  [" + strings.Join(names, " ") + "]"
+		}
+		source := tickSource(t.Source)
+		if store.Shadows(t.Name) {
+			source += " *"
+			shadowing = true
+		}
+		fmt.Printf("%-15s %-20s %s\n", t.Name, source, command)
+	}
+	if shadowing {
+		fmt.Println("* hides the global tick of the same name")
+	}
+
+	state, err := scheduler.LoadState(cfg.SchedulePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+	}
+	entries := scheduler.Entries(ticks, state, mgr, time.Now())
+	if len(entries) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Printf("%-15s %-20s %-8s %-20s %s\n", "SCHEDULED", "SCHEDULE", "OVERLAP", "NEXT RUN", "LAST RESULT")
+	fmt.Println(strings.Repeat("-", 90))
+	for _, e := range entries {
+		next := "never"
+		if e.Queued {
+			next = "queued"
+		} else if !e.Next.IsZero() {
+			next = e.Next.Format("2006-01-02 15:04:05")
+		}
+		last := e.Last
+		if last == "" {
+			last = "-"
+		}
+		fmt.Printf("%-15s %-20s %-8s %-20s %s\n", e.Name, truncate(e.Schedule, 20), e.Overlap, next, last)
+	}
+}
+
+// tickSource describes where a tick is defined: "global", or the project
+// file, relative to the current directory when that is shorter
+func tickSource(path string) string {
+	if path == "" {
+		return "global"
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, path); err == nil && len(rel) < len(path) {
+			path = rel
+		}
+	}
+	return path
+}
+
+func cmdTickSchedule(store *tick.Store, args []string) {
+	overlap := ""
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--overlap" && i+1 < len(args) {
+			overlap = args[i+1]
+			i++
+		} else {
+			rest = append(rest, args[i])
+		}
+	}
+	if len(rest) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy tick schedule <name> <schedule> [--overlap skip|queue|replace]")
+		fmt.Fprintln(os.Stderr, "  e.g. watchy tick schedule backup '0 3 * * *'")
+		fmt.Fprintln(os.Stderr, "       watchy tick schedule poll '@every 10m' --overlap queue")
+		os.Exit(1)
+	}
+
+	name := rest[0]
+	spec := strings.Join(rest[1:], " ")
+	sched, err := scheduler.Parse(spec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	if t, err := store.Get(name); err == nil {
+		if _, err := t.Render(nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: scheduled runs use parameter defaults: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := store.SetSchedule(name, spec, overlap); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	next := sched.Next(time.Now())
+	if next.IsZero() {
+		fmt.Printf("Scheduled tick %q (%s), but the schedule never fires\n", name, spec)
+		return
+	}
+	fmt.Printf("Scheduled tick %q (%s), next run %s\n", name, spec, next.Format("2006-01-02 15:04:05"))
+}
+
+func cmdTickUnschedule(store *tick.Store, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy tick unschedule <name>")
+		os.Exit(1)
+	}
+	if err := store.SetSchedule(args[0], "", ""); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Unscheduled tick %q\n", args[0])
+}
+
+func cmdTickRm(store *tick.Store, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy tick rm <name>")
+		os.Exit(1)
+	}
+
+	if err := store.Remove(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Removed tick %q\n", args[0])
+}
+
+func cmdTickImport(store *tick.Store, args []string) {
+	var format, prefix string
+	prefixSet, sync, yes := false, false, false
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--from" && i+1 < len(args) {
+			format = args[i+1]
+			i++
+		} else if args[i] == "--prefix" && i+1 < len(args) {
+			prefix = args[i+1]
+			prefixSet = true
+			i++
+		} else if args[i] == "--sync" {
+			sync = true
+		} else if args[i] == "--yes" || args[i] == "-y" {
+			yes = true
+		} else {
+			rest = append(rest, args[i])
+		}
+	}
+	if len(rest) > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy tick import [--from procfile|npm|make|justfile] [--prefix <prefix>] [--sync] [--yes] [path]")
+		os.Exit(1)
+	}
+	path := "."
+	if len(rest) == 1 {
+		path = rest[0]
+	}
+
+	src, err := tick.FindImportSource(path, format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	if prefixSet {
+		src.Prefix = prefix
+	}
+	src.Sync = sync
+	ticks, err := tick.ParseImport(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	plan := store.PlanImport(src, ticks)
+
+	fmt.Printf("Importing from %s (%s)\n", src.Path, src.Format)
+	for _, nt := range plan.Add {
+		fmt.Printf("  + %-20s %s\n", nt.Name, nt.Tick.Command)
+	}
+	for _, nt := range plan.Update {
+		fmt.Printf("  ~ %-20s %s\n", nt.Name, nt.Tick.Command)
+	}
+	for _, name := range plan.Remove {
+		fmt.Printf("  - %s\n", name)
+	}
+	for _, reason := range plan.Skip {
+		fmt.Printf("  skipped: %s\n", reason)
+	}
+
+	if plan.Empty() {
+		// Still record the file's state and whether to sync it
+		if err := store.ApplyImport(plan); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Ticks are up to date")
+		return
+	}
+	if !yes {
+		fmt.Printf("Apply these changes? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Nothing imported")
+			return
+		}
+	}
+	if err := store.ApplyImport(plan); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Imported ticks: %s\n", plan.Summary())
+	if sync {
+		fmt.Printf("They will be updated when %s changes\n", filepath.Base(src.Path))
+	}
+}
+
+func cmdRunTick(mgr task.Controller, store *tick.Store, name string, args []string) {
+	t, err := store.Get(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	warnShadowed(store, name)
+
+	opts, err := t.StartOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	command, err := t.Render(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: tick %q: %s\n", name, err)
+		os.Exit(1)
+	}
+	opts.Tick = name
+
+	taskID, err := mgr.StartTask(name, command, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	if source := store.Source(name); source != "" {
+		fmt.Printf("Started tick %q from %s as task %d: %s\n", name, tickSource(source), taskID, command)
+	} else {
+		fmt.Printf("Started tick %q as task %d: %s\n", name, taskID, command)
+	}
+	fmt.Printf("View logs: watchy logs %d\n", taskID)
+}
+
+// warnShadowed warns when a tick about to run comes from a project file
+// and hides the global tick of the same name
+func warnShadowed(store *tick.Store, name string) {
+	if store.Shadows(name) {
+		fmt.Fprintf(os.Stderr, "Warning: using tick %q from %s, which hides the global tick of the same name\n", name, tickSource(store.Source(name)))
+	}
+}
+
+func cmdStack(store *stack.Store, ticks *tick.Store, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  watchy stack add <stack> <tick> [--after <tick>[,<tick>...]] [--oneshot] [--wait-timeout <duration>]")
+		fmt.Fprintln(os.Stderr, "  watchy stack rm <stack> [<tick>]")
+		fmt.Fprintln(os.Stderr, "  watchy stack list")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "add":
+		cmdStackAdd(store, ticks, args[1:])
+	case "rm":
+		cmdStackRm(store, args[1:])
+	case "list":
+		cmdStackList(store)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown stack subcommand: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+func cmdStackAdd(store *stack.Store, ticks *tick.Store, args []string) {
+	var step stack.Step
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--after" && i+1 < len(args) {
+			for _, dep := range strings.Split(args[i+1], ",") {
+				if dep = strings.TrimSpace(dep); dep != "" {
+					step.DependsOn = append(step.DependsOn, dep)
+				}
+			}
+			i++
+		} else if args[i] == "--oneshot" {
+			step.OneShot = true
+		} else if args[i] == "--wait-timeout" && i+1 < len(args) {
+			step.WaitTimeout = parseDuration("--wait-timeout", args[i+1]).String()
+			i++
+		} else {
+			rest = append(rest, args[i])
+		}
+	}
+
+	if len(rest) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy stack add <stack> <tick> [--after <tick>[,<tick>...]] [--oneshot] [--wait-timeout <duration>]")
+		os.Exit(1)
+	}
+
+	name := rest[0]
+	step.Tick = rest[1]
+	if !ticks.Has(step.Tick) {
+		fmt.Fprintf(os.Stderr, "Error: tick %q not found\n", step.Tick)
+		os.Exit(1)
+	}
+
+	if err := store.AddStep(name, step); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Added tick %q to stack %q\n", step.Tick, name)
+}
+
+func cmdStackRm(store *stack.Store, args []string) {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy stack rm <stack> [<tick>]")
+		os.Exit(1)
+	}
+
+	if len(args) == 2 {
+		if err := store.RemoveStep(args[0], args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed tick %q from stack %q\n", args[1], args[0])
+		return
+	}
+
+	if err := store.Remove(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Removed stack %q\n", args[0])
+}
+
+func cmdStackList(store *stack.Store) {
+	stacks := store.List()
+	if len(stacks) == 0 {
+		fmt.Println("No stacks saved")
+		fmt.Println("Create one with: watchy stack add <stack> <tick>")
+		return
+	}
+
+	for i, s := range stacks {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(s.Name)
+		order, err := s.Stack.Order()
+		if err != nil {
+			fmt.Printf("  (invalid: %s)\n", err)
+			continue
+		}
+		for _, step := range order {
+			line := "  " + step.Tick
+			if step.OneShot {
+				line += " (oneshot)"
+			}
+			if len(step.DependsOn) > 0 {
+				line += " after " + strings.Join(step.DependsOn, ", ")
+			}
+			if step.WaitTimeout != "" {
+				line += " (wait " + step.WaitTimeout + ")"
+			}
+			fmt.Println(line)
+		}
+	}
+}
+
+func cmdUp(mgr task.Controller, store *stack.Store, ticks *tick.Store, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy up <stack>")
+		os.Exit(1)
+	}
+
+	st, err := store.Get(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	for _, step := range st.Steps {
+		warnShadowed(ticks, step.Tick)
+	}
+
+	err = stack.Up(mgr, ticks, args[0], st, func(msg string) {
+		fmt.Printf("  %s\n", msg)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Stack %q is up\n", args[0])
+}
+
+func cmdDown(mgr task.Controller, store *stack.Store, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: watchy down <stack>")
+		os.Exit(1)
+	}
+
+	st, err := store.Get(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	err = stack.Down(mgr, args[0], st, func(msg string) {
+		fmt.Printf("  %s\n", msg)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Stack %q is down\n", args[0])
+}
+
+// absPath resolves a path flag against the current directory, exiting with
+// an error if that fails
+func absPath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid path %s: %s\n", p, err)
+		os.Exit(1)
+	}
+	return abs
+}
+
+// parseDuration parses a duration flag value, exiting with an error if it's invalid
+func parseDuration(what, value string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid %s: %s (use e.g. 30s or 2m)\n", what, value)
+		os.Exit(1)
+	}
+	return d
 }
 
 func truncate(s string, max int) string {
@@ -2,40 +2,47 @@ package agent
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"runtime"
-	"time"
 
 	"github.com/ollama/ollama/api"
 	"github.com/parth/watchy/internal/task"
 )
 
 type Agent struct {
-	client      *api.Client
+	client      ChatClient
 	model       string
-	taskManager *task.Manager
+	taskManager task.Controller
+	sandbox     bool // run bash_command through SandboxCommand
+	policies    map[string]Policy
+	approver    Approver
 }
 
 // NewAgent creates a new Ollama agent with the given Ollama host URL
-func NewAgent(taskManager *task.Manager, ollamaHost string) (*Agent, error) {
+func NewAgent(taskManager task.Controller, ollamaHost string) (*Agent, error) {
 	client, err := createClient(ollamaHost)
 	if err != nil {
 		return nil, err
 	}
 
+	return NewAgentWithClient(taskManager, client), nil
+}
+
+// NewAgentWithClient creates an agent that talks to the model through
+// client, such as an agenttest.Client
+func NewAgentWithClient(taskManager task.Controller, client ChatClient) *Agent {
 	return &Agent{
 		client:      client,
 		model:       "glm-4.7:cloud",
 		taskManager: taskManager,
-	}, nil
+	}
 }
 
 // NewAgentWithModel creates a new Ollama agent with a specific model and host
-func NewAgentWithModel(taskManager *task.Manager, model string, ollamaHost string) (*Agent, error) {
+func NewAgentWithModel(taskManager task.Controller, model string, ollamaHost string) (*Agent, error) {
 	agent, err := NewAgent(taskManager, ollamaHost)
 	if err != nil {
 		return nil, err
@@ -73,11 +80,22 @@ type ToolResultEvent struct {
 	Result string
 }
 
+// ContentEvent is the next piece of the model's reply as it streams in
+type ContentEvent struct {
+	Content  string
+	Thinking string // reasoning, from models that think before answering
+}
+
 // SetModel changes the model used for inference
 func (a *Agent) SetModel(model string) {
 	a.model = model
 }
 
+// SetSandbox sets whether bash_command runs sandboxed
+func (a *Agent) SetSandbox(sandbox bool) {
+	a.sandbox = sandbox
+}
+
 // Model returns the current model name
 func (a *Agent) Model() string {
 	return a.model
@@ -86,37 +104,62 @@ func (a *Agent) Model() string {
 // Conversation holds persistent chat state
 type Conversation struct {
 	agent    *Agent
+	opts     RunOptions
 	messages []api.Message
+	session  int                // stored ChatSession ID; 0 until the first message is saved
+	task     int                // task the user is focused on; 0 for none
+	unsaved  []task.ChatMessage // messages added since the last save
+	saveErr  error
 }
 
 // NewConversation creates a new conversation with system prompt containing all tasks
 func (a *Agent) NewConversation() *Conversation {
-	c := &Conversation{agent: a}
+	return a.NewConversationWith(RunOptions{})
+}
+
+// NewConversationWith creates a new conversation whose agent loop is
+// configured by opts
+func (a *Agent) NewConversationWith(opts RunOptions) *Conversation {
+	c := &Conversation{agent: a, opts: opts}
 	c.buildSystemPrompt()
 	return c
 }
 
 func (c *Conversation) buildSystemPrompt() {
-	allTasks, err := c.agent.taskManager.ListTasks()
-	if err != nil {
-		c.messages = []api.Message{{
-			Role:    "system",
-			Content: "You are a helpful assistant analyzing logs for background tasks. (Failed to load task list.)",
-		}}
-		return
+	systemPrompt := "You are a helpful assistant analyzing logs for background tasks. (Failed to load task list.)"
+	if allTasks, err := c.agent.taskManager.ListTasks(); err == nil {
+		systemPrompt = c.opts.prompt()(allTasks, c.task)
+	}
+
+	if len(c.messages) > 0 {
+		c.messages[0] = api.Message{Role: "system", Content: systemPrompt}
+	} else {
+		c.messages = []api.Message{{Role: "system", Content: systemPrompt}}
 	}
+}
 
+// taskList lists tasks for a system prompt, marking the focused one
+func taskList(allTasks []*task.Task, focus int) string {
 	var tasksContext string
 	for _, t := range allTasks {
-		tasksContext += fmt.Sprintf("  - [%d] %s | cmd: %s | status: %s | pid: %d | log: %s\n",
-			t.ID, t.Name, t.Command, t.Status, t.PID, t.LogPath)
+		marker := ""
+		if t.ID == focus {
+			marker = " <-- FOCUSED"
+		}
+		tasksContext += fmt.Sprintf("  - [%d] %s | cmd: %s | status: %s | pid: %d | log: %s%s%s\n",
+			t.ID, t.Name, t.Command, t.Status, t.PID, t.LogPath, exitContext(t), marker)
 	}
+	return tasksContext
+}
 
+// chatPrompt is the system prompt of the TUI chat, where the agent operates
+// on the user's behalf
+func chatPrompt(allTasks []*task.Task, focus int) string {
 	cwd, _ := os.Getwd()
 	hostname, _ := os.Hostname()
 
-	systemPrompt := fmt.Sprintf(`You are a helpful assistant managing and analyzing background tasks.
-You have access to tools to read files, execute bash commands, get task info, start tasks, and stop tasks.
+	return fmt.Sprintf(`You are a helpful assistant managing and analyzing background tasks.
+You have access to tools to read files, execute bash commands, get task info and resource usage, start tasks, and stop tasks.
 
 Environment:
   hostname: %s
@@ -131,162 +174,24 @@ You are an operator. When the user asks you to do something, don't just answer -
 Approach:
 1. Figure out what's needed: read files, check running processes, inspect logs, look at the environment.
 2. Do the work: start services, run setup scripts, install dependencies, configure things.
-3. Verify it worked: check health endpoints, read logs for errors, confirm processes are running.
+3. Verify it worked: start servers with a ready probe and wait_ready, read logs for errors, confirm processes are running. A task's status is "starting" until its probe passes, then "ready", or "unhealthy" if the probe keeps failing.
 4. If something fails: read the logs, diagnose the issue, fix it, and retry. Keep going until it works or you've exhausted your options.
 
-Don't ask the user what to do -- investigate and act. Use bash_command to explore the system, read_file to check configs and logs, start_task to run things in the background, and stop_task to kill broken processes.
-
-Be concise. Show what you did and what happened, not what you could do.`, hostname, runtime.GOOS, runtime.GOARCH, cwd, os.Getenv("SHELL"), tasksContext)
-
-	if len(c.messages) > 0 {
-		c.messages[0] = api.Message{Role: "system", Content: systemPrompt}
-	} else {
-		c.messages = []api.Message{{Role: "system", Content: systemPrompt}}
-	}
-}
+Don't ask the user what to do -- investigate and act. Use bash_command to explore the system, read_file to check configs and logs, get_task_metrics for CPU and memory questions, get_tick_history for how a saved tick has been doing over time, start_task to run things in the background, and stop_task to kill broken processes.
 
-// RefreshSystemPrompt rebuilds the system prompt with current task state
-func (c *Conversation) RefreshSystemPrompt() {
-	c.buildSystemPrompt()
+Be concise. Show what you did and what happened, not what you could do.`, hostname, runtime.GOOS, runtime.GOARCH, cwd, os.Getenv("SHELL"), taskList(allTasks, focus))
 }
 
-// SendWithEvents sends a message and streams tool call events back via the callback.
-// The callback is called for each tool call. The final text response is returned.
-// Pass a cancellable context to support aborting mid-request.
-func (c *Conversation) SendWithEvents(ctx context.Context, message string, onToolStart func(ToolStartEvent), onToolResult func(ToolResultEvent)) (string, error) {
-	c.messages = append(c.messages, api.Message{
-		Role:    "user",
-		Content: message,
-	})
-
-	c.trimContext()
-
-	tools := GetTools()
-	maxIterations := 10
-
-	for i := 0; i < maxIterations; i++ {
-		if ctx.Err() != nil {
-			return "", ctx.Err()
-		}
-
-		stream := false
-		req := &api.ChatRequest{
-			Model:    c.agent.model,
-			Messages: c.messages,
-			Tools:    tools,
-			Stream:   &stream,
-		}
-
-		var lastMsg api.Message
-		err := c.agent.client.Chat(ctx, req, func(resp api.ChatResponse) error {
-			lastMsg = resp.Message
-			return nil
-		})
-		if err != nil {
-			return "", fmt.Errorf("chat request failed: %w", err)
-		}
-
-		c.messages = append(c.messages, lastMsg)
-
-		if len(lastMsg.ToolCalls) == 0 {
-			return lastMsg.Content, nil
-		}
-
-		for _, toolCall := range lastMsg.ToolCalls {
-			if ctx.Err() != nil {
-				return "", ctx.Err()
-			}
-
-			argsBytes, _ := json.Marshal(toolCall.Function.Arguments)
-			argsStr := string(argsBytes)
-
-			if onToolStart != nil {
-				onToolStart(ToolStartEvent{
-					Tool: toolCall.Function.Name,
-					Args: argsStr,
-				})
-			}
-
-			result, err := c.agent.ExecuteTool(toolCall)
-			if err != nil {
-				result = fmt.Sprintf("Error executing tool: %s", err)
-			}
-
-			if onToolResult != nil {
-				onToolResult(ToolResultEvent{
-					Tool:   toolCall.Function.Name,
-					Result: result,
-				})
-			}
-
-			c.messages = append(c.messages, api.Message{
-				Role:    "tool",
-				Content: result,
-			})
-		}
-	}
-
-	return "", fmt.Errorf("agent exceeded maximum iterations")
-}
-
-// Send is a simple wrapper without events (used by CLI ask)
-func (c *Conversation) Send(message string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	return c.SendWithEvents(ctx, message, nil, nil)
-}
-
-// trimContext drops middle messages if estimated tokens exceed 16K
-func (c *Conversation) trimContext() {
-	const maxTokens = 16000
-	const charsPerToken = 4
-
-	totalChars := 0
-	for _, m := range c.messages {
-		totalChars += len(m.Content)
-	}
-
-	if totalChars/charsPerToken <= maxTokens {
-		return
-	}
-
-	if len(c.messages) <= 21 {
-		return
-	}
-
-	keep := make([]api.Message, 0, 21)
-	keep = append(keep, c.messages[0])
-	keep = append(keep, c.messages[1:5]...)
-	keep = append(keep, c.messages[len(c.messages)-16:]...)
-	c.messages = keep
-}
-
-// Ask is a convenience method for single-shot questions (used by CLI)
-func (a *Agent) Ask(taskID int, question string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	focusedTask, err := a.taskManager.GetTask(taskID)
-	if err != nil {
-		return "", fmt.Errorf("failed to get task: %w", err)
-	}
-
-	allTasks, err := a.taskManager.ListTasks()
-	if err != nil {
-		return "", fmt.Errorf("failed to list tasks: %w", err)
-	}
-
-	var tasksContext string
+// askPrompt is the system prompt of watchy ask, a question about one task
+func askPrompt(allTasks []*task.Task, focus int) string {
+	name := ""
 	for _, t := range allTasks {
-		marker := ""
-		if t.ID == taskID {
-			marker = " <-- FOCUSED"
+		if t.ID == focus {
+			name = t.Name
 		}
-		tasksContext += fmt.Sprintf("  - [%d] %s | cmd: %s | status: %s | pid: %d | log: %s%s\n",
-			t.ID, t.Name, t.Command, t.Status, t.PID, t.LogPath, marker)
 	}
 
-	systemPrompt := fmt.Sprintf(`You are a helpful assistant analyzing logs for background tasks.
+	return fmt.Sprintf(`You are a helpful assistant analyzing logs for background tasks.
 You have access to tools to read files, execute bash commands, and get task information.
 
 All tasks:
@@ -297,51 +202,51 @@ When the user asks questions, use your tools to investigate the logs and provide
 You can use the read_file tool to read log files directly, or bash_command to run grep/tail/etc.
 
 Be concise and helpful in your responses.`,
-		tasksContext, focusedTask.ID, focusedTask.Name)
+		taskList(allTasks, focus), focus, name)
+}
 
-	messages := []api.Message{
-		{Role: "system", Content: systemPrompt},
-		{Role: "user", Content: question},
+// exitContext formats how a finished task ended for the system prompt
+func exitContext(t *task.Task) string {
+	if t.TerminationReason == "" {
+		return ""
 	}
+	if exit := t.ExitSummary(); exit != "" {
+		return fmt.Sprintf(" | ended: %s (%s)", exit, t.TerminationReason)
+	}
+	return fmt.Sprintf(" | ended: %s", t.TerminationReason)
+}
 
-	tools := GetTools()
-	maxIterations := 10
-
-	for i := 0; i < maxIterations; i++ {
-		stream := false
-		req := &api.ChatRequest{
-			Model:    a.model,
-			Messages: messages,
-			Tools:    tools,
-			Stream:   &stream,
-		}
+// RefreshSystemPrompt rebuilds the system prompt with current task state
+func (c *Conversation) RefreshSystemPrompt() {
+	c.buildSystemPrompt()
+}
 
-		var lastMsg api.Message
-		err := a.client.Chat(ctx, req, func(resp api.ChatResponse) error {
-			lastMsg = resp.Message
-			return nil
-		})
-		if err != nil {
-			return "", fmt.Errorf("chat request failed: %w", err)
-		}
+// Ask is a convenience method for single-shot questions about a task (used
+// by CLI). It runs the same loop as a Conversation, with a prompt focused on
+// the task, and isn't saved as a chat session. The reply streams to
+// onContent, if not nil, as it arrives.
+func (a *Agent) Ask(taskID int, question string, onContent func(ContentEvent)) (string, error) {
+	if _, err := a.taskManager.GetTask(taskID); err != nil {
+		return "", fmt.Errorf("failed to get task: %w", err)
+	}
 
-		messages = append(messages, lastMsg)
+	c := &Conversation{agent: a, task: taskID, opts: RunOptions{Prompt: askPrompt, Ephemeral: true}}
+	c.buildSystemPrompt()
 
-		if len(lastMsg.ToolCalls) == 0 {
-			return lastMsg.Content, nil
+	var events Events
+	if onContent != nil {
+		wrote := false
+		events.Content = func(evt ContentEvent) {
+			wrote = wrote || evt.Content != ""
+			onContent(evt)
 		}
-
-		for _, toolCall := range lastMsg.ToolCalls {
-			result, err := a.ExecuteTool(toolCall)
-			if err != nil {
-				result = fmt.Sprintf("Error executing tool: %s", err)
+		events.ToolStart = func(ToolStartEvent) {
+			// Text before tool calls is its own paragraph
+			if wrote {
+				onContent(ContentEvent{Content: "\n\n"})
+				wrote = false
 			}
-			messages = append(messages, api.Message{
-				Role:    "tool",
-				Content: result,
-			})
 		}
 	}
-
-	return "", fmt.Errorf("agent exceeded maximum iterations")
+	return c.Run(context.Background(), question, events)
 }
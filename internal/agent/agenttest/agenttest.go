@@ -0,0 +1,141 @@
+// Package agenttest runs the agent loop offline, against scripted model
+// replies instead of Ollama
+package agenttest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/parth/watchy/internal/agent"
+)
+
+// Reply is the scripted model response to one chat request
+type Reply struct {
+	Thinking  string
+	Content   string
+	ToolCalls []api.ToolCall
+	Err       error         // fail the request instead of replying
+	Pause     time.Duration // wait this long before streaming each chunk
+}
+
+// Text replies with content
+func Text(content string) Reply {
+	return Reply{Content: content}
+}
+
+// Call replies by calling one tool
+func Call(tool string, args map[string]any) Reply {
+	return Reply{ToolCalls: []api.ToolCall{ToolCall(tool, args)}}
+}
+
+// Fail fails the request with err
+func Fail(err error) Reply {
+	return Reply{Err: err}
+}
+
+// ToolCall builds a tool call, with args in sorted order
+func ToolCall(tool string, args map[string]any) api.ToolCall {
+	call := api.ToolCall{Function: api.ToolCallFunction{
+		Name:      tool,
+		Arguments: api.NewToolCallFunctionArguments(),
+	}}
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		call.Function.Arguments.Set(k, args[k])
+	}
+	return call
+}
+
+// Client is an agent.ChatClient that answers each request with the next
+// scripted Reply, streamed a word at a time like a real model, and records
+// the requests it gets. It is safe for concurrent use.
+type Client struct {
+	mu       sync.Mutex
+	replies  []Reply
+	requests []api.ChatRequest
+}
+
+var _ agent.ChatClient = (*Client)(nil)
+
+// NewClient creates a Client that gives replies in order
+func NewClient(replies ...Reply) *Client {
+	return &Client{replies: replies}
+}
+
+// Chat answers req with the next scripted reply. It fails once the script
+// runs out.
+func (c *Client) Chat(ctx context.Context, req *api.ChatRequest, fn api.ChatResponseFunc) error {
+	c.mu.Lock()
+	recorded := *req
+	recorded.Messages = slices.Clone(req.Messages)
+	c.requests = append(c.requests, recorded)
+	if len(c.replies) == 0 {
+		c.mu.Unlock()
+		return fmt.Errorf("agenttest: no reply scripted for request %d", len(c.requests))
+	}
+	reply := c.replies[0]
+	c.replies = c.replies[1:]
+	c.mu.Unlock()
+
+	if reply.Err != nil {
+		return reply.Err
+	}
+
+	var chunks []api.Message
+	for _, word := range splitWords(reply.Thinking) {
+		chunks = append(chunks, api.Message{Role: "assistant", Thinking: word})
+	}
+	for _, word := range splitWords(reply.Content) {
+		chunks = append(chunks, api.Message{Role: "assistant", Content: word})
+	}
+	if len(reply.ToolCalls) > 0 {
+		chunks = append(chunks, api.Message{Role: "assistant", ToolCalls: reply.ToolCalls})
+	}
+	for _, msg := range chunks {
+		if reply.Pause > 0 {
+			select {
+			case <-time.After(reply.Pause):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(api.ChatResponse{Model: req.Model, Message: msg}); err != nil {
+			return err
+		}
+	}
+	return fn(api.ChatResponse{Model: req.Model, Message: api.Message{Role: "assistant"}, Done: true})
+}
+
+// Requests returns the requests Chat has received, oldest first
+func (c *Client) Requests() []api.ChatRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.requests)
+}
+
+// Remaining returns how many scripted replies haven't been used
+func (c *Client) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.replies)
+}
+
+// splitWords splits s after each space, so the pieces join back into s
+func splitWords(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.SplitAfter(s, " ")
+}
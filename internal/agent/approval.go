@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Policy says whether the agent may call a tool without asking
+type Policy string
+
+const (
+	PolicyAuto Policy = "auto" // run the call
+	PolicyAsk  Policy = "ask"  // ask the user first
+	PolicyDeny Policy = "deny" // refuse the call
+)
+
+// defaultPolicies apply to tools that tool_approval doesn't mention. Tools
+// that change things ask first; the rest only read.
+var defaultPolicies = map[string]Policy{
+	"start_task": PolicyAsk,
+	"stop_task":  PolicyAsk,
+}
+
+// ParsePolicies checks a tool_approval config, which maps tool names to
+// "auto", "ask" or "deny"
+func ParsePolicies(config map[string]string) (map[string]Policy, error) {
+	known := make(map[string]bool)
+	for _, t := range GetTools() {
+		known[t.Function.Name] = true
+	}
+	policies := make(map[string]Policy, len(config))
+	for tool, s := range config {
+		if !known[tool] {
+			return nil, fmt.Errorf("unknown tool %q", tool)
+		}
+		switch p := Policy(s); p {
+		case PolicyAuto, PolicyAsk, PolicyDeny:
+			policies[tool] = p
+		default:
+			return nil, fmt.Errorf("invalid policy %q for %s (use auto, ask or deny)", s, tool)
+		}
+	}
+	return policies, nil
+}
+
+// Decision is the user's answer to an ApprovalRequest
+type Decision int
+
+const (
+	Deny          Decision = iota
+	Approve                // run this call
+	ApproveAlways          // run this and later calls of the tool without asking
+)
+
+// ApprovalRequest is a tool call waiting for the user's approval
+type ApprovalRequest struct {
+	Tool string
+	Args string
+}
+
+// Approver asks the user whether a tool call may run. It blocks until they
+// answer or ctx is done.
+type Approver func(ctx context.Context, req ApprovalRequest) (Decision, error)
+
+// SetPolicies sets the approval policy of each tool, on top of the defaults
+func (a *Agent) SetPolicies(policies map[string]Policy) {
+	a.policies = policies
+}
+
+// SetApprover sets who is asked about tool calls whose policy is "ask".
+// Without one, those calls are refused.
+func (a *Agent) SetApprover(approver Approver) {
+	a.approver = approver
+}
+
+// Policy returns the approval policy of a tool
+func (a *Agent) Policy(tool string) Policy {
+	if p, ok := a.policies[tool]; ok {
+		return p
+	}
+	if p, ok := defaultPolicies[tool]; ok {
+		return p
+	}
+	return PolicyAuto
+}
+
+// refusal is returned to the model in place of the result of a tool call
+// that wasn't allowed to run
+type refusal struct {
+	Refused bool   `json:"refused"`
+	Tool    string `json:"tool"`
+	Reason  string `json:"reason"`
+	Hint    string `json:"hint"`
+}
+
+func refuse(tool, reason string) string {
+	data, _ := json.Marshal(refusal{
+		Refused: true,
+		Tool:    tool,
+		Reason:  reason,
+		Hint:    "The call did not run. Don't retry it unchanged; explain what you wanted to do, or try another way.",
+	})
+	return string(data)
+}
+
+// runTool executes a tool call if its policy allows, asking the user when
+// needed, and otherwise returns a refusal for the model
+func (a *Agent) runTool(ctx context.Context, toolCall api.ToolCall, args string) (string, error) {
+	tool := toolCall.Function.Name
+	switch a.Policy(tool) {
+	case PolicyDeny:
+		return refuse(tool, fmt.Sprintf("tool_approval in the watchy config denies %s", tool)), nil
+	case PolicyAsk:
+		if a.approver == nil {
+			return refuse(tool, fmt.Sprintf("%s needs the user's approval, and there is no one to ask", tool)), nil
+		}
+		decision, err := a.approver(ctx, ApprovalRequest{Tool: tool, Args: args})
+		if err != nil {
+			return "", err
+		}
+		switch decision {
+		case Deny:
+			return refuse(tool, "the user denied this call"), nil
+		case ApproveAlways:
+			if a.policies == nil {
+				a.policies = make(map[string]Policy)
+			}
+			a.policies[tool] = PolicyAuto
+		}
+	}
+	return a.ExecuteTool(toolCall)
+}
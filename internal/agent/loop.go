@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/parth/watchy/internal/task"
+)
+
+// ChatClient sends chat requests to a model. *api.Client is the real one;
+// agenttest.Client replays scripted replies, so the agent loop can run
+// offline.
+type ChatClient interface {
+	Chat(ctx context.Context, req *api.ChatRequest, fn api.ChatResponseFunc) error
+}
+
+const (
+	defaultMaxIterations = 10
+	defaultIdleTimeout   = 30 * time.Second
+)
+
+// errModelIdle fails a model request that stops streaming for longer than
+// its idle timeout
+var errModelIdle = errors.New("model stopped responding")
+
+// PromptBuilder builds a conversation's system prompt from the current tasks
+// and the task the user is focused on (0 for none)
+type PromptBuilder func(tasks []*task.Task, focus int) string
+
+// RunOptions configures the agent loop of a Conversation. The zero value is
+// what the TUI chat uses.
+type RunOptions struct {
+	Prompt        PromptBuilder // nil for the chat prompt
+	Tools         []api.Tool    // tools the model may call; nil for GetTools()
+	MaxIterations int           // model requests per message; 0 for 10
+	IdleTimeout   time.Duration // how long a model request may go without streaming anything; 0 for 30s
+	Ephemeral     bool          // don't save the conversation as a chat session
+}
+
+func (o RunOptions) prompt() PromptBuilder {
+	if o.Prompt == nil {
+		return chatPrompt
+	}
+	return o.Prompt
+}
+
+func (o RunOptions) tools() []api.Tool {
+	if o.Tools == nil {
+		return GetTools()
+	}
+	return o.Tools
+}
+
+func (o RunOptions) maxIterations() int {
+	if o.MaxIterations <= 0 {
+		return defaultMaxIterations
+	}
+	return o.MaxIterations
+}
+
+func (o RunOptions) idleTimeout() time.Duration {
+	if o.IdleTimeout <= 0 {
+		return defaultIdleTimeout
+	}
+	return o.IdleTimeout
+}
+
+// Events receives a run's progress as it happens. Nil fields are skipped.
+type Events struct {
+	Content    func(ContentEvent) // each piece of the reply (and thinking), across every turn
+	ToolStart  func(ToolStartEvent)
+	ToolResult func(ToolResultEvent)
+}
+
+// Run sends a message and runs the agent loop: each reply's tool calls are
+// run and their results sent back, until the model answers without calling
+// a tool. The final text response is returned. Cancel ctx to abort
+// mid-request.
+func (c *Conversation) Run(ctx context.Context, message string, events Events) (string, error) {
+	defer c.save(message)
+
+	c.add(api.Message{
+		Role:    "user",
+		Content: message,
+	})
+
+	c.trimContext()
+
+	tools := c.opts.tools()
+	offered := make(map[string]bool, len(tools))
+	for _, t := range tools {
+		offered[t.Function.Name] = true
+	}
+
+	for i := 0; i < c.opts.maxIterations(); i++ {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		lastMsg, err := c.agent.chat(ctx, c.messages, tools, c.opts.idleTimeout(), events.Content)
+		if err != nil {
+			return "", err
+		}
+
+		c.add(lastMsg)
+
+		if len(lastMsg.ToolCalls) == 0 {
+			return lastMsg.Content, nil
+		}
+
+		for _, toolCall := range lastMsg.ToolCalls {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+
+			name := toolCall.Function.Name
+			argsBytes, _ := json.Marshal(toolCall.Function.Arguments)
+			argsStr := string(argsBytes)
+
+			if events.ToolStart != nil {
+				events.ToolStart(ToolStartEvent{Tool: name, Args: argsStr})
+			}
+
+			var result string
+			if !offered[name] {
+				result = refuse(name, fmt.Sprintf("%s isn't one of the tools in this conversation", name))
+			} else if result, err = c.agent.runTool(ctx, toolCall, argsStr); err != nil {
+				result = fmt.Sprintf("Error executing tool: %s", err)
+			}
+
+			if events.ToolResult != nil {
+				events.ToolResult(ToolResultEvent{Tool: name, Result: result})
+			}
+
+			c.add(api.Message{
+				Role:     "tool",
+				Content:  result,
+				ToolName: name,
+			})
+		}
+	}
+
+	return "", fmt.Errorf("agent exceeded maximum iterations")
+}
+
+// Send runs a message without events
+func (c *Conversation) Send(message string) (string, error) {
+	return c.Run(context.Background(), message, Events{})
+}
+
+// chat sends one request with the given tools, streaming the reply to
+// onContent, and returns the whole message. The request is aborted if the
+// model goes idle for longer than idle, before the first chunk or between
+// two; a long reply that keeps streaming is never cut off.
+func (a *Agent) chat(ctx context.Context, messages []api.Message, tools []api.Tool, idle time.Duration, onContent func(ContentEvent)) (api.Message, error) {
+	stream := true
+	req := &api.ChatRequest{
+		Model:    a.model,
+		Messages: messages,
+		Tools:    tools,
+		Stream:   &stream,
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	timer := time.AfterFunc(idle, func() {
+		cancel(fmt.Errorf("%w for %s", errModelIdle, idle))
+	})
+	defer timer.Stop()
+
+	msg := api.Message{Role: "assistant"}
+	var content, thinking strings.Builder
+	err := a.client.Chat(ctx, req, func(resp api.ChatResponse) error {
+		timer.Reset(idle)
+		content.WriteString(resp.Message.Content)
+		thinking.WriteString(resp.Message.Thinking)
+		msg.ToolCalls = append(msg.ToolCalls, resp.Message.ToolCalls...)
+		if onContent != nil && (resp.Message.Content != "" || resp.Message.Thinking != "") {
+			onContent(ContentEvent{Content: resp.Message.Content, Thinking: resp.Message.Thinking})
+		}
+		return nil
+	})
+	if err != nil {
+		if cause := context.Cause(ctx); errors.Is(cause, errModelIdle) {
+			err = cause
+		}
+		return msg, fmt.Errorf("chat request failed: %w", err)
+	}
+	msg.Content = content.String()
+	msg.Thinking = thinking.String()
+	return msg, nil
+}
+
+// trimContext drops middle messages if estimated tokens exceed 16K
+func (c *Conversation) trimContext() {
+	const maxTokens = 16000
+	const charsPerToken = 4
+
+	totalChars := 0
+	for _, m := range c.messages {
+		totalChars += len(m.Content)
+	}
+
+	if totalChars/charsPerToken <= maxTokens {
+		return
+	}
+
+	if len(c.messages) <= 21 {
+		return
+	}
+
+	keep := make([]api.Message, 0, 21)
+	keep = append(keep, c.messages[0])
+	keep = append(keep, c.messages[1:5]...)
+	keep = append(keep, c.messages[len(c.messages)-16:]...)
+	c.messages = keep
+}
@@ -0,0 +1,323 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/parth/watchy/internal/agent"
+	"github.com/parth/watchy/internal/agent/agenttest"
+	"github.com/parth/watchy/internal/task"
+)
+
+// newAgent creates an agent backed by client and a task manager with an
+// empty database
+func newAgent(t *testing.T, client *agenttest.Client) (*agent.Agent, *task.Manager) {
+	t.Helper()
+	dir := t.TempDir()
+	storage, err := task.NewStorage(filepath.Join(dir, "watchy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	mgr := task.NewManager(storage, filepath.Join(dir, "logs"))
+	return agent.NewAgentWithClient(mgr, client), mgr
+}
+
+// toolResults returns the contents of the tool messages in msgs
+func toolResults(msgs []api.Message) []string {
+	var results []string
+	for _, m := range msgs {
+		if m.Role == "tool" {
+			results = append(results, m.Content)
+		}
+	}
+	return results
+}
+
+func TestRunToolLoop(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(file, []byte("ok\nERROR disk full\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := agenttest.NewClient(
+		agenttest.Reply{Thinking: "Let me look.", ToolCalls: []api.ToolCall{
+			agenttest.ToolCall("read_file", map[string]any{"path": file}),
+		}},
+		agenttest.Call("bash_command", map[string]any{"command": "grep -c ERROR " + file}),
+		agenttest.Text("The disk is full."),
+	)
+	a, _ := newAgent(t, client)
+	conv := a.NewConversationWith(agent.RunOptions{Ephemeral: true})
+
+	var content, thinking strings.Builder
+	var started, finished []string
+	reply, err := conv.Run(context.Background(), "Why did it fail?", agent.Events{
+		Content: func(e agent.ContentEvent) {
+			content.WriteString(e.Content)
+			thinking.WriteString(e.Thinking)
+		},
+		ToolStart:  func(e agent.ToolStartEvent) { started = append(started, e.Tool) },
+		ToolResult: func(e agent.ToolResultEvent) { finished = append(finished, e.Tool) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "The disk is full." || content.String() != reply || thinking.String() != "Let me look." {
+		t.Errorf("reply = %q, streamed %q, thinking %q", reply, content.String(), thinking.String())
+	}
+	if want := "read_file bash_command"; strings.Join(started, " ") != want || strings.Join(finished, " ") != want {
+		t.Errorf("tools started %v, finished %v, want %s", started, finished, want)
+	}
+
+	reqs := client.Requests()
+	if len(reqs) != 3 {
+		t.Fatalf("got %d requests, want 3", len(reqs))
+	}
+	results := toolResults(reqs[2].Messages)
+	if len(results) != 2 || !strings.Contains(results[0], "ERROR disk full") || strings.TrimSpace(results[1]) != "1" {
+		t.Errorf("tool results sent back = %q", results)
+	}
+	if got := reqs[0].Messages[0].Role; got != "system" {
+		t.Errorf("first message role = %q, want system", got)
+	}
+}
+
+func TestRunMaxIterations(t *testing.T) {
+	call := agenttest.Call("bash_command", map[string]any{"command": "uptime"})
+	client := agenttest.NewClient(call, call, call)
+	a, _ := newAgent(t, client)
+	conv := a.NewConversationWith(agent.RunOptions{MaxIterations: 2, Ephemeral: true})
+
+	_, err := conv.Send("loop forever")
+	if err == nil || !strings.Contains(err.Error(), "maximum iterations") {
+		t.Errorf("Send() error = %v, want maximum iterations", err)
+	}
+	if n := len(client.Requests()); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+	if n := client.Remaining(); n != 1 {
+		t.Errorf("%d replies left, want 1", n)
+	}
+}
+
+func TestRunClientError(t *testing.T) {
+	boom := errors.New("connection refused")
+	client := agenttest.NewClient(agenttest.Fail(boom))
+	a, mgr := newAgent(t, client)
+	conv := a.NewConversation()
+
+	if _, err := conv.Send("hello"); !errors.Is(err, boom) {
+		t.Errorf("Send() error = %v, want %v", err, boom)
+	}
+
+	// The question is kept, so the session can be retried from the history
+	sessions, err := mgr.ListChatSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Title != "hello" {
+		t.Fatalf("sessions = %+v, want one titled hello", sessions)
+	}
+}
+
+func TestRunApprovalDenied(t *testing.T) {
+	client := agenttest.NewClient(
+		agenttest.Call("stop_task", map[string]any{"task_id": 1}),
+		agenttest.Text("Okay, I won't."),
+	)
+	a, _ := newAgent(t, client)
+	var asked []agent.ApprovalRequest
+	a.SetApprover(func(ctx context.Context, req agent.ApprovalRequest) (agent.Decision, error) {
+		asked = append(asked, req)
+		return agent.Deny, nil
+	})
+	conv := a.NewConversationWith(agent.RunOptions{Ephemeral: true})
+
+	reply, err := conv.Send("stop task 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "Okay, I won't." {
+		t.Errorf("reply = %q", reply)
+	}
+	if len(asked) != 1 || asked[0].Tool != "stop_task" || asked[0].Args != `{"task_id":1}` {
+		t.Errorf("approver asked %+v", asked)
+	}
+	results := toolResults(client.Requests()[1].Messages)
+	if len(results) != 1 || !strings.Contains(results[0], `"refused":true`) || !strings.Contains(results[0], "the user denied this call") {
+		t.Errorf("tool results sent back = %q", results)
+	}
+}
+
+func TestRunToolNotOffered(t *testing.T) {
+	client := agenttest.NewClient(
+		agenttest.Call("stop_task", map[string]any{"task_id": 1}),
+		agenttest.Text("Can't."),
+	)
+	a, _ := newAgent(t, client)
+	a.SetApprover(func(ctx context.Context, req agent.ApprovalRequest) (agent.Decision, error) {
+		t.Errorf("asked to approve %s, which wasn't offered", req.Tool)
+		return agent.Approve, nil
+	})
+	var readOnly []api.Tool
+	for _, tool := range agent.GetTools() {
+		if tool.Function.Name == "read_file" {
+			readOnly = append(readOnly, tool)
+		}
+	}
+	conv := a.NewConversationWith(agent.RunOptions{Tools: readOnly, Ephemeral: true})
+
+	if _, err := conv.Send("stop task 1"); err != nil {
+		t.Fatal(err)
+	}
+	reqs := client.Requests()
+	if len(reqs[0].Tools) != 1 {
+		t.Errorf("offered %d tools, want 1", len(reqs[0].Tools))
+	}
+	results := toolResults(reqs[1].Messages)
+	if len(results) != 1 || !strings.Contains(results[0], "isn't one of the tools") {
+		t.Errorf("tool results sent back = %q", results)
+	}
+}
+
+func TestRunCanceledWhileStreaming(t *testing.T) {
+	client := agenttest.NewClient(agenttest.Text("a long answer that gets cut off"))
+	a, _ := newAgent(t, client)
+	conv := a.NewConversationWith(agent.RunOptions{Ephemeral: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var streamed string
+	_, err := conv.Run(ctx, "explain", agent.Events{
+		Content: func(e agent.ContentEvent) {
+			streamed += e.Content
+			cancel()
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want context.Canceled", err)
+	}
+	if streamed != "a " {
+		t.Errorf("streamed %q after cancel, want only the first chunk", streamed)
+	}
+}
+
+func TestRunCanceledWhileApproving(t *testing.T) {
+	client := agenttest.NewClient(
+		agenttest.Call("stop_task", map[string]any{"task_id": 1}),
+		agenttest.Text("unused"),
+	)
+	a, _ := newAgent(t, client)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a.SetApprover(func(ctx context.Context, req agent.ApprovalRequest) (agent.Decision, error) {
+		cancel()
+		<-ctx.Done()
+		return agent.Deny, ctx.Err()
+	})
+	conv := a.NewConversationWith(agent.RunOptions{Ephemeral: true})
+
+	if _, err := conv.Run(ctx, "stop task 1", agent.Events{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want context.Canceled", err)
+	}
+	if n := client.Remaining(); n != 1 {
+		t.Errorf("%d replies left, want 1: the loop went on after cancel", n)
+	}
+}
+
+func TestRunIdleTimeout(t *testing.T) {
+	// Each chunk arrives within the idle timeout, though the whole reply
+	// takes several times longer
+	slow := agenttest.Reply{Content: "one two three four five six", Pause: 20 * time.Millisecond}
+	stalled := agenttest.Reply{Content: "never", Pause: time.Second}
+	client := agenttest.NewClient(slow, stalled)
+	a, _ := newAgent(t, client)
+	conv := a.NewConversationWith(agent.RunOptions{IdleTimeout: 60 * time.Millisecond, Ephemeral: true})
+
+	reply, err := conv.Send("slow")
+	if err != nil || reply != slow.Content {
+		t.Errorf("Send() = %q, %v, want the whole slow reply", reply, err)
+	}
+
+	start := time.Now()
+	_, err = conv.Send("stalled")
+	if err == nil || !strings.Contains(err.Error(), "stopped responding") {
+		t.Errorf("Send() error = %v, want the model to time out", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("stalled request took %s to time out", elapsed)
+	}
+}
+
+func TestRunSavesSession(t *testing.T) {
+	client := agenttest.NewClient(
+		agenttest.Call("bash_command", map[string]any{"command": "uptime"}),
+		agenttest.Text("All good."),
+		agenttest.Text("Still good."),
+	)
+	a, mgr := newAgent(t, client)
+	conv := a.NewConversation()
+
+	for _, q := range []string{"How is the machine?", "And now?"} {
+		if _, err := conv.Send(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if conv.SaveErr() != nil {
+		t.Fatal(conv.SaveErr())
+	}
+
+	cs, err := mgr.GetChatSession(conv.Session())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roles []string
+	for _, m := range cs.Messages {
+		roles = append(roles, m.Role)
+	}
+	if want := "user assistant tool assistant user assistant"; strings.Join(roles, " ") != want {
+		t.Errorf("saved roles = %v, want %s", roles, want)
+	}
+	if cs.Title != "How is the machine?" {
+		t.Errorf("title = %q", cs.Title)
+	}
+
+	// A resumed conversation picks up where it left off
+	resumed, err := a.ResumeConversation(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Session() != conv.Session() {
+		t.Errorf("resumed session %d, want %d", resumed.Session(), conv.Session())
+	}
+}
+
+func TestRunEphemeral(t *testing.T) {
+	client := agenttest.NewClient(
+		agenttest.Call("bash_command", map[string]any{"command": "uptime"}),
+		agenttest.Text("All good."),
+	)
+	a, mgr := newAgent(t, client)
+	conv := a.NewConversationWith(agent.RunOptions{Ephemeral: true})
+
+	if _, err := conv.Send("How is the machine?"); err != nil {
+		t.Fatal(err)
+	}
+	if conv.Session() != 0 {
+		t.Errorf("ephemeral conversation saved as session %d", conv.Session())
+	}
+	sessions, err := mgr.ListChatSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("ephemeral conversation saved %d sessions", len(sessions))
+	}
+}
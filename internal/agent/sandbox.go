@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// SandboxCommand is the hidden watchy subcommand that runs RunSandboxed.
+// With agent_sandbox set, bash_command runs through it in new user, mount
+// and network namespaces.
+const SandboxCommand = "__sandbox"
+
+// bashTimeout bounds how long a bash_command may run, so commands like
+// tail -f or ping without -c can't hang the agent
+const bashTimeout = 30 * time.Second
+
+// shellCommand returns the command that runs a checked bash_command,
+// sandboxed if the agent is configured to be. The whole process group is
+// killed when ctx is done.
+func (a *Agent) shellCommand(ctx context.Context, command string) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	if a.sandbox {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("the sandbox needs the watchy binary: %w", err)
+		}
+		uid, gid := os.Getuid(), os.Getgid()
+		cmd = exec.CommandContext(ctx, exe, SandboxCommand, strconv.Itoa(uid), strconv.Itoa(gid), "bash", "-c", command)
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET,
+			UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: uid, Size: 1}},
+			GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: gid, Size: 1}},
+		}
+	} else {
+		cmd = exec.CommandContext(ctx, "bash", "-c", command)
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	return cmd, nil
+}
+
+// RunSandboxed implements SandboxCommand. It runs as root of a new user
+// namespace, with its own mount and network namespaces: it makes every
+// mount read-only, then runs the rest of args as the caller's uid (args[0])
+// and gid (args[1]) in a nested user namespace, which leaves the command
+// without the capabilities to remount anything. It returns the command's
+// exit status. The new network namespace has no interfaces up, so nothing
+// can be reached.
+func RunSandboxed(args []string) (int, error) {
+	if len(args) < 3 {
+		return 0, fmt.Errorf("usage: watchy %s <uid> <gid> <command>...", SandboxCommand)
+	}
+	uid, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid uid %q", args[0])
+	}
+	gid, err := strconv.Atoi(args[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid gid %q", args[1])
+	}
+
+	// Refuse to touch the mounts of the initial namespaces, whose uid map
+	// covers every uid
+	uidMap, err := os.ReadFile("/proc/self/uid_map")
+	if err != nil {
+		return 0, err
+	}
+	if f := strings.Fields(string(uidMap)); len(f) != 3 || f[2] != "1" {
+		return 0, fmt.Errorf("not started in a new user namespace")
+	}
+
+	// Keep the changes below out of the parent mount namespace
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return 0, fmt.Errorf("failed to make mounts private: %w", err)
+	}
+	if err := unix.MountSetattr(-1, "/", unix.AT_RECURSIVE, &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}); err != nil {
+		return 0, fmt.Errorf("failed to make mounts read-only: %w", err)
+	}
+	// The id maps of the nested namespace are written through /proc
+	if err := unix.MountSetattr(-1, "/proc", 0, &unix.MountAttr{Attr_clr: unix.MOUNT_ATTR_RDONLY}); err != nil {
+		return 0, fmt.Errorf("failed to reopen /proc: %w", err)
+	}
+
+	// A running Go program can't unshare its user namespace, so the
+	// command runs as a child in a nested one
+	cmd := exec.Command(args[2], args[3:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: uid, HostID: 0, Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: gid, HostID: 0, Size: 1}},
+	}
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
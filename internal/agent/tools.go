@@ -1,13 +1,16 @@
 package agent
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
-	"os/exec"
-	"strings"
+	"sort"
+	"time"
 
 	"github.com/ollama/ollama/api"
+	"github.com/parth/watchy/internal/task"
 )
 
 func newProps(props map[string]api.ToolProperty) *api.ToolPropertiesMap {
@@ -42,7 +45,7 @@ func GetTools() []api.Tool {
 			Type: "function",
 			Function: api.ToolFunction{
 				Name:        "bash_command",
-				Description: "Execute a read-only bash command. Allowed: grep, tail, head, awk, sed, wc, cat, sort, uniq, cut, ls, find, ps, lsof, netstat, ss, df, du, free, uptime, whoami, hostname, uname, env, printenv, which, file, stat, id, curl, dig, ping, psql, cd, pkill. Pipes are supported.",
+				Description: "Execute a read-only bash command. Allowed: cat, head, tail, grep, wc, cut, tr, echo, awk, sed, sort, uniq, ls, find, stat, file, du, df, free, uptime, ps, lsof, netstat, ss, whoami, id, hostname, uname, env, printenv, which, dig, ping, cd, and curl to localhost. Pipes, &&, ||, ; and $(...) are supported; every command is checked. Output can't be redirected to files, options that write files or run commands (find -exec, sed -i, awk system()) are rejected, and commands time out after 30s.",
 				Parameters: api.ToolFunctionParameters{
 					Type:     "object",
 					Required: []string{"command"},
@@ -59,7 +62,7 @@ func GetTools() []api.Tool {
 			Type: "function",
 			Function: api.ToolFunction{
 				Name:        "start_task",
-				Description: "Start a new background task. The command will run in the background and its output will be logged.",
+				Description: "Start a new background task. The command will run in the background and its output will be logged. For servers, give a ready probe and set wait_ready to find out whether it came up instead of polling with curl.",
 				Parameters: api.ToolFunctionParameters{
 					Type:     "object",
 					Required: []string{"command"},
@@ -72,6 +75,35 @@ func GetTools() []api.Tool {
 							Type:        api.PropertyType{"string"},
 							Description: "A short human-readable name for the task (optional, defaults to the command)",
 						},
+						"cwd": {
+							Type:        api.PropertyType{"string"},
+							Description: "Absolute directory to run the command in (optional, defaults to the user's current directory)",
+						},
+						"env": {
+							Type:        api.PropertyType{"object"},
+							Description: "Environment variables to set, as an object of name to value (optional)",
+						},
+						"env_files": {
+							Type:        api.PropertyType{"array"},
+							Items:       map[string]any{"type": "string"},
+							Description: "Dotenv files to load, relative to cwd (optional)",
+						},
+						"clear_env": {
+							Type:        api.PropertyType{"boolean"},
+							Description: "Start from an empty environment, keeping only PATH and HOME (optional)",
+						},
+						"shell": {
+							Type:        api.PropertyType{"string"},
+							Description: "Shell to run the command with, e.g. sh or zsh (optional, defaults to bash)",
+						},
+						"ready": {
+							Type:        api.PropertyType{"string"},
+							Description: "Readiness probe (optional): 'tcp::8080' for a port, 'http://localhost:8080/health' for a 2xx response, 'log:<regex>' for a log line, or 'cmd:<command>' for a command exiting 0",
+						},
+						"wait_ready": {
+							Type:        api.PropertyType{"boolean"},
+							Description: "Wait until the ready probe passes (up to 60s) and report whether it did (optional)",
+						},
 					}),
 				},
 			},
@@ -97,7 +129,24 @@ func GetTools() []api.Tool {
 			Type: "function",
 			Function: api.ToolFunction{
 				Name:        "get_task_info",
-				Description: "Get metadata about a task including its ID, name, command, PID, status, start time, and log file path",
+				Description: "Get metadata about a task including its ID, name, command, PID, status, start time, log file path, the last line written to stderr, when it last produced output, and for finished tasks its exit code, terminating signal, and termination reason",
+				Parameters: api.ToolFunctionParameters{
+					Type:     "object",
+					Required: []string{"task_id"},
+					Properties: newProps(map[string]api.ToolProperty{
+						"task_id": {
+							Type:        api.PropertyType{"integer"},
+							Description: "The ID of the task",
+						},
+					}),
+				},
+			},
+		},
+		{
+			Type: "function",
+			Function: api.ToolFunction{
+				Name:        "get_task_metrics",
+				Description: "Get a running task's resource usage over time, sampled from /proc for its whole process group: CPU percent (100 = one full core), resident memory, threads, open file descriptors and process count. Returns the latest sample, min/avg/max over the window and a downsampled series, so you can spot CPU spikes, memory growth or file descriptor leaks.",
 				Parameters: api.ToolFunctionParameters{
 					Type:     "object",
 					Required: []string{"task_id"},
@@ -106,6 +155,31 @@ func GetTools() []api.Tool {
 							Type:        api.PropertyType{"integer"},
 							Description: "The ID of the task",
 						},
+						"minutes": {
+							Type:        api.PropertyType{"integer"},
+							Description: "How many minutes of history to look at (optional, defaults to 10)",
+						},
+					}),
+				},
+			},
+		},
+		{
+			Type: "function",
+			Function: api.ToolFunction{
+				Name:        "get_tick_history",
+				Description: "Get the past runs of a saved tick (a named command the user runs as 'watchy <tick>'): each run's task ID, start time, duration and result, plus success rate and p50/p95 duration for the window and for the window before it, so you can tell whether a tick is getting slower or failing more often.",
+				Parameters: api.ToolFunctionParameters{
+					Type:     "object",
+					Required: []string{"tick"},
+					Properties: newProps(map[string]api.ToolProperty{
+						"tick": {
+							Type:        api.PropertyType{"string"},
+							Description: "The tick's name",
+						},
+						"days": {
+							Type:        api.PropertyType{"integer"},
+							Description: "How many days of history to look at (optional, defaults to 7)",
+						},
 					}),
 				},
 			},
@@ -135,7 +209,13 @@ func (a *Agent) ExecuteTool(toolCall api.ToolCall) (string, error) {
 			return "", fmt.Errorf("missing 'command' argument")
 		}
 		name, _ := args.Get("name")
-		return a.startTask(command.(string), name)
+		opts, err := startOptionsFromArgs(args.Get)
+		if err != nil {
+			return "", err
+		}
+		wait, _ := args.Get("wait_ready")
+		waitReady, _ := wait.(bool)
+		return a.startTask(command.(string), name, opts, waitReady)
 	case "stop_task":
 		taskID, ok := args.Get("task_id")
 		if !ok {
@@ -148,12 +228,44 @@ func (a *Agent) ExecuteTool(toolCall api.ToolCall) (string, error) {
 			return "", fmt.Errorf("missing 'task_id' argument")
 		}
 		return a.getTaskInfo(toInt(taskID))
+	case "get_task_metrics":
+		taskID, ok := args.Get("task_id")
+		if !ok {
+			return "", fmt.Errorf("missing 'task_id' argument")
+		}
+		minutes := 10
+		if v, ok := args.Get("minutes"); ok && toInt(v) > 0 {
+			minutes = toInt(v)
+		}
+		return a.getTaskMetrics(toInt(taskID), time.Duration(minutes)*time.Minute)
+	case "get_tick_history":
+		name, ok := args.Get("tick")
+		if !ok {
+			return "", fmt.Errorf("missing 'tick' argument")
+		}
+		days := 7
+		if v, ok := args.Get("days"); ok && toInt(v) > 0 {
+			days = toInt(v)
+		}
+		return a.getTickHistory(fmt.Sprint(name), time.Duration(days)*24*time.Hour)
 	default:
 		return "", fmt.Errorf("unknown tool: %s", toolCall.Function.Name)
 	}
 }
 
 func (a *Agent) readFile(path string) (string, error) {
+	// Task logs may be rotated; read them across their segments
+	if a.isTaskLog(path) {
+		content, truncated, err := task.ReadLogTail(path, 10240)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+		if truncated {
+			return fmt.Sprintf("[... truncated to last 10KB ...]\n%s", string(content)), nil
+		}
+		return string(content), nil
+	}
+
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return "", fmt.Errorf("failed to read file: %w", err)
@@ -168,32 +280,35 @@ func (a *Agent) readFile(path string) (string, error) {
 	return string(content), nil
 }
 
-func (a *Agent) bashCommand(command string) (string, error) {
-	// Validate command is safe (whitelist approach)
-	parts := strings.Fields(command)
-	if len(parts) == 0 {
-		return "", fmt.Errorf("empty command")
+// isTaskLog reports whether path is the log file of a known task
+func (a *Agent) isTaskLog(path string) bool {
+	tasks, err := a.taskManager.ListTasks()
+	if err != nil {
+		return false
 	}
-
-	safeCommands := map[string]bool{
-		"grep": true, "tail": true, "head": true, "awk": true,
-		"sed": true, "wc": true, "cat": true, "sort": true,
-		"uniq": true, "cut": true, "ls": true, "find": true,
-		"ps": true, "lsof": true, "netstat": true, "ss": true,
-		"df": true, "du": true, "free": true, "uptime": true,
-		"whoami": true, "hostname": true, "uname": true,
-		"env": true, "printenv": true, "which": true,
-		"file": true, "stat": true, "id": true,
-		"curl": true, "dig": true, "ping": true,
-		"psql": true, "cd": true, "pkill": true,
+	for _, t := range tasks {
+		if t.LogPath == path {
+			return true
+		}
 	}
+	return false
+}
 
-	if !safeCommands[parts[0]] {
-		return "", fmt.Errorf("command '%s' is not allowed. Only read-only commands are permitted", parts[0])
+func (a *Agent) bashCommand(command string) (string, error) {
+	if err := checkCommand(command); err != nil {
+		return "", fmt.Errorf("command rejected: %w", err)
 	}
 
-	cmd := exec.Command("bash", "-c", command)
+	ctx, cancel := context.WithTimeout(context.Background(), bashTimeout)
+	defer cancel()
+	cmd, err := a.shellCommand(ctx, command)
+	if err != nil {
+		return "", err
+	}
 	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		err = fmt.Errorf("timed out after %s", bashTimeout)
+	}
 	if err != nil {
 		return fmt.Sprintf("Command failed: %s\nOutput: %s", err, string(output)), nil
 	}
@@ -216,7 +331,59 @@ func toInt(v interface{}) int {
 	return 0
 }
 
-func (a *Agent) startTask(command string, nameVal interface{}) (string, error) {
+// startOptionsFromArgs reads start_task's optional cwd, env, env_files,
+// clear_env, shell and ready arguments
+func startOptionsFromArgs(get func(string) (any, bool)) (task.StartOptions, error) {
+	var opts task.StartOptions
+	if v, ok := get("cwd"); ok {
+		opts.Cwd, _ = v.(string)
+	}
+	if v, ok := get("env"); ok {
+		switch env := v.(type) {
+		case map[string]interface{}:
+			for k, val := range env {
+				opts.Env = append(opts.Env, fmt.Sprintf("%s=%v", k, val))
+			}
+			sort.Strings(opts.Env)
+		case []interface{}:
+			for _, kv := range env {
+				opts.Env = append(opts.Env, fmt.Sprint(kv))
+			}
+		default:
+			return opts, fmt.Errorf("'env' must be an object of name to value")
+		}
+	}
+	if v, ok := get("env_files"); ok {
+		files, ok := v.([]interface{})
+		if !ok {
+			return opts, fmt.Errorf("'env_files' must be an array of paths")
+		}
+		for _, f := range files {
+			opts.EnvFiles = append(opts.EnvFiles, fmt.Sprint(f))
+		}
+	}
+	if v, ok := get("clear_env"); ok {
+		opts.ClearEnv, _ = v.(bool)
+	}
+	if v, ok := get("shell"); ok {
+		opts.Shell, _ = v.(string)
+	}
+	if v, ok := get("ready"); ok {
+		if spec, _ := v.(string); spec != "" {
+			p, err := task.ParseProbe(spec)
+			if err != nil {
+				return opts, err
+			}
+			opts.Ready = p
+		}
+	}
+	return opts, opts.Validate()
+}
+
+// agentReadyTimeout caps how long start_task waits for wait_ready
+const agentReadyTimeout = 60 * time.Second
+
+func (a *Agent) startTask(command string, nameVal interface{}, opts task.StartOptions, waitReady bool) (string, error) {
 	name := ""
 	if s, ok := nameVal.(string); ok && s != "" {
 		name = s
@@ -227,21 +394,53 @@ func (a *Agent) startTask(command string, nameVal interface{}) (string, error) {
 		}
 	}
 
-	taskID, err := a.taskManager.StartTask(name, command)
+	taskID, err := a.taskManager.StartTask(name, command, opts)
 	if err != nil {
 		return "", fmt.Errorf("failed to start task: %w", err)
 	}
 
-	return fmt.Sprintf("Started task %d: %s", taskID, name), nil
+	result := fmt.Sprintf("Started task %d: %s", taskID, name)
+	if !waitReady {
+		return result, nil
+	}
+
+	start := time.Now()
+	if _, err := task.WaitReady(a.taskManager, int(taskID), agentReadyTimeout); err != nil {
+		return fmt.Sprintf("%s\nNot ready: %s", result, err), nil
+	}
+	if opts.Ready == nil {
+		return fmt.Sprintf("%s\nRunning (no ready probe given, so this only means it started)", result), nil
+	}
+	return fmt.Sprintf("%s\nReady after %s (%s)", result, time.Since(start).Round(100*time.Millisecond), opts.Ready), nil
 }
 
 func (a *Agent) stopTask(id int) (string, error) {
-	if err := a.taskManager.StopTask(id); err != nil {
+	if err := a.taskManager.StopTask(id, task.StopOptions{Reason: task.ReasonAgentStop}); err != nil {
 		return "", fmt.Errorf("failed to stop task: %w", err)
 	}
 	return fmt.Sprintf("Stopped task %d", id), nil
 }
 
+// addOutputInfo adds the task's last stderr line and last output time to
+// info, when the task has a stream log
+func (a *Agent) addOutputInfo(taskID int, info map[string]interface{}) {
+	if lines, err := a.taskManager.TailLogLines(taskID, 1, task.LogFilter{Stream: task.StreamStderr}); err == nil && len(lines) > 0 {
+		info["last_stderr_line"] = lines[0].Text
+		info["last_stderr_at"] = lines[0].Time.Format("2006-01-02 15:04:05")
+	}
+
+	lines, err := a.taskManager.TailLogLines(taskID, 20, task.LogFilter{})
+	if err != nil {
+		return
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i].Stream != task.StreamWatchy && !lines[i].Time.IsZero() {
+			info["last_output_at"] = lines[i].Time.Format("2006-01-02 15:04:05")
+			return
+		}
+	}
+}
+
 func (a *Agent) getTaskInfo(taskID int) (string, error) {
 	task, err := a.taskManager.GetTask(taskID)
 	if err != nil {
@@ -261,11 +460,194 @@ func (a *Agent) getTaskInfo(taskID int) (string, error) {
 	if task.EndTime != nil {
 		info["end_time"] = task.EndTime.Format("2006-01-02 15:04:05")
 	}
+	if task.ExitCode != nil {
+		info["exit_code"] = *task.ExitCode
+	}
+	if task.Signal != "" {
+		info["signal"] = task.Signal
+	}
+	if task.TerminationReason != "" {
+		info["termination_reason"] = task.TerminationReason
+	}
+	if task.Options.Cwd != "" {
+		info["cwd"] = task.Options.Cwd
+	}
+	if task.Options.Ready != nil {
+		info["ready_probe"] = task.Options.Ready.String()
+	}
+	if !task.Options.Limits.IsZero() {
+		info["limits"] = task.Options.Limits.String()
+	}
+	if deadline, ok := task.Deadline(); ok && (task.Running() || task.Status == "restarting") {
+		info["timeout_in"] = time.Until(deadline).Round(time.Second).String()
+	}
+	if task.Options.Restart != "" {
+		info["restart_policy"] = task.Options.Restart
+		info["restart_count"] = task.RestartCount
+	}
+	a.addOutputInfo(taskID, info)
+
+	result, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(result), nil
+}
+
+// metricsSeriesPoints caps how many samples get_task_metrics returns
+const metricsSeriesPoints = 20
+
+func (a *Agent) getTaskMetrics(taskID int, window time.Duration) (string, error) {
+	t, err := a.taskManager.GetTask(taskID)
+	if err != nil {
+		return "", err
+	}
+	samples, err := a.taskManager.TaskMetrics(taskID, time.Now().Add(-window))
+	if err != nil {
+		return "", err
+	}
+	if len(samples) == 0 {
+		if !t.Alive() {
+			return fmt.Sprintf("Task %d is %s; no samples in the last %s", taskID, t.Status, window), nil
+		}
+		return fmt.Sprintf("No samples for task %d yet; it is sampled every few seconds while running", taskID), nil
+	}
+
+	type stats struct {
+		Min float64 `json:"min"`
+		Avg float64 `json:"avg"`
+		Max float64 `json:"max"`
+	}
+	summarize := func(get func(task.Metric) float64) stats {
+		st := stats{Min: get(samples[0]), Max: get(samples[0])}
+		for _, s := range samples {
+			v := get(s)
+			st.Min = min(st.Min, v)
+			st.Max = max(st.Max, v)
+			st.Avg += v / float64(len(samples))
+		}
+		return stats{Min: round1(st.Min), Avg: round1(st.Avg), Max: round1(st.Max)}
+	}
+	mb := func(n int64) float64 { return round1(float64(n) / (1 << 20)) }
+
+	// Downsample evenly, always keeping the latest sample
+	step := max(1, (len(samples)+metricsSeriesPoints-1)/metricsSeriesPoints)
+	var series []map[string]interface{}
+	for i := (len(samples) - 1) % step; i < len(samples); i += step {
+		s := samples[i]
+		series = append(series, map[string]interface{}{
+			"time":   s.Time.Format("15:04:05"),
+			"cpu":    round1(s.CPU),
+			"rss_mb": mb(s.RSS),
+			"fds":    s.FDs,
+		})
+	}
+
+	last := samples[len(samples)-1]
+	info := map[string]interface{}{
+		"task_id": taskID,
+		"status":  t.Status,
+		"window":  fmt.Sprintf("%s to %s (%d samples)", samples[0].Time.Format("15:04:05"), last.Time.Format("15:04:05"), len(samples)),
+		"latest": map[string]interface{}{
+			"cpu_percent": round1(last.CPU),
+			"rss_mb":      mb(last.RSS),
+			"threads":     last.Threads,
+			"open_fds":    last.FDs,
+			"processes":   last.Procs,
+		},
+		"cpu_percent": summarize(func(s task.Metric) float64 { return s.CPU }),
+		"rss_mb":      summarize(func(s task.Metric) float64 { return mb(s.RSS) }),
+		"open_fds":    summarize(func(s task.Metric) float64 { return float64(s.FDs) }),
+		"series":      series,
+	}
 
 	result, err := json.MarshalIndent(info, "", "  ")
 	if err != nil {
 		return "", err
 	}
+	return string(result), nil
+}
+
+// historyRuns caps how many runs get_tick_history lists
+const historyRuns = 20
+
+func (a *Agent) getTickHistory(name string, window time.Duration) (string, error) {
+	now := time.Now()
+	// One query covers the window and the one before it, for comparison
+	runs, err := a.taskManager.TickRuns(name, now.Add(-2*window))
+	if err != nil {
+		return "", err
+	}
+	var current, previous []*task.Task
+	for _, t := range runs {
+		if t.CreatedAt.Before(now.Add(-window)) {
+			previous = append(previous, t)
+		} else {
+			current = append(current, t)
+		}
+	}
+	if len(current) == 0 {
+		return fmt.Sprintf("No runs of tick %q in the last %s", name, window), nil
+	}
 
+	stats := func(runs []*task.Task) map[string]interface{} {
+		st := task.Stats(runs)
+		out := map[string]interface{}{
+			"runs":      st.Runs,
+			"succeeded": st.Succeeded,
+			"failed":    st.Failed,
+			"stopped":   st.Stopped,
+			"running":   st.Running,
+		}
+		if rate := st.SuccessRate(); rate >= 0 {
+			out["success_rate"] = round1(rate * 100)
+			out["p50_duration"] = st.P50.Round(time.Second).String()
+			out["p95_duration"] = st.P95.Round(time.Second).String()
+		}
+		return out
+	}
+
+	var list []map[string]interface{}
+	for _, t := range current[:min(historyRuns, len(current))] {
+		run := map[string]interface{}{
+			"task_id": t.ID,
+			"started": t.CreatedAt.Format("2006-01-02 15:04:05"),
+			"status":  t.Status,
+		}
+		if d, ok := t.Duration(); ok {
+			run["duration"] = d.Round(time.Second).String()
+		}
+		if exit := t.ExitSummary(); exit != "" {
+			run["exit"] = exit
+		}
+		if t.TerminationReason != "" {
+			run["termination_reason"] = t.TerminationReason
+		}
+		list = append(list, run)
+	}
+
+	info := map[string]interface{}{
+		"tick":   name,
+		"window": fmt.Sprintf("last %s", window),
+		"stats":  stats(current),
+		"runs":   list,
+	}
+	if len(previous) > 0 {
+		info["previous_window_stats"] = stats(previous)
+	}
+	if len(current) > historyRuns {
+		info["runs_not_listed"] = len(current) - historyRuns
+	}
+
+	result, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return "", err
+	}
 	return string(result), nil
 }
+
+// round1 rounds to one decimal place
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
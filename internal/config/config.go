@@ -14,9 +14,27 @@ type Config struct {
 	DBPath        string
 	ConfigPath    string
 	TicksPath     string
+	StacksPath    string
+	SchedulePath  string // state of scheduled ticks, written by watchyd
+	SocketPath    string // watchyd's Unix socket
+	DaemonLogPath string
 	RetentionDays int    `yaml:"retention_days"`
 	Model         string `yaml:"model"`
 	Theme         string `yaml:"theme"`
+
+	// Default log rotation for new tasks; tasks can override these
+	LogMaxSize  string `yaml:"log_max_size"`  // e.g. "50MB"; "0" disables rotation
+	LogMaxFiles int    `yaml:"log_max_files"` // rotated segments kept per task
+	LogCompress bool   `yaml:"log_compress"`  // gzip rotated segments
+
+	// Resource usage sampling of running tasks
+	MetricsInterval  string `yaml:"metrics_interval"`  // e.g. "5s"; "0" disables sampling
+	MetricsRetention string `yaml:"metrics_retention"` // how long samples are kept, e.g. "24h"
+
+	// Run the agent's bash_command in read-only, offline namespaces (Linux)
+	AgentSandbox bool `yaml:"agent_sandbox"`
+	// Whether the agent may call each tool: "auto", "ask" or "deny"
+	ToolApproval map[string]string `yaml:"tool_approval"`
 }
 
 // New creates a new Config and ensures directories exist
@@ -37,6 +55,10 @@ func New() (*Config, error) {
 
 	configPath := filepath.Join(watchyDir, "config.yaml")
 	ticksPath := filepath.Join(watchyDir, "ticks.json")
+	stacksPath := filepath.Join(watchyDir, "stacks.json")
+	schedulePath := filepath.Join(watchyDir, "schedule.json")
+	socketPath := filepath.Join(watchyDir, "watchyd.sock")
+	daemonLogPath := filepath.Join(watchyDir, "watchyd.log")
 
 	cfg := &Config{
 		HomeDir:       watchyDir,
@@ -44,9 +66,19 @@ func New() (*Config, error) {
 		DBPath:        dbPath,
 		ConfigPath:    configPath,
 		TicksPath:     ticksPath,
+		StacksPath:    stacksPath,
+		SchedulePath:  schedulePath,
+		SocketPath:    socketPath,
+		DaemonLogPath: daemonLogPath,
 		RetentionDays: 1,
 		Model:         "glm-4.7:cloud",
 		Theme:         "green",
+		LogMaxSize:    "50MB",
+		LogMaxFiles:   3,
+		LogCompress:   true,
+
+		MetricsInterval:  "5s",
+		MetricsRetention: "24h",
 	}
 
 	// Load config file if it exists
@@ -80,10 +112,28 @@ func (c *Config) Save() error {
 		RetentionDays int    `yaml:"retention_days"`
 		Model         string `yaml:"model"`
 		Theme         string `yaml:"theme"`
+		LogMaxSize    string `yaml:"log_max_size"`
+		LogMaxFiles   int    `yaml:"log_max_files"`
+		LogCompress   bool   `yaml:"log_compress"`
+
+		MetricsInterval  string `yaml:"metrics_interval"`
+		MetricsRetention string `yaml:"metrics_retention"`
+
+		AgentSandbox bool              `yaml:"agent_sandbox"`
+		ToolApproval map[string]string `yaml:"tool_approval,omitempty"`
 	}{
 		RetentionDays: c.RetentionDays,
 		Model:         c.Model,
 		Theme:         c.Theme,
+		LogMaxSize:    c.LogMaxSize,
+		LogMaxFiles:   c.LogMaxFiles,
+		LogCompress:   c.LogCompress,
+
+		MetricsInterval:  c.MetricsInterval,
+		MetricsRetention: c.MetricsRetention,
+
+		AgentSandbox: c.AgentSandbox,
+		ToolApproval: c.ToolApproval,
 	})
 	if err != nil {
 		return err
@@ -0,0 +1,306 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/parth/watchy/internal/config"
+	"github.com/parth/watchy/internal/task"
+)
+
+// Client talks to watchyd over its Unix socket. It implements
+// task.Controller, so the CLI, TUI and agent can use it in place of a Manager.
+type Client struct {
+	cfg       *config.Config
+	autostart bool // start a daemon if none is listening
+
+	mu  sync.Mutex
+	rpc *rpc.Client
+}
+
+var _ task.Controller = (*Client)(nil)
+
+// Connect returns a client for the daemon, starting one in the background if
+// none is running.
+func Connect(cfg *config.Config) (*Client, error) {
+	c := &Client{cfg: cfg, autostart: true}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Dial connects to a running daemon without starting one
+func Dial(cfg *config.Config) (*Client, error) {
+	c := &Client{cfg: cfg}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) connect() error {
+	if rc, err := dial(c.cfg.SocketPath); err == nil {
+		c.rpc = rc
+		return nil
+	}
+	if !c.autostart {
+		return fmt.Errorf("watchyd is not running")
+	}
+
+	if err := spawnDaemon(c.cfg); err != nil {
+		return err
+	}
+
+	// Wait for the new daemon to start listening
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if rc, err := dial(c.cfg.SocketPath); err == nil {
+			c.rpc = rc
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return fmt.Errorf("watchyd did not start; see %s", c.cfg.DaemonLogPath)
+}
+
+// dial opens a JSON-RPC connection to the daemon. JSON rather than gob,
+// because gob drops zero values behind pointers (an exit code of 0 would
+// arrive as nil).
+func dial(socketPath string) (*rpc.Client, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	return jsonrpc.NewClient(conn), nil
+}
+
+// spawnDaemon launches "watchy daemon" detached from the terminal
+func spawnDaemon(cfg *config.Config) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate watchy executable: %w", err)
+	}
+
+	logFile, err := os.OpenFile(cfg.DaemonLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open daemon log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, "daemon")
+	cmd.Dir = cfg.HomeDir
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start watchyd: %w", err)
+	}
+	return cmd.Process.Release()
+}
+
+// readOnlyMethods can safely be sent again when the connection drops after
+// the request went out: running them twice changes nothing
+var readOnlyMethods = map[string]bool{
+	"Get":              true,
+	"GetChatSession":   true,
+	"List":             true,
+	"ListChatSessions": true,
+	"Metrics":          true,
+	"Status":           true,
+	"Tail":             true,
+	"TailLines":        true,
+	"TickRuns":         true,
+}
+
+// call invokes a daemon method, reconnecting once (and restarting the daemon
+// if needed) when the connection has gone away. The request is only sent
+// again if it never reached the daemon (rpc.ErrShutdown: the connection was
+// already closed) or the method is read-only; a Start or Stop whose reply
+// was lost may have run, so resending it could run it twice.
+func (c *Client) call(method string, args, reply any) error {
+	c.mu.Lock()
+	rc := c.rpc
+	c.mu.Unlock()
+
+	err := rc.Call(serviceName+"."+method, args, reply)
+	notSent := errors.Is(err, rpc.ErrShutdown)
+	replyLost := errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+	if !notSent && !replyLost {
+		return unwrapServerError(err)
+	}
+
+	c.mu.Lock()
+	if c.rpc == rc {
+		rc.Close()
+		if err := c.connect(); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+	}
+	rc = c.rpc
+	c.mu.Unlock()
+
+	if !notSent && !readOnlyMethods[method] {
+		return fmt.Errorf("lost connection to watchyd during %s; it may or may not have completed, check with watchy list", method)
+	}
+	return unwrapServerError(rc.Call(serviceName+"."+method, args, reply))
+}
+
+// unwrapServerError turns rpc.ServerError into a plain error so messages
+// read the same as they would from an in-process Manager
+func unwrapServerError(err error) error {
+	var se rpc.ServerError
+	if errors.As(err, &se) {
+		return errors.New(string(se))
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return fmt.Errorf("lost connection to watchyd: %w", err)
+	}
+	return err
+}
+
+// StartTask starts a task in the caller's working directory and environment
+// unless opts says otherwise
+func (c *Client) StartTask(name, command string, opts task.StartOptions) (int64, error) {
+	if opts.Cwd == "" {
+		opts.Cwd, _ = os.Getwd()
+	}
+	environ := opts.Environ
+	if environ == nil {
+		environ = os.Environ()
+	}
+
+	var id int64
+	err := c.call("Start", StartArgs{Name: name, Command: command, Options: opts, Environ: environ}, &id)
+	return id, err
+}
+
+// StopTask stops a running task, waiting until its process has exited
+func (c *Client) StopTask(id int, opts task.StopOptions) error {
+	var ok bool
+	return c.call("Stop", StopArgs{ID: id, Options: opts}, &ok)
+}
+
+// RestartTask restarts a task in the caller's environment
+func (c *Client) RestartTask(id int) (int64, error) {
+	var newID int64
+	err := c.call("Restart", RestartArgs{ID: id, Environ: os.Environ()}, &newID)
+	return newID, err
+}
+
+// ListTasks lists all tasks
+func (c *Client) ListTasks() ([]*task.Task, error) {
+	var tasks []*task.Task
+	err := c.call("List", true, &tasks)
+	return tasks, err
+}
+
+// GetTask gets a task by ID
+func (c *Client) GetTask(id int) (*task.Task, error) {
+	var t task.Task
+	if err := c.call("Get", id, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// TailLogs reads the last N lines from a task's log file
+func (c *Client) TailLogs(id int, lines int) ([]string, error) {
+	var out []string
+	err := c.call("Tail", TailArgs{ID: id, Lines: lines}, &out)
+	return out, err
+}
+
+// TailLogLines reads the last N matching lines of a task's output
+func (c *Client) TailLogLines(id int, lines int, filter task.LogFilter) ([]task.LogLine, error) {
+	var out []task.LogLine
+	err := c.call("TailLines", TailLinesArgs{ID: id, Lines: lines, Filter: filter}, &out)
+	return out, err
+}
+
+// TaskMetrics returns a task's resource usage samples taken since the given time
+func (c *Client) TaskMetrics(id int, since time.Time) ([]task.Metric, error) {
+	var out []task.Metric
+	err := c.call("Metrics", MetricsArgs{ID: id, Since: since}, &out)
+	return out, err
+}
+
+// TickRuns returns the tasks started from a tick since the given time, newest first
+func (c *Client) TickRuns(tickName string, since time.Time) ([]*task.Task, error) {
+	var out []*task.Task
+	err := c.call("TickRuns", TickRunsArgs{Tick: tickName, Since: since}, &out)
+	return out, err
+}
+
+// CreateChatSession stores a new, empty agent conversation and returns its ID
+func (c *Client) CreateChatSession(cs task.ChatSession) (int, error) {
+	var id int
+	err := c.call("CreateChatSession", cs, &id)
+	return id, err
+}
+
+// AppendChatMessages adds messages to a stored conversation and records the
+// task it is focused on
+func (c *Client) AppendChatMessages(id, taskID int, msgs []task.ChatMessage) error {
+	var ok bool
+	return c.call("AppendChatMessages", AppendChatArgs{ID: id, TaskID: taskID, Messages: msgs}, &ok)
+}
+
+// ListChatSessions returns the stored conversations, most recently updated first
+func (c *Client) ListChatSessions() ([]*task.ChatSession, error) {
+	var out []*task.ChatSession
+	err := c.call("ListChatSessions", true, &out)
+	return out, err
+}
+
+// GetChatSession returns a stored conversation with its messages
+func (c *Client) GetChatSession(id int) (*task.ChatSession, error) {
+	var cs task.ChatSession
+	if err := c.call("GetChatSession", id, &cs); err != nil {
+		return nil, err
+	}
+	return &cs, nil
+}
+
+// Cleanup removes old completed/crashed tasks and their log files
+func (c *Client) Cleanup(retentionDays int) (int, error) {
+	var n int
+	err := c.call("Cleanup", retentionDays, &n)
+	return n, err
+}
+
+// Status reports the daemon's PID, version and start time
+func (c *Client) Status() (Status, error) {
+	var st Status
+	err := c.call("Status", true, &st)
+	return st, err
+}
+
+// Shutdown asks the daemon to exit. Running tasks keep running and are
+// adopted by the next daemon.
+func (c *Client) Shutdown() error {
+	var ok bool
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// No reconnect here: that could start a fresh daemon
+	return unwrapServerError(c.rpc.Call(serviceName+".Shutdown", true, &ok))
+}
+
+// Close closes the connection to the daemon
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rpc.Close()
+}
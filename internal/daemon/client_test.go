@@ -0,0 +1,150 @@
+package daemon
+
+import (
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/parth/watchy/internal/config"
+	"github.com/parth/watchy/internal/task"
+)
+
+// fakeService counts the calls it gets, and can drop the connection after
+// running a method so its reply is lost
+type fakeService struct {
+	mu    sync.Mutex
+	calls map[string]int
+	drop  map[string]bool // drop the connection after the next call of each method
+	conns []net.Conn
+}
+
+func (s *fakeService) called(method string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[method]++
+	if s.drop[method] {
+		delete(s.drop, method)
+		s.conns[len(s.conns)-1].Close()
+	}
+}
+
+func (s *fakeService) count(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+func (s *fakeService) Start(args StartArgs, id *int64) error {
+	s.called("Start")
+	*id = 1
+	return nil
+}
+
+func (s *fakeService) List(all bool, tasks *[]*task.Task) error {
+	s.called("List")
+	*tasks = []*task.Task{{ID: 1}}
+	return nil
+}
+
+// newFakeDaemon serves a fakeService and returns a client connected to it
+func newFakeDaemon(t *testing.T) (*fakeService, *Client) {
+	t.Helper()
+	svc := &fakeService{calls: make(map[string]int), drop: make(map[string]bool)}
+	server := rpc.NewServer()
+	if err := server.RegisterName(serviceName, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{SocketPath: filepath.Join(t.TempDir(), "watchyd.sock")}
+	listener, err := net.Listen("unix", cfg.SocketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			svc.mu.Lock()
+			svc.conns = append(svc.conns, conn)
+			svc.mu.Unlock()
+			go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+
+	client, err := Dial(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	// Wait for the server side of the connection
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		svc.mu.Lock()
+		n := len(svc.conns)
+		svc.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("client connection was never accepted")
+		}
+	}
+	return svc, client
+}
+
+func TestCallDoesNotResendAfterLostReply(t *testing.T) {
+	svc, client := newFakeDaemon(t)
+	svc.drop["Start"] = true
+
+	_, err := client.StartTask("web", "npm start", task.StartOptions{})
+	if err == nil || !strings.Contains(err.Error(), "lost connection") {
+		t.Errorf("StartTask() error = %v, want lost connection", err)
+	}
+	if n := svc.count("Start"); n != 1 {
+		t.Errorf("Start ran %d times, want 1", n)
+	}
+
+	// The client reconnected for the next call
+	if _, err := client.ListTasks(); err != nil {
+		t.Errorf("ListTasks() after reconnect: %v", err)
+	}
+}
+
+func TestCallResendsReadOnlyAfterLostReply(t *testing.T) {
+	svc, client := newFakeDaemon(t)
+	svc.drop["List"] = true
+
+	tasks, err := client.ListTasks()
+	if err != nil || len(tasks) != 1 {
+		t.Errorf("ListTasks() = %d tasks, %v", len(tasks), err)
+	}
+	if n := svc.count("List"); n != 2 {
+		t.Errorf("List ran %d times, want 2", n)
+	}
+}
+
+func TestCallResendsUnsentRequest(t *testing.T) {
+	svc, client := newFakeDaemon(t)
+
+	// The daemon restarts between calls, so the next request finds the
+	// connection already closed and is never written to it
+	svc.mu.Lock()
+	svc.conns[0].Close()
+	svc.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := client.StartTask("web", "npm start", task.StartOptions{}); err != nil {
+		t.Errorf("StartTask() = %v", err)
+	}
+	if n := svc.count("Start"); n != 1 {
+		t.Errorf("Start ran %d times, want 1", n)
+	}
+}
@@ -0,0 +1,187 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/parth/watchy/internal/config"
+	"github.com/parth/watchy/internal/scheduler"
+	"github.com/parth/watchy/internal/task"
+)
+
+// serviceName is the name the RPC service is registered under
+const serviceName = "Watchyd"
+
+// Run starts the watchyd supervisor in the foreground. It owns every task
+// process, serves the CLI and TUI over the Unix socket at cfg.SocketPath,
+// and returns once it is shut down via Shutdown or SIGINT/SIGTERM.
+// Running tasks are left alone on shutdown; the next daemon adopts them.
+func Run(cfg *config.Config, version string) error {
+	lock, err := acquireLock(lockPath(cfg))
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	storage, err := task.NewStorage(cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	logMaxSize, err := task.ParseSize(cfg.LogMaxSize)
+	if err != nil {
+		return fmt.Errorf("log_max_size in %s: %w", cfg.ConfigPath, err)
+	}
+
+	mgr := task.NewManager(storage, cfg.LogsDir)
+	mgr.SetLogDefaults(task.LogOptions{
+		MaxSize:  logMaxSize,
+		MaxFiles: cfg.LogMaxFiles,
+		Compress: cfg.LogCompress,
+	})
+	if err := mgr.SyncTaskStatus(); err != nil {
+		log.Printf("sync task status: %s", err)
+	}
+
+	interval, retention, err := metricsSettings(cfg)
+	if err != nil {
+		return err
+	}
+	if interval > 0 {
+		stopSampling := make(chan struct{})
+		defer close(stopSampling)
+		go mgr.SampleMetrics(interval, retention, stopSampling)
+	}
+
+	stopScheduler := make(chan struct{})
+	defer close(stopScheduler)
+	go scheduler.New(mgr, cfg.TicksPath, cfg.SchedulePath).Run(stopScheduler)
+
+	// We hold the lock, so any socket file left behind is stale
+	os.Remove(cfg.SocketPath)
+	listener, err := listenPrivate(cfg.SocketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", cfg.SocketPath, err)
+	}
+	defer os.Remove(cfg.SocketPath)
+
+	svc := &Service{
+		mgr:      mgr,
+		version:  version,
+		started:  time.Now(),
+		shutdown: make(chan struct{}),
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName(serviceName, svc); err != nil {
+		return fmt.Errorf("failed to register service: %w", err)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			log.Printf("received %s, shutting down", sig)
+		case <-svc.shutdown:
+			log.Printf("shutdown requested")
+		}
+		listener.Close()
+	}()
+
+	log.Printf("watchyd %s listening on %s (pid %d)", version, cfg.SocketPath, os.Getpid())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("accept failed: %w", err)
+		}
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// listenPrivate listens on a Unix socket at path that only the current user
+// can connect to. The socket is created in a private (0700) directory and
+// only moved to path once it is 0600, so there is no moment at which another
+// user could connect.
+func listenPrivate(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, filepath.Base(path))
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// The socket outlives its temporary name
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// metricsSettings parses the sampling interval and retention from the
+// config. A zero interval disables sampling.
+func metricsSettings(cfg *config.Config) (interval, retention time.Duration, err error) {
+	if cfg.MetricsInterval != "" && cfg.MetricsInterval != "0" {
+		interval, err = time.ParseDuration(cfg.MetricsInterval)
+		if err != nil || interval < 0 {
+			return 0, 0, fmt.Errorf("metrics_interval in %s: invalid duration %q", cfg.ConfigPath, cfg.MetricsInterval)
+		}
+	}
+	retention = 24 * time.Hour
+	if cfg.MetricsRetention != "" {
+		retention, err = time.ParseDuration(cfg.MetricsRetention)
+		if err != nil || retention <= 0 {
+			return 0, 0, fmt.Errorf("metrics_retention in %s: invalid duration %q", cfg.ConfigPath, cfg.MetricsRetention)
+		}
+	}
+	return interval, retention, nil
+}
+
+func lockPath(cfg *config.Config) string {
+	return filepath.Join(cfg.HomeDir, "watchyd.lock")
+}
+
+// acquireLock takes an exclusive lock so only one daemon runs per watchy
+// home, and writes our PID into the lock file
+func acquireLock(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("watchyd is already running")
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return f, nil
+}
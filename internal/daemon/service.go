@@ -0,0 +1,208 @@
+package daemon
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/parth/watchy/internal/task"
+)
+
+// Service is the RPC surface watchyd exposes. Each method maps onto a
+// task.Controller operation; Client is its counterpart.
+type Service struct {
+	mgr     *task.Manager
+	version string
+	started time.Time
+
+	shutdownOnce sync.Once
+	shutdown     chan struct{}
+}
+
+// StartArgs are the arguments for Service.Start
+type StartArgs struct {
+	Name    string
+	Command string
+	Options task.StartOptions
+	Environ []string // Options.Environ isn't serialized, so it travels here
+}
+
+// StopArgs are the arguments for Service.Stop
+type StopArgs struct {
+	ID      int
+	Options task.StopOptions
+}
+
+// RestartArgs are the arguments for Service.Restart
+type RestartArgs struct {
+	ID      int
+	Environ []string
+}
+
+// TailArgs are the arguments for Service.Tail
+type TailArgs struct {
+	ID    int
+	Lines int
+}
+
+// TailLinesArgs are the arguments for Service.TailLines
+type TailLinesArgs struct {
+	ID     int
+	Lines  int
+	Filter task.LogFilter
+}
+
+// MetricsArgs are the arguments for Service.Metrics
+type MetricsArgs struct {
+	ID    int
+	Since time.Time
+}
+
+// TickRunsArgs are the arguments for Service.TickRuns
+type TickRunsArgs struct {
+	Tick  string
+	Since time.Time
+}
+
+// AppendChatArgs are the arguments for Service.AppendChatMessages
+type AppendChatArgs struct {
+	ID       int
+	TaskID   int
+	Messages []task.ChatMessage
+}
+
+// Status describes the running daemon
+type Status struct {
+	PID     int
+	Version string
+	Started time.Time
+}
+
+// Start starts a task in the client's environment
+func (s *Service) Start(args StartArgs, reply *int64) error {
+	args.Options.Environ = args.Environ
+	id, err := s.mgr.StartTask(args.Name, args.Command, args.Options)
+	*reply = id
+	return err
+}
+
+// Stop stops a task
+func (s *Service) Stop(args StopArgs, reply *bool) error {
+	return s.mgr.StopTask(args.ID, args.Options)
+}
+
+// Restart restarts a task under the client's environment
+func (s *Service) Restart(args RestartArgs, reply *int64) error {
+	id, err := s.mgr.RestartTaskWithEnv(args.ID, args.Environ)
+	*reply = id
+	return err
+}
+
+// List lists all tasks
+func (s *Service) List(_ bool, reply *[]*task.Task) error {
+	tasks, err := s.mgr.ListTasks()
+	*reply = nonNil(tasks)
+	return err
+}
+
+// Get returns a single task
+func (s *Service) Get(id int, reply *task.Task) error {
+	t, err := s.mgr.GetTask(id)
+	if err != nil {
+		return err
+	}
+	*reply = *t
+	return nil
+}
+
+// Tail returns the last lines of a task's log
+func (s *Service) Tail(args TailArgs, reply *[]string) error {
+	lines, err := s.mgr.TailLogs(args.ID, args.Lines)
+	*reply = nonNil(lines)
+	return err
+}
+
+// TailLines returns the last matching lines of a task's stream log
+func (s *Service) TailLines(args TailLinesArgs, reply *[]task.LogLine) error {
+	lines, err := s.mgr.TailLogLines(args.ID, args.Lines, args.Filter)
+	*reply = nonNil(lines)
+	return err
+}
+
+// Metrics returns a task's resource usage samples
+func (s *Service) Metrics(args MetricsArgs, reply *[]task.Metric) error {
+	metrics, err := s.mgr.TaskMetrics(args.ID, args.Since)
+	*reply = nonNil(metrics)
+	return err
+}
+
+// TickRuns returns the tasks started from a tick
+func (s *Service) TickRuns(args TickRunsArgs, reply *[]*task.Task) error {
+	tasks, err := s.mgr.TickRuns(args.Tick, args.Since)
+	*reply = nonNil(tasks)
+	return err
+}
+
+// CreateChatSession stores a new agent conversation
+func (s *Service) CreateChatSession(cs task.ChatSession, reply *int) error {
+	id, err := s.mgr.CreateChatSession(cs)
+	*reply = id
+	return err
+}
+
+// AppendChatMessages adds messages to a stored conversation
+func (s *Service) AppendChatMessages(args AppendChatArgs, reply *bool) error {
+	return s.mgr.AppendChatMessages(args.ID, args.TaskID, args.Messages)
+}
+
+// ListChatSessions returns the stored conversations
+func (s *Service) ListChatSessions(_ bool, reply *[]*task.ChatSession) error {
+	sessions, err := s.mgr.ListChatSessions()
+	*reply = nonNil(sessions)
+	return err
+}
+
+// GetChatSession returns a stored conversation with its messages
+func (s *Service) GetChatSession(id int, reply *task.ChatSession) error {
+	cs, err := s.mgr.GetChatSession(id)
+	if err != nil {
+		return err
+	}
+	*reply = *cs
+	return nil
+}
+
+// Cleanup removes old finished tasks
+func (s *Service) Cleanup(retentionDays int, reply *int) error {
+	n, err := s.mgr.Cleanup(retentionDays)
+	*reply = n
+	return err
+}
+
+// Status reports on the daemon itself
+func (s *Service) Status(_ bool, reply *Status) error {
+	*reply = Status{
+		PID:     os.Getpid(),
+		Version: s.version,
+		Started: s.started,
+	}
+	return nil
+}
+
+// Shutdown asks the daemon to exit. Running tasks keep running.
+func (s *Service) Shutdown(_ bool, reply *bool) error {
+	// Give the reply a moment to reach the client before we stop serving
+	time.AfterFunc(100*time.Millisecond, func() {
+		s.shutdownOnce.Do(func() { close(s.shutdown) })
+	})
+	return nil
+}
+
+// nonNil returns an empty slice for nil. A nil slice encodes as JSON null,
+// which the jsonrpc client rejects as a missing result.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
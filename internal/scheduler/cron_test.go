@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"* * * * *", false},
+		{"*/15 9-17 * * mon-fri", false},
+		{"0 0 1,15 jan,JUL *", false},
+		{"10-40/10 * * * 7", false},
+		{"@daily", false},
+		{"@every 90s", false},
+		{"  @hourly  ", false},
+		{"* * * *", true},
+		{"* * * * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"*/0 * * * *", true},
+		{"5-1 * * * *", true},
+		{"* * * foo *", true},
+		{"@every 500ms", true},
+		{"@every soon", true},
+		{"@fortnightly", true},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04 MST", s, ny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		spec string
+		from string
+		want []string // successive runs; none if the schedule never runs
+	}{
+		{"*/15 * * * *", "2026-10-16 09:07 EDT", []string{"2026-10-16 09:15 EDT", "2026-10-16 09:30 EDT"}},
+		{"0 9 * * mon-fri", "2026-10-16 09:00 EDT", []string{"2026-10-19 09:00 EDT", "2026-10-20 09:00 EDT"}},
+		{"@every 2m", "2026-10-16 09:00 EDT", []string{"2026-10-16 09:02 EDT", "2026-10-16 09:04 EDT"}},
+
+		// Month and year rollover
+		{"0 0 31 * *", "2026-01-31 12:00 EST", []string{"2026-03-31 00:00 EDT", "2026-05-31 00:00 EDT"}},
+		{"@monthly", "2026-12-15 00:00 EST", []string{"2027-01-01 00:00 EST", "2027-02-01 00:00 EST"}},
+		{"0 0 29 2 *", "2026-03-01 00:00 EST", []string{"2028-02-29 00:00 EST"}},
+		{"0 0 30 2 *", "2026-01-01 00:00 EST", nil},
+
+		// A step in a day field still leaves it unrestricted, so only the
+		// other field decides; two restricted fields match either one
+		{"0 0 */2 * mon", "2026-10-16 12:00 EDT", []string{"2026-10-19 00:00 EDT", "2026-10-26 00:00 EDT"}},
+		{"0 0 1 * */3", "2026-10-16 12:00 EDT", []string{"2026-11-01 00:00 EDT", "2026-12-01 00:00 EST"}},
+		{"0 0 14 * fri", "2026-10-16 12:00 EDT", []string{"2026-10-23 00:00 EDT", "2026-10-30 00:00 EDT", "2026-11-06 00:00 EST", "2026-11-13 00:00 EST", "2026-11-14 00:00 EST"}},
+
+		// Spring forward: 02:00-02:59 doesn't exist on 8 March and is
+		// skipped, and the rest of the day carries on
+		{"30 2 * * *", "2026-03-07 12:00 EST", []string{"2026-03-09 02:30 EDT"}},
+		{"0 * * * *", "2026-03-08 00:30 EST", []string{"2026-03-08 01:00 EST", "2026-03-08 03:00 EDT", "2026-03-08 04:00 EDT"}},
+
+		// Fall back: 01:00-01:59 happens twice on 1 November and runs once
+		{"30 1 * * *", "2026-10-31 12:00 EDT", []string{"2026-11-01 01:30 EDT", "2026-11-02 01:30 EST"}},
+		{"*/20 1 * * *", "2026-11-01 00:50 EDT", []string{"2026-11-01 01:00 EDT", "2026-11-01 01:20 EDT", "2026-11-01 01:40 EDT", "2026-11-02 01:00 EST"}},
+		{"0 * * * *", "2026-11-01 00:30 EDT", []string{"2026-11-01 01:00 EDT", "2026-11-01 02:00 EST"}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		from := at(tt.from)
+		if len(tt.want) == 0 {
+			if got := s.Next(from); !got.IsZero() {
+				t.Errorf("%q: Next(%s) = %s, want none", tt.spec, tt.from, got)
+			}
+			continue
+		}
+		for _, w := range tt.want {
+			got := s.Next(from)
+			if want := at(w); !got.Equal(want) {
+				t.Errorf("%q: Next(%s) = %s, want %s", tt.spec, from.Format("2006-01-02 15:04 MST"), got.Format("2006-01-02 15:04 MST"), w)
+				break
+			}
+			from = got
+		}
+	}
+}
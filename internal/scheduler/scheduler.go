@@ -0,0 +1,331 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/parth/watchy/internal/atomicfile"
+	"github.com/parth/watchy/internal/task"
+	"github.com/parth/watchy/internal/tick"
+)
+
+// Status is what the scheduler records about a scheduled tick's runs. It is
+// written by watchyd and read by the CLI and TUI.
+type Status struct {
+	LastRun time.Time `json:"last_run"`
+	TaskID  int       `json:"task_id,omitempty"` // task started by the last run
+	Error   string    `json:"error,omitempty"`   // why the last run failed to start, or to replace the one before
+	Skipped int       `json:"skipped,omitempty"` // runs skipped since, because it was still going
+	Queued  bool      `json:"queued,omitempty"`  // a run is waiting for the last one to end
+	Next    time.Time `json:"next,omitempty"`    // when the next run is due
+}
+
+// LoadState reads the scheduler state file. A missing file is an empty state.
+func LoadState(path string) (map[string]Status, error) {
+	state := make(map[string]Status)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid scheduler state %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// Scheduler starts scheduled ticks as tasks. Ticks are re-read every check,
+// so schedules added or changed from the CLI take effect within a second.
+type Scheduler struct {
+	mgr       task.Controller
+	ticksPath string
+	statePath string
+
+	mu        sync.Mutex
+	state     map[string]Status
+	specs     map[string]string // the spec each entry in schedules was parsed from
+	schedules map[string]Schedule
+	next      map[string]time.Time
+	replacing map[string]bool
+	saved     []byte // last state written, to skip rewriting an unchanged file
+	syncErr   string // last error syncing imported ticks, logged once
+}
+
+// New creates a Scheduler for the ticks in ticksPath, keeping its state in statePath
+func New(mgr task.Controller, ticksPath, statePath string) *Scheduler {
+	state, err := LoadState(statePath)
+	if err != nil {
+		log.Printf("scheduler: %s", err)
+		state = make(map[string]Status)
+	}
+	return &Scheduler{
+		mgr:       mgr,
+		ticksPath: ticksPath,
+		statePath: statePath,
+		state:     state,
+		specs:     make(map[string]string),
+		schedules: make(map[string]Schedule),
+		next:      make(map[string]time.Time),
+		replacing: make(map[string]bool),
+	}
+}
+
+// Run checks for due ticks every second until stop is closed. Runs missed
+// while watchyd wasn't running are not made up.
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.check(time.Now())
+		}
+	}
+}
+
+// check starts every tick that is due, or whose queued run can now start
+func (s *Scheduler) check(now time.Time) {
+	store, err := tick.NewStore(s.ticksPath)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Scheduled runs use the current version of synced imported ticks. A
+	// file that fails to parse is retried every check, so log it once.
+	changes, err := store.Sync()
+	for _, c := range changes {
+		log.Printf("scheduler: %s", c)
+	}
+	if err != nil && err.Error() != s.syncErr {
+		log.Printf("scheduler: syncing imported ticks: %s", err)
+	}
+	s.syncErr = ""
+	if err != nil {
+		s.syncErr = err.Error()
+	}
+
+	scheduled := make(map[string]bool)
+	for _, nt := range store.List() {
+		name, t := nt.Name, nt.Tick
+		if t.Schedule == "" {
+			continue
+		}
+		scheduled[name] = true
+
+		if s.specs[name] != t.Schedule {
+			s.specs[name] = t.Schedule
+			sched, err := Parse(t.Schedule)
+			if err != nil {
+				log.Printf("scheduler: tick %q: %s", name, err)
+				delete(s.schedules, name)
+				continue
+			}
+			s.schedules[name] = sched
+			s.next[name] = sched.Next(now)
+		}
+		sched, ok := s.schedules[name]
+		if !ok {
+			continue
+		}
+
+		st := s.state[name]
+		if st.Queued && !s.running(st.TaskID) {
+			s.launch(name, t, now)
+		}
+		if next := s.next[name]; !next.IsZero() && !now.Before(next) {
+			s.next[name] = sched.Next(now)
+			s.due(name, t, now)
+		}
+
+		st = s.state[name]
+		st.Next = s.next[name]
+		s.state[name] = st
+	}
+
+	for name := range s.specs {
+		if !scheduled[name] {
+			delete(s.specs, name)
+			delete(s.schedules, name)
+			delete(s.next, name)
+		}
+	}
+	for name := range s.state {
+		if !scheduled[name] {
+			delete(s.state, name)
+		}
+	}
+	s.save()
+}
+
+// due handles a run coming due, applying the tick's overlap policy if the
+// previous run is still going
+func (s *Scheduler) due(name string, t tick.Tick, now time.Time) {
+	st := s.state[name]
+	if !s.running(st.TaskID) {
+		s.launch(name, t, now)
+		return
+	}
+
+	switch t.Overlap {
+	case tick.OverlapQueue:
+		st.Queued = true
+	case tick.OverlapReplace:
+		if !s.replacing[name] {
+			s.replacing[name] = true
+			go s.replace(name, st.TaskID, t)
+		}
+		return
+	default:
+		st.Skipped++
+		log.Printf("scheduler: tick %q is still running as task %d; skipping this run", name, st.TaskID)
+	}
+	s.state[name] = st
+}
+
+// replace stops the previous run and starts a new one. Stopping waits out
+// the task's grace period, so it runs outside the check loop. If the
+// previous run can't be stopped, no new one starts alongside it; the next
+// run that comes due tries again.
+func (s *Scheduler) replace(name string, prev int, t tick.Tick) {
+	err := s.mgr.StopTask(prev, task.StopOptions{Reason: task.ReasonReplaced})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.replacing, name)
+	// The run may have ended by itself, which is as good as stopping it
+	if err != nil && s.running(prev) {
+		log.Printf("scheduler: tick %q: not replacing task %d, which failed to stop: %s", name, prev, err)
+		st := s.state[name]
+		st.Error = fmt.Sprintf("task %d failed to stop: %s", prev, err)
+		s.state[name] = st
+		s.save()
+		return
+	}
+	s.launch(name, t, time.Now())
+	s.save()
+}
+
+// launch starts a run of the tick and records it. Ticks without a working
+// directory run in the home directory, not wherever watchyd was started.
+func (s *Scheduler) launch(name string, t tick.Tick, now time.Time) {
+	st := Status{LastRun: now}
+	opts, err := t.StartOptions()
+	var command string
+	if err == nil {
+		// Scheduled runs use the parameters' defaults
+		command, err = t.Render(nil)
+	}
+	if err == nil {
+		if opts.Cwd == "" {
+			opts.Cwd, _ = os.UserHomeDir()
+		}
+		opts.Tick = name
+		var id int64
+		id, err = s.mgr.StartTask(name, command, opts)
+		st.TaskID = int(id)
+	}
+	if err != nil {
+		st.Error = err.Error()
+		log.Printf("scheduler: tick %q failed to start: %s", name, err)
+	} else {
+		log.Printf("scheduler: started tick %q as task %d", name, st.TaskID)
+	}
+	s.state[name] = st
+}
+
+// running reports whether a task started by the scheduler is still going
+func (s *Scheduler) running(id int) bool {
+	if id == 0 {
+		return false
+	}
+	t, err := s.mgr.GetTask(id)
+	return err == nil && (t.Alive() || t.Status == "restarting")
+}
+
+func (s *Scheduler) save() {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil || bytes.Equal(data, s.saved) {
+		return
+	}
+	if err := atomicfile.WriteFile(s.statePath, data, 0644); err != nil {
+		log.Printf("scheduler: %s", err)
+		return
+	}
+	s.saved = data
+}
+
+// Entry describes a scheduled tick for display
+type Entry struct {
+	Name     string
+	Schedule string
+	Overlap  string
+	Next     time.Time // zero if the schedule is invalid or never fires
+	Queued   bool
+	Last     string // result of the last run, e.g. "stopped, exit 0 (task 12)"; "" if none
+}
+
+// Entries lists the scheduled ticks with their next run and last result,
+// sorted by name
+func Entries(ticks []tick.NamedTick, state map[string]Status, c task.Controller, now time.Time) []Entry {
+	var entries []Entry
+	for _, nt := range ticks {
+		t := nt.Tick
+		if t.Schedule == "" {
+			continue
+		}
+		e := Entry{Name: nt.Name, Schedule: t.Schedule, Overlap: t.Overlap}
+		if e.Overlap == "" {
+			e.Overlap = tick.OverlapSkip
+		}
+		st, ok := state[nt.Name]
+		if ok {
+			e.Next = st.Next
+			e.Queued = st.Queued
+			e.Last = lastResult(st, c)
+		}
+		// The daemon hasn't picked up a new or changed schedule yet
+		if e.Next.Before(now) {
+			if sched, err := Parse(t.Schedule); err == nil {
+				e.Next = sched.Next(now)
+			}
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// lastResult describes how a tick's last scheduled run went
+func lastResult(st Status, c task.Controller) string {
+	if st.Error != "" {
+		return "failed to start: " + st.Error
+	}
+	if st.TaskID == 0 {
+		return ""
+	}
+	result := fmt.Sprintf("task %d", st.TaskID)
+	if t, err := c.GetTask(st.TaskID); err == nil {
+		result = t.Status
+		if exit := t.ExitSummary(); exit != "" && !t.Alive() {
+			result += ", " + exit
+		}
+		result += fmt.Sprintf(" (task %d)", st.TaskID)
+	}
+	if st.Skipped > 0 {
+		result += fmt.Sprintf(", %d skipped", st.Skipped)
+	}
+	return result
+}
@@ -0,0 +1,118 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/parth/watchy/internal/task"
+	"github.com/parth/watchy/internal/tick"
+)
+
+// fakeController starts tasks that run until stopped, and can fail to stop
+// them
+type fakeController struct {
+	task.Controller
+
+	mu      sync.Mutex
+	tasks   map[int]*task.Task
+	stopErr error
+}
+
+func newFakeController() *fakeController {
+	return &fakeController{tasks: make(map[int]*task.Task)}
+}
+
+func (c *fakeController) StartTask(name, command string, opts task.StartOptions) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := len(c.tasks) + 1
+	c.tasks[id] = &task.Task{ID: id, Name: name, Command: command, Status: "running"}
+	return int64(id), nil
+}
+
+func (c *fakeController) StopTask(id int, opts task.StopOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopErr != nil {
+		return c.stopErr
+	}
+	c.tasks[id].Status = "stopped"
+	return nil
+}
+
+func (c *fakeController) GetTask(id int) (*task.Task, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tasks[id]
+	if !ok {
+		return nil, fmt.Errorf("task %d not found", id)
+	}
+	snapshot := *t
+	return &snapshot, nil
+}
+
+func (c *fakeController) started() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.tasks)
+}
+
+// newReplacing returns a scheduler whose "job" tick has a run going as
+// task 1, which the next run is due to replace
+func newReplacing(t *testing.T, mgr *fakeController) *Scheduler {
+	t.Helper()
+	dir := t.TempDir()
+	s := New(mgr, filepath.Join(dir, "ticks.json"), filepath.Join(dir, "schedule.json"))
+	if _, err := mgr.StartTask("job", "./job", task.StartOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	s.state["job"] = Status{TaskID: 1}
+	return s
+}
+
+var replaceTick = tick.Tick{Command: "./job", Schedule: "@every 1m", Overlap: tick.OverlapReplace}
+
+func TestReplace(t *testing.T) {
+	mgr := newFakeController()
+	s := newReplacing(t, mgr)
+
+	s.replace("job", 1, replaceTick)
+	if st := s.state["job"]; st.TaskID != 2 || st.Error != "" {
+		t.Errorf("state = %+v, want task 2 started", st)
+	}
+	if prev, _ := mgr.GetTask(1); prev.Status != "stopped" {
+		t.Errorf("previous run is %s, want stopped", prev.Status)
+	}
+}
+
+func TestReplaceStopFails(t *testing.T) {
+	mgr := newFakeController()
+	mgr.stopErr = errors.New("permission denied")
+	s := newReplacing(t, mgr)
+
+	s.replace("job", 1, replaceTick)
+	if n := mgr.started(); n != 1 {
+		t.Errorf("started %d tasks, want only the one that didn't stop", n)
+	}
+	st := s.state["job"]
+	if st.TaskID != 1 || !strings.Contains(st.Error, "permission denied") {
+		t.Errorf("state = %+v, want task 1 kept with the stop error", st)
+	}
+	if s.replacing["job"] {
+		t.Error("still marked as replacing, so it would never be retried")
+	}
+
+	// Once the old run has gone, the next replace starts a new one even if
+	// stopping it fails
+	mgr.mu.Lock()
+	mgr.tasks[1].Status = "crashed"
+	mgr.mu.Unlock()
+	s.replace("job", 1, replaceTick)
+	if st := s.state["job"]; st.TaskID != 2 || st.Error != "" {
+		t.Errorf("state = %+v, want task 2 started", st)
+	}
+}
@@ -0,0 +1,39 @@
+package sparkline
+
+import "strings"
+
+var bars = []rune("▁▂▃▄▅▆▇█")
+
+// Render draws each value as one bar character, scaled so that max is a
+// full bar. A max of 0 or less scales to the largest value. Only the last
+// width values are drawn; shorter series are padded on the left.
+func Render(values []float64, max float64, width int) string {
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	if max <= 0 {
+		for _, v := range values {
+			if v > max {
+				max = v
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", width-len(values)))
+	for _, v := range values {
+		i := 0
+		if max > 0 && v > 0 {
+			i = int(v / max * float64(len(bars)-1))
+			if i >= len(bars) {
+				i = len(bars) - 1
+			}
+			// Anything above zero gets at least a sliver
+			if i == 0 {
+				i = 1
+			}
+		}
+		b.WriteRune(bars[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,212 @@
+package stack
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/parth/watchy/internal/task"
+	"github.com/parth/watchy/internal/tick"
+)
+
+// settleTime is how long a long-running step without a readiness probe
+// must stay up before steps that depend on it are started
+const settleTime = time.Second
+
+// Up starts every step of the stack that isn't already running, in
+// dependency order. Each step waits for its dependencies: long-running
+// steps must pass their readiness probe (or, without one, still be running
+// after settleTime), one-shot steps must have exited 0. Up stops at the
+// first step that fails or doesn't exit or become ready within its wait
+// timeout, leaving the steps already started running.
+func Up(mgr task.Controller, ticks *tick.Store, name string, st Stack, progress func(string)) error {
+	order, err := st.Order()
+	if err != nil {
+		return err
+	}
+
+	// Resolve every tick before starting anything
+	opts := make(map[string]task.StartOptions, len(order))
+	commands := make(map[string]string, len(order))
+	timeouts := make(map[string]time.Duration, len(order))
+	for _, step := range order {
+		timeout, err := step.waitTimeout()
+		if err != nil {
+			return err
+		}
+		timeouts[step.Tick] = timeout
+		t, err := ticks.Get(step.Tick)
+		if err != nil {
+			return err
+		}
+		o, err := t.StartOptions()
+		if err != nil {
+			return fmt.Errorf("tick %q: %w", step.Tick, err)
+		}
+		// Stack steps run with their parameters' defaults
+		command, err := t.Render(nil)
+		if err != nil {
+			return fmt.Errorf("tick %q: %w", step.Tick, err)
+		}
+		o.Stack = name
+		o.Tick = step.Tick
+		opts[step.Tick] = o
+		commands[step.Tick] = command
+	}
+
+	tasks, err := mgr.ListTasks()
+	if err != nil {
+		return err
+	}
+
+	for _, step := range order {
+		timeout := timeouts[step.Tick]
+		if t := running(tasks, name, step.Tick); t != nil {
+			progress(fmt.Sprintf("%s already running (task %d)", step.Tick, t.ID))
+			if step.OneShot {
+				if err := waitForExit(mgr, t.ID, timeout); err != nil {
+					return fmt.Errorf("%s: %w", step.Tick, err)
+				}
+			} else if st.hasDependents(step.Tick) && t.Options.Ready != nil {
+				if _, err := task.WaitReady(mgr, t.ID, timeout); err != nil {
+					return fmt.Errorf("%s: %w", step.Tick, err)
+				}
+			}
+			continue
+		}
+
+		id, err := mgr.StartTask(step.Tick, commands[step.Tick], opts[step.Tick])
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.Tick, err)
+		}
+		progress(fmt.Sprintf("started %s (task %d)", step.Tick, id))
+
+		if step.OneShot {
+			if err := waitForExit(mgr, int(id), timeout); err != nil {
+				return fmt.Errorf("%s: %w", step.Tick, err)
+			}
+			progress(fmt.Sprintf("%s finished", step.Tick))
+		} else if st.hasDependents(step.Tick) && opts[step.Tick].Ready != nil {
+			start := time.Now()
+			if _, err := task.WaitReady(mgr, int(id), timeout); err != nil {
+				return fmt.Errorf("%s: %w", step.Tick, err)
+			}
+			progress(fmt.Sprintf("%s ready (%s)", step.Tick, time.Since(start).Round(100*time.Millisecond)))
+		} else if st.hasDependents(step.Tick) {
+			if err := waitForSettle(mgr, int(id)); err != nil {
+				return fmt.Errorf("%s: %w", step.Tick, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Down stops the stack's running tasks in reverse dependency order. Tasks
+// from steps no longer in the stack are stopped first.
+func Down(mgr task.Controller, name string, st Stack, progress func(string)) error {
+	order, err := st.Order()
+	if err != nil {
+		return err
+	}
+
+	tasks, err := mgr.ListTasks()
+	if err != nil {
+		return err
+	}
+
+	inStack := make(map[string]bool, len(order))
+	for _, step := range order {
+		inStack[step.Tick] = true
+	}
+	var stray []*task.Task
+	for _, t := range tasks {
+		if t.Options.Stack == name && !inStack[t.Name] && isUp(t) {
+			stray = append(stray, t)
+		}
+	}
+
+	stop := func(t *task.Task) error {
+		if err := mgr.StopTask(t.ID, task.StopOptions{Reason: task.ReasonUserStop}); err != nil {
+			return fmt.Errorf("%s: %w", t.Name, err)
+		}
+		progress(fmt.Sprintf("stopped %s (task %d)", t.Name, t.ID))
+		return nil
+	}
+
+	for _, t := range stray {
+		if err := stop(t); err != nil {
+			return err
+		}
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		for _, t := range tasks {
+			if t.Options.Stack == name && t.Name == order[i].Tick && isUp(t) {
+				if err := stop(t); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isUp reports whether a task is running or about to be restarted
+func isUp(t *task.Task) bool {
+	return t.Alive() || t.Status == "restarting"
+}
+
+// running returns the stack's live task for a tick, if any
+func running(tasks []*task.Task, stackName, tickName string) *task.Task {
+	for _, t := range tasks {
+		if t.Options.Stack == stackName && t.Name == tickName && isUp(t) {
+			return t
+		}
+	}
+	return nil
+}
+
+// waitForExit waits up to timeout for a one-shot step to finish and checks
+// it exited 0
+func waitForExit(mgr task.Controller, id int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		t, err := mgr.GetTask(id)
+		if err != nil {
+			return err
+		}
+		if !isUp(t) {
+			if t.ExitCode != nil && *t.ExitCode == 0 {
+				return nil
+			}
+			if summary := t.ExitSummary(); summary != "" {
+				return fmt.Errorf("failed (%s); see watchy logs %d", summary, id)
+			}
+			return fmt.Errorf("failed (%s); see watchy logs %d", t.Status, id)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("still running after %s (task %d); set a longer wait with watchy stack add --wait-timeout", timeout, id)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// waitForSettle checks that a long-running step is still running after
+// settleTime
+func waitForSettle(mgr task.Controller, id int) error {
+	deadline := time.Now().Add(settleTime)
+	for {
+		t, err := mgr.GetTask(id)
+		if err != nil {
+			return err
+		}
+		if !t.Alive() {
+			if summary := t.ExitSummary(); summary != "" {
+				return fmt.Errorf("exited during startup (%s); see watchy logs %d", summary, id)
+			}
+			return fmt.Errorf("exited during startup; see watchy logs %d", id)
+		}
+		if time.Now().After(deadline) {
+			return nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
@@ -0,0 +1,274 @@
+package stack
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/parth/watchy/internal/atomicfile"
+	"github.com/parth/watchy/internal/tick"
+)
+
+// DefaultWaitTimeout is how long watchy up waits for a step to exit or
+// become ready when the step doesn't set wait_timeout
+const DefaultWaitTimeout = 10 * time.Minute
+
+// Step is one tick in a stack
+type Step struct {
+	Tick        string   `json:"tick"`
+	DependsOn   []string `json:"depends_on,omitempty"`   // ticks that must be up before this one starts
+	OneShot     bool     `json:"oneshot,omitempty"`      // runs to completion; dependents wait for exit 0
+	WaitTimeout string   `json:"wait_timeout,omitempty"` // how long to wait for it to exit or become ready, e.g. "5m"
+}
+
+// waitTimeout returns how long watchy up waits for the step
+func (s Step) waitTimeout() (time.Duration, error) {
+	if s.WaitTimeout == "" {
+		return DefaultWaitTimeout, nil
+	}
+	d, err := time.ParseDuration(s.WaitTimeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("step %q: invalid wait_timeout %q", s.Tick, s.WaitTimeout)
+	}
+	return d, nil
+}
+
+// Stack is a named group of ticks started together in dependency order
+type Stack struct {
+	Description string    `json:"description,omitempty"`
+	Steps       []Step    `json:"steps"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// NamedStack pairs a stack name with its data
+type NamedStack struct {
+	Name  string
+	Stack Stack
+}
+
+// Store manages the collection of stacks
+type Store struct {
+	path   string
+	stacks map[string]Stack
+}
+
+// NewStore creates a Store for the given JSON file path, loading existing stacks if the file exists.
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:   path,
+		stacks: make(map[string]Stack),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, &s.stacks)
+}
+
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.stacks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(s.path, data, 0644)
+}
+
+// AddStep adds a step to a stack, creating the stack if needed. A step for
+// the same tick replaces the existing one.
+func (s *Store) AddStep(name string, step Step) error {
+	if !tick.ValidName(name) {
+		return fmt.Errorf("invalid stack name %q (use alphanumeric, dash, or underscore)", name)
+	}
+	if _, err := step.waitTimeout(); err != nil {
+		return err
+	}
+
+	st, ok := s.stacks[name]
+	if !ok {
+		st.CreatedAt = time.Now()
+	}
+	replaced := false
+	for i := range st.Steps {
+		if st.Steps[i].Tick == step.Tick {
+			st.Steps[i] = step
+			replaced = true
+		}
+	}
+	if !replaced {
+		st.Steps = append(st.Steps, step)
+	}
+	if _, err := st.Order(); err != nil {
+		return err
+	}
+
+	s.stacks[name] = st
+	return s.save()
+}
+
+// RemoveStep removes a tick from a stack. Returns error if the stack or step
+// doesn't exist, or if another step still depends on it.
+func (s *Store) RemoveStep(name, tickName string) error {
+	st, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+
+	var steps []Step
+	for _, step := range st.Steps {
+		if step.Tick == tickName {
+			continue
+		}
+		for _, dep := range step.DependsOn {
+			if dep == tickName {
+				return fmt.Errorf("%q depends on %q", step.Tick, tickName)
+			}
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == len(st.Steps) {
+		return fmt.Errorf("stack %q has no step %q", name, tickName)
+	}
+
+	st.Steps = steps
+	s.stacks[name] = st
+	return s.save()
+}
+
+// RenameTick updates the steps and dependencies that refer to a renamed
+// tick. Returns the names of the stacks that changed.
+func (s *Store) RenameTick(oldName, newName string) ([]string, error) {
+	var changed []string
+	for name, st := range s.stacks {
+		found := false
+		for i := range st.Steps {
+			if st.Steps[i].Tick == oldName {
+				st.Steps[i].Tick = newName
+				found = true
+			}
+			for j, dep := range st.Steps[i].DependsOn {
+				if dep == oldName {
+					st.Steps[i].DependsOn[j] = newName
+					found = true
+				}
+			}
+		}
+		if found {
+			s.stacks[name] = st
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	sort.Strings(changed)
+	return changed, s.save()
+}
+
+// Get returns a stack by name, or an error if not found.
+func (s *Store) Get(name string) (Stack, error) {
+	st, ok := s.stacks[name]
+	if !ok {
+		return Stack{}, fmt.Errorf("stack %q not found", name)
+	}
+	return st, nil
+}
+
+// Remove deletes a stack by name. Returns error if not found.
+func (s *Store) Remove(name string) error {
+	if _, ok := s.stacks[name]; !ok {
+		return fmt.Errorf("stack %q not found", name)
+	}
+	delete(s.stacks, name)
+	return s.save()
+}
+
+// List returns all stacks sorted by name.
+func (s *Store) List() []NamedStack {
+	result := make([]NamedStack, 0, len(s.stacks))
+	for name, st := range s.stacks {
+		result = append(result, NamedStack{Name: name, Stack: st})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Order returns the steps in start order, each after everything it depends
+// on. Steps that don't depend on each other keep their order in the stack.
+func (st Stack) Order() ([]Step, error) {
+	index := make(map[string]int, len(st.Steps))
+	for i, step := range st.Steps {
+		index[step.Tick] = i
+	}
+	for _, step := range st.Steps {
+		for _, dep := range step.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("%q depends on %q, which isn't in the stack", step.Tick, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(st.Steps))
+	var order []Step
+	var path []string
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		step := st.Steps[i]
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path, " -> "), step.Tick)
+		}
+		state[i] = visiting
+		path = append(path, step.Tick)
+		for _, dep := range step.DependsOn {
+			if err := visit(index[dep]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = done
+		order = append(order, step)
+		return nil
+	}
+
+	for i := range st.Steps {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// hasDependents reports whether any step depends on tickName
+func (st Stack) hasDependents(tickName string) bool {
+	for _, step := range st.Steps {
+		for _, dep := range step.DependsOn {
+			if dep == tickName {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,288 @@
+package stack
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/parth/watchy/internal/task"
+	"github.com/parth/watchy/internal/tick"
+)
+
+// fakeController runs tasks instantly: a command of "true" exits 0 and
+// "false" exits 1 as soon as it starts, anything else runs until stopped
+type fakeController struct {
+	task.Controller
+
+	mu      sync.Mutex
+	tasks   []*task.Task
+	started []string
+	stopped []string
+}
+
+func (c *fakeController) StartTask(name, command string, opts task.StartOptions) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &task.Task{ID: len(c.tasks) + 1, Name: name, Command: command, Status: "running", Options: opts}
+	if command == "true" || command == "false" {
+		code := 0
+		if command == "false" {
+			code = 1
+		}
+		t.Status = "stopped"
+		t.ExitCode = &code
+	}
+	c.tasks = append(c.tasks, t)
+	c.started = append(c.started, name)
+	return int64(t.ID), nil
+}
+
+func (c *fakeController) StopTask(id int, opts task.StopOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.tasks[id-1]
+	t.Status = "stopped"
+	c.stopped = append(c.stopped, t.Name)
+	return nil
+}
+
+func (c *fakeController) GetTask(id int) (*task.Task, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id < 1 || id > len(c.tasks) {
+		return nil, fmt.Errorf("task %d not found", id)
+	}
+	t := *c.tasks[id-1]
+	return &t, nil
+}
+
+func (c *fakeController) ListTasks() ([]*task.Task, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var tasks []*task.Task
+	for _, t := range c.tasks {
+		snapshot := *t
+		tasks = append(tasks, &snapshot)
+	}
+	return tasks, nil
+}
+
+// newTicks creates a tick store with a tick for each name=command
+func newTicks(t *testing.T, ticks ...string) *tick.Store {
+	t.Helper()
+	store, err := tick.NewStore(filepath.Join(t.TempDir(), "ticks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, nc := range ticks {
+		name, command, _ := strings.Cut(nc, "=")
+		if err := store.Save(name, command, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func stepNames(steps []Step) string {
+	names := make([]string, len(steps))
+	for i, s := range steps {
+		names[i] = s.Tick
+	}
+	return strings.Join(names, " ")
+}
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []Step
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "no dependencies keep their order",
+			steps: []Step{{Tick: "c"}, {Tick: "a"}, {Tick: "b"}},
+			want:  "c a b",
+		},
+		{
+			name: "dependencies first",
+			steps: []Step{
+				{Tick: "web", DependsOn: []string{"api"}},
+				{Tick: "api", DependsOn: []string{"db", "migrate"}},
+				{Tick: "migrate", DependsOn: []string{"db"}},
+				{Tick: "db"},
+			},
+			want: "db migrate api web",
+		},
+		{
+			name: "shared dependency once",
+			steps: []Step{
+				{Tick: "a", DependsOn: []string{"db"}},
+				{Tick: "b", DependsOn: []string{"db"}},
+				{Tick: "db"},
+			},
+			want: "db a b",
+		},
+		{
+			name:    "missing dependency",
+			steps:   []Step{{Tick: "api", DependsOn: []string{"db"}}},
+			wantErr: `"api" depends on "db", which isn't in the stack`,
+		},
+		{
+			name:    "self",
+			steps:   []Step{{Tick: "a", DependsOn: []string{"a"}}},
+			wantErr: "dependency cycle: a -> a",
+		},
+		{
+			name: "cycle",
+			steps: []Step{
+				{Tick: "a", DependsOn: []string{"b"}},
+				{Tick: "b", DependsOn: []string{"c"}},
+				{Tick: "c", DependsOn: []string{"a"}},
+			},
+			wantErr: "dependency cycle: a -> b -> c -> a",
+		},
+		{
+			name: "cycle behind a dependency",
+			steps: []Step{
+				{Tick: "web", DependsOn: []string{"a"}},
+				{Tick: "a", DependsOn: []string{"b"}},
+				{Tick: "b", DependsOn: []string{"a"}},
+			},
+			wantErr: "dependency cycle: web -> a -> b -> a",
+		},
+	}
+	for _, tt := range tests {
+		order, err := Stack{Steps: tt.steps}.Order()
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: Order() error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || stepNames(order) != tt.want {
+			t.Errorf("%s: Order() = %q, %v, want %q", tt.name, stepNames(order), err, tt.want)
+		}
+	}
+}
+
+func TestAddStepRejectsCycle(t *testing.T) {
+	s, err := NewStore(filepath.Join(t.TempDir(), "stacks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []Step{{Tick: "a"}, {Tick: "b", DependsOn: []string{"a"}}} {
+		if err := s.AddStep("dev", step); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddStep("dev", Step{Tick: "a", DependsOn: []string{"b"}}); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("AddStep() making a cycle = %v", err)
+	}
+	if err := s.AddStep("dev", Step{Tick: "c", WaitTimeout: "soon"}); err == nil {
+		t.Error("AddStep() accepted an invalid wait_timeout")
+	}
+	if err := s.AddStep("no such/name", Step{Tick: "a"}); err == nil {
+		t.Error("AddStep() accepted an invalid stack name")
+	}
+
+	reloaded, err := NewStore(filepath.Join(filepath.Dir(s.path), "stacks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := reloaded.Get("dev")
+	if err != nil || stepNames(st.Steps) != "a b" || len(st.Steps[0].DependsOn) != 0 {
+		t.Errorf("saved stack = %+v, %v", st, err)
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	ticks := newTicks(t, "migrate=true", "worker=./worker", "web=./web", "other=./other")
+	st := Stack{Steps: []Step{
+		{Tick: "web", DependsOn: []string{"migrate"}},
+		{Tick: "worker", DependsOn: []string{"migrate"}},
+		{Tick: "migrate", OneShot: true},
+	}}
+	mgr := &fakeController{}
+	// A task of the same name outside the stack is left alone
+	if _, err := mgr.StartTask("web", "./web", task.StartOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []string
+	if err := Up(mgr, ticks, "dev", st, func(s string) { progress = append(progress, s) }); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(mgr.started, " "); got != "web migrate web worker" {
+		t.Errorf("started %s, want migrate first", got)
+	}
+	if progress[1] != "migrate finished" {
+		t.Errorf("progress = %q", progress)
+	}
+
+	// Running steps are left alone, and one-shot steps run again
+	mgr.started = nil
+	if err := Up(mgr, ticks, "dev", st, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(mgr.started, " "); got != "migrate" {
+		t.Errorf("second up started %q, want only migrate", got)
+	}
+
+	if err := Down(mgr, "dev", st, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(mgr.stopped, " "); got != "worker web" {
+		t.Errorf("stopped %s, want dependents in reverse order", got)
+	}
+	if outside, _ := mgr.GetTask(1); outside.Status != "running" {
+		t.Errorf("task outside the stack is %s", outside.Status)
+	}
+}
+
+func TestUpStopsAtFailure(t *testing.T) {
+	ticks := newTicks(t, "migrate=false", "web=./web")
+	st := Stack{Steps: []Step{
+		{Tick: "migrate", OneShot: true},
+		{Tick: "web", DependsOn: []string{"migrate"}},
+	}}
+	mgr := &fakeController{}
+
+	err := Up(mgr, ticks, "dev", st, func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "migrate: failed (exit 1)") {
+		t.Errorf("Up() error = %v, want migrate to fail", err)
+	}
+	if got := strings.Join(mgr.started, " "); got != "migrate" {
+		t.Errorf("started %s after the failure", got)
+	}
+}
+
+func TestUpWaitTimeout(t *testing.T) {
+	ticks := newTicks(t, "seed=./seed", "web=./web")
+	st := Stack{Steps: []Step{
+		{Tick: "seed", OneShot: true, WaitTimeout: "100ms"},
+		{Tick: "web", DependsOn: []string{"seed"}},
+	}}
+	mgr := &fakeController{}
+
+	start := time.Now()
+	err := Up(mgr, ticks, "dev", st, func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "still running after 100ms") {
+		t.Errorf("Up() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timed out after %s", elapsed)
+	}
+	if got := strings.Join(mgr.started, " "); got != "seed" {
+		t.Errorf("started %s after the timeout", got)
+	}
+
+	// An invalid timeout is caught before anything starts
+	st.Steps[0].WaitTimeout = "-1s"
+	mgr = &fakeController{}
+	if err := Up(mgr, ticks, "dev", st, func(string) {}); err == nil || len(mgr.started) != 0 {
+		t.Errorf("Up() with an invalid wait_timeout = %v, started %q", err, mgr.started)
+	}
+}
@@ -0,0 +1,188 @@
+package task
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ChatSession is a stored conversation with the agent
+type ChatSession struct {
+	ID           int
+	Title        string // the first question, shortened
+	Model        string // model of the latest reply
+	TaskID       int    // task the conversation was focused on; 0 for none
+	MessageCount int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Messages     []ChatMessage `json:",omitempty"` // only set by GetChatSession
+}
+
+// ChatMessage is a user question, agent reply or tool result in a
+// ChatSession. The system prompt isn't stored; it's rebuilt from the
+// current tasks when a session is resumed.
+type ChatMessage struct {
+	Role      string          // "user", "assistant" or "tool"
+	Content   string          `json:",omitempty"`
+	Thinking  string          `json:",omitempty"`
+	ToolCalls json.RawMessage `json:",omitempty"` // the assistant's tool calls, as sent by the model
+	ToolName  string          `json:",omitempty"` // the tool a result is from
+	Model     string          `json:",omitempty"` // the model that wrote an assistant message
+	CreatedAt time.Time
+}
+
+// CreateChatSession stores a new, empty session and returns its ID
+func (m *Manager) CreateChatSession(s ChatSession) (int, error) {
+	id, err := m.storage.CreateChatSession(s)
+	return int(id), err
+}
+
+// AppendChatMessages adds messages to a session and records the task it is
+// now focused on
+func (m *Manager) AppendChatMessages(id, taskID int, msgs []ChatMessage) error {
+	return m.storage.AppendChatMessages(id, taskID, msgs)
+}
+
+// ListChatSessions returns all sessions, most recently updated first,
+// without their messages
+func (m *Manager) ListChatSessions() ([]*ChatSession, error) {
+	return m.storage.ListChatSessions()
+}
+
+// GetChatSession returns a session with its messages
+func (m *Manager) GetChatSession(id int) (*ChatSession, error) {
+	return m.storage.GetChatSession(id)
+}
+
+// CreateChatSession inserts a session, created now unless cs.CreatedAt is set
+func (s *Storage) CreateChatSession(cs ChatSession) (int64, error) {
+	created := cs.CreatedAt
+	if created.IsZero() {
+		created = time.Now()
+	}
+	result, err := s.db.Exec(
+		`INSERT INTO chat_sessions (title, model, task_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+		cs.Title, cs.Model, nullInt(cs.TaskID), created.UnixMilli(), created.UnixMilli(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create chat session: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+// AppendChatMessages inserts messages into a session in one transaction
+func (s *Storage) AppendChatMessages(id, taskID int, msgs []ChatMessage) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	model := ""
+	for _, msg := range msgs {
+		at := msg.CreatedAt
+		if at.IsZero() {
+			at = time.Now()
+		}
+		_, err := tx.Exec(
+			`INSERT INTO chat_messages (session_id, role, content, thinking, tool_calls, tool_name, model, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, msg.Role, msg.Content, msg.Thinking, nullString(string(msg.ToolCalls)), nullString(msg.ToolName), nullString(msg.Model), at.UnixMilli(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to add chat message: %w", err)
+		}
+		if msg.Model != "" {
+			model = msg.Model
+		}
+	}
+
+	result, err := tx.Exec(
+		`UPDATE chat_sessions SET updated_at = ?, task_id = ?, model = COALESCE(NULLIF(?, ''), model) WHERE id = ?`,
+		time.Now().UnixMilli(), nullInt(taskID), model, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update chat session: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("chat session %d not found", id)
+	}
+	return tx.Commit()
+}
+
+const chatSessionColumns = `s.id, s.title, s.model, s.task_id, s.created_at, s.updated_at,
+	(SELECT COUNT(*) FROM chat_messages m WHERE m.session_id = s.id)`
+
+func scanChatSession(row interface{ Scan(...any) error }) (*ChatSession, error) {
+	var cs ChatSession
+	var taskID sql.NullInt64
+	var created, updated int64
+	if err := row.Scan(&cs.ID, &cs.Title, &cs.Model, &taskID, &created, &updated, &cs.MessageCount); err != nil {
+		return nil, err
+	}
+	cs.TaskID = int(taskID.Int64)
+	cs.CreatedAt = time.UnixMilli(created)
+	cs.UpdatedAt = time.UnixMilli(updated)
+	return &cs, nil
+}
+
+// ListChatSessions returns all sessions, most recently updated first
+func (s *Storage) ListChatSessions() ([]*ChatSession, error) {
+	rows, err := s.db.Query(`SELECT ` + chatSessionColumns + ` FROM chat_sessions s ORDER BY s.updated_at DESC, s.id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chat sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*ChatSession
+	for rows.Next() {
+		cs, err := scanChatSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan chat session: %w", err)
+		}
+		sessions = append(sessions, cs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chat sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// GetChatSession returns a session and its messages, oldest first
+func (s *Storage) GetChatSession(id int) (*ChatSession, error) {
+	cs, err := scanChatSession(s.db.QueryRow(`SELECT `+chatSessionColumns+` FROM chat_sessions s WHERE s.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("chat session %d not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat session: %w", err)
+	}
+
+	rows, err := s.db.Query(
+		`SELECT role, content, thinking, tool_calls, tool_name, model, created_at
+		 FROM chat_messages WHERE session_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chat messages: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msg ChatMessage
+		var toolCalls, toolName, model sql.NullString
+		var at int64
+		if err := rows.Scan(&msg.Role, &msg.Content, &msg.Thinking, &toolCalls, &toolName, &model, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan chat message: %w", err)
+		}
+		if toolCalls.Valid {
+			msg.ToolCalls = json.RawMessage(toolCalls.String)
+		}
+		msg.ToolName = toolName.String
+		msg.Model = model.String
+		msg.CreatedAt = time.UnixMilli(at)
+		cs.Messages = append(cs.Messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chat messages: %w", err)
+	}
+	return cs, nil
+}
@@ -0,0 +1,25 @@
+package task
+
+import "time"
+
+// Controller is the set of task operations used by the CLI, TUI and agent.
+// Manager implements it in-process; the watchyd client implements it by
+// forwarding each call to the daemon that owns the processes.
+type Controller interface {
+	StartTask(name, command string, opts StartOptions) (int64, error)
+	StopTask(id int, opts StopOptions) error
+	RestartTask(id int) (int64, error)
+	ListTasks() ([]*Task, error)
+	GetTask(id int) (*Task, error)
+	TailLogs(id int, lines int) ([]string, error)
+	TailLogLines(id int, lines int, filter LogFilter) ([]LogLine, error)
+	TaskMetrics(id int, since time.Time) ([]Metric, error)
+	TickRuns(tickName string, since time.Time) ([]*Task, error)
+	CreateChatSession(s ChatSession) (int, error)
+	AppendChatMessages(id, taskID int, msgs []ChatMessage) error
+	ListChatSessions() ([]*ChatSession, error)
+	GetChatSession(id int) (*ChatSession, error)
+	Cleanup(retentionDays int) (int, error)
+}
+
+var _ Controller = (*Manager)(nil)
@@ -0,0 +1,113 @@
+package task
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// LogFollower reads lines as they are appended to a task log, like tail -f.
+// When the log is rotated it finishes reading the old file and carries on
+// with the new one from the start.
+type LogFollower struct {
+	path    string
+	f       *os.File
+	partial []byte
+}
+
+// NewLogFollower starts following path from its current end. The log need
+// not exist yet.
+func NewLogFollower(path string) *LogFollower {
+	lf := &LogFollower{path: path}
+	if f, err := os.Open(path); err == nil {
+		f.Seek(0, io.SeekEnd)
+		lf.f = f
+	}
+	return lf
+}
+
+// Poll returns the complete lines written since the last call
+func (lf *LogFollower) Poll() ([]string, error) {
+	if lf.f == nil {
+		f, err := os.Open(lf.path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		lf.f = f
+	}
+
+	lines, err := lf.readLines()
+	if err != nil {
+		return lines, err
+	}
+
+	// A different file at our path means the log was rotated. Anything
+	// written to the old file before the rename has been read above.
+	if lf.rotated() {
+		f, err := os.Open(lf.path)
+		if err != nil {
+			return lines, nil
+		}
+		lf.f.Close()
+		lf.f = f
+		more, err := lf.readLines()
+		lines = append(lines, more...)
+		if err != nil {
+			return lines, err
+		}
+	}
+	return lines, nil
+}
+
+// Flush returns any trailing output that doesn't end in a newline. Call it
+// once the task has exited.
+func (lf *LogFollower) Flush() []string {
+	if len(lf.partial) == 0 {
+		return nil
+	}
+	line := string(lf.partial)
+	lf.partial = nil
+	return []string{line}
+}
+
+// Close closes the log file
+func (lf *LogFollower) Close() {
+	if lf.f != nil {
+		lf.f.Close()
+	}
+}
+
+func (lf *LogFollower) readLines() ([]string, error) {
+	data, err := io.ReadAll(lf.f)
+	if len(data) == 0 {
+		return nil, err
+	}
+
+	data = append(lf.partial, data...)
+	var lines []string
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, string(data[:i]))
+		data = data[i+1:]
+	}
+	lf.partial = append([]byte(nil), data...)
+	return lines, err
+}
+
+func (lf *LogFollower) rotated() bool {
+	cur, err := lf.f.Stat()
+	if err != nil {
+		return false
+	}
+	now, err := os.Stat(lf.path)
+	if err != nil {
+		return false
+	}
+	return !os.SameFile(cur, now)
+}
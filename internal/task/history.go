@@ -0,0 +1,87 @@
+package task
+
+import (
+	"slices"
+	"time"
+)
+
+// TickRuns returns the tasks started from a tick since the given time,
+// newest first
+func (m *Manager) TickRuns(tickName string, since time.Time) ([]*Task, error) {
+	return m.storage.ListTickRuns(tickName, since)
+}
+
+// RunStats summarizes a set of runs. Runs that were stopped (by a user, the
+// agent or a newer scheduled run) or lost count as neither success nor
+// failure, and only runs that finished on their own count towards the
+// durations.
+type RunStats struct {
+	Runs      int
+	Running   int
+	Succeeded int           // exited 0
+	Failed    int           // crashed, timed out or exited non-zero
+	Stopped   int           // stopped before finishing, or lost
+	P50       time.Duration // median duration of succeeded and failed runs
+	P95       time.Duration
+}
+
+// Stats computes RunStats for the given runs
+func Stats(runs []*Task) RunStats {
+	st := RunStats{Runs: len(runs)}
+	var durations []time.Duration
+	for _, t := range runs {
+		switch {
+		case t.Alive() || t.Status == "restarting":
+			st.Running++
+			continue
+		case t.TerminationReason == ReasonUserStop || t.TerminationReason == ReasonAgentStop ||
+			t.TerminationReason == ReasonReplaced || t.TerminationReason == ReasonLost:
+			st.Stopped++
+			continue
+		case t.Succeeded():
+			st.Succeeded++
+		default:
+			st.Failed++
+		}
+		if d, ok := t.Duration(); ok {
+			durations = append(durations, d)
+		}
+	}
+	st.P50 = percentile(durations, 50)
+	st.P95 = percentile(durations, 95)
+	return st
+}
+
+// SuccessRate is the share of succeeded runs among those that finished on
+// their own, from 0 to 1, or -1 if there are none
+func (st RunStats) SuccessRate() float64 {
+	if st.Succeeded+st.Failed == 0 {
+		return -1
+	}
+	return float64(st.Succeeded) / float64(st.Succeeded+st.Failed)
+}
+
+// Succeeded reports whether a finished task exited 0
+func (t *Task) Succeeded() bool {
+	return t.Status == "stopped" && t.ExitCode != nil && *t.ExitCode == 0 && t.Signal == ""
+}
+
+// Duration returns how long a finished task ran, including any automatic
+// restarts
+func (t *Task) Duration() (time.Duration, bool) {
+	if t.EndTime == nil {
+		return 0, false
+	}
+	return t.EndTime.Sub(t.CreatedAt), true
+}
+
+// percentile returns the p-th percentile of durations (nearest rank), or 0
+func percentile(durations []time.Duration, p int) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
@@ -0,0 +1,298 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// LimitsCommand is the hidden watchy subcommand that runs RunLimited.
+// Tasks with limits are started through it so the limits are in place
+// before the task's command runs.
+const LimitsCommand = "__run-limited"
+
+// cpuPeriod is the cgroup cpu.max period, in microseconds
+const cpuPeriod = 100000
+
+// Limits caps the resources a task may use. Zero fields are unlimited.
+//
+// Memory, CPUs and Pids are enforced by a cgroup v2 sub-tree when watchyd
+// can create one. Otherwise memory falls back to RLIMIT_AS, pids to
+// RLIMIT_NPROC (which counts all of the user's processes), and CPUs are
+// not enforced. NoFile is always an rlimit.
+type Limits struct {
+	Memory  int64         `json:"memory,omitempty"`  // bytes
+	CPUs    float64       `json:"cpus,omitempty"`    // cores, e.g. 0.5
+	Pids    int           `json:"pids,omitempty"`    // processes and threads
+	NoFile  int           `json:"nofile,omitempty"`  // open files per process
+	Timeout time.Duration `json:"timeout,omitempty"` // wall-clock run time since the task started, across restarts
+}
+
+// Validate checks that the limits are well formed
+func (l Limits) Validate() error {
+	if l.Memory < 0 || l.CPUs < 0 || l.Pids < 0 || l.NoFile < 0 || l.Timeout < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if l.CPUs > 0 && l.CPUs*cpuPeriod < 1000 {
+		return fmt.Errorf("cpu limit must be at least 0.01")
+	}
+	return nil
+}
+
+// IsZero reports whether no limits are set
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// spawned reports whether any limit has to be applied when the process
+// starts, rather than enforced by watching it
+func (l Limits) spawned() bool {
+	return l.Memory > 0 || l.CPUs > 0 || l.Pids > 0 || l.NoFile > 0
+}
+
+// String describes the limits, e.g. "memory 512M, cpus 1.5, timeout 15m0s"
+func (l Limits) String() string {
+	var parts []string
+	if l.Memory > 0 {
+		parts = append(parts, "memory "+FormatBytes(l.Memory))
+	}
+	if l.CPUs > 0 {
+		parts = append(parts, "cpus "+strconv.FormatFloat(l.CPUs, 'f', -1, 64))
+	}
+	if l.Pids > 0 {
+		parts = append(parts, fmt.Sprintf("pids %d", l.Pids))
+	}
+	if l.NoFile > 0 {
+		parts = append(parts, fmt.Sprintf("nofile %d", l.NoFile))
+	}
+	if l.Timeout > 0 {
+		parts = append(parts, "timeout "+l.Timeout.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// cgroupSetup finds the cgroup v2 directory watchyd runs in and enables the
+// memory, cpu and pids controllers for cgroups created under it. A cgroup
+// that has processes of its own can't hand controllers to its children
+// (unless it is the root), so watchyd first moves itself into a "watchyd"
+// leaf. Returns "" if cgroup v2 isn't mounted, the directory isn't writable,
+// or other processes share it; tasks then get rlimits instead.
+func cgroupSetup() string {
+	mount := cgroup2Mount()
+	if mount == "" {
+		return ""
+	}
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	var own string
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, "0::"); ok {
+			own = rest
+		}
+	}
+	if own == "" {
+		return ""
+	}
+	dir := filepath.Join(mount, own)
+
+	available, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return ""
+	}
+	var enable []string
+	for _, c := range strings.Fields(string(available)) {
+		if c == "memory" || c == "cpu" || c == "pids" {
+			enable = append(enable, "+"+c)
+		}
+	}
+	if len(enable) == 0 {
+		return ""
+	}
+
+	control := filepath.Join(dir, "cgroup.subtree_control")
+	if err := os.WriteFile(control, []byte(strings.Join(enable, " ")), 0644); err == nil {
+		return dir
+	}
+	leaf := filepath.Join(dir, "watchyd")
+	if err := os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+		return ""
+	}
+	if err := os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte("0"), 0644); err != nil {
+		return ""
+	}
+	if err := os.WriteFile(control, []byte(strings.Join(enable, " ")), 0644); err != nil {
+		return ""
+	}
+	return dir
+}
+
+// cgroup2Mount returns where the cgroup v2 hierarchy is mounted, or ""
+func cgroup2Mount() string {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// Optional fields end at "-", followed by the fs type
+		_, after, ok := strings.Cut(line, " - ")
+		if !ok || !strings.HasPrefix(after, "cgroup2 ") {
+			continue
+		}
+		if fields := strings.Fields(line); len(fields) > 4 {
+			return fields[4]
+		}
+	}
+	return ""
+}
+
+// cgroupFor returns the cgroup a task's process runs in, named after its log
+// file so every run of the task uses the same one
+func cgroupFor(tree, logPath string) string {
+	return filepath.Join(tree, "watchy-"+strings.TrimSuffix(filepath.Base(logPath), ".log"))
+}
+
+// createCgroup creates (or reuses) a task cgroup and writes its limits
+func createCgroup(dir string, l Limits) error {
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	settings := map[string]string{
+		"memory.max":       "max",
+		"memory.oom.group": "1", // an OOM kill takes the whole task down
+		"cpu.max":          fmt.Sprintf("max %d", cpuPeriod),
+		"pids.max":         "max",
+	}
+	if l.Memory > 0 {
+		settings["memory.max"] = strconv.FormatInt(l.Memory, 10)
+		settings["memory.swap.max"] = "0"
+	}
+	if l.CPUs > 0 {
+		settings["cpu.max"] = fmt.Sprintf("%d %d", int64(l.CPUs*cpuPeriod), cpuPeriod)
+	}
+	if l.Pids > 0 {
+		settings["pids.max"] = strconv.Itoa(l.Pids)
+	}
+	for file, value := range settings {
+		err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0644)
+		// memory.swap.max is missing without swap accounting
+		if err != nil && file != "memory.swap.max" {
+			return fmt.Errorf("failed to set %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// cgroupOOMKills returns how many processes in the cgroup the kernel OOM
+// killer has killed for exceeding memory.max
+func cgroupOOMKills(dir string) int {
+	data, err := os.ReadFile(filepath.Join(dir, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if n, ok := strings.CutPrefix(line, "oom_kill "); ok {
+			count, _ := strconv.Atoi(n)
+			return count
+		}
+	}
+	return 0
+}
+
+// limitedCommand returns the command that starts a task's shell with its
+// limits in place. cgroup is the cgroup to join, or "" to use rlimits.
+func (m *Manager) limitedCommand(shell, command, cgroup string, l Limits) (*exec.Cmd, error) {
+	if !l.spawned() {
+		return exec.Command(shell, "-c", command), nil
+	}
+	if m.exe == "" {
+		return nil, fmt.Errorf("resource limits need the watchy binary")
+	}
+	limitsJSON, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(m.exe, LimitsCommand, cgroup, string(limitsJSON), shell, "-c", command), nil
+}
+
+// RunLimited implements LimitsCommand. It moves itself into the cgroup in
+// args[0] (if not empty), sets the rlimits for the JSON Limits in args[1]
+// that the cgroup doesn't cover, and then execs the rest of args.
+func RunLimited(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: watchy %s <cgroup> <limits-json> <command>...", LimitsCommand)
+	}
+	cgroup := args[0]
+	var l Limits
+	if err := json.Unmarshal([]byte(args[1]), &l); err != nil {
+		return fmt.Errorf("invalid limits: %w", err)
+	}
+
+	rlimits := map[int]int64{}
+	if l.NoFile > 0 {
+		rlimits[unix.RLIMIT_NOFILE] = int64(l.NoFile)
+	}
+	if cgroup != "" {
+		if err := os.WriteFile(filepath.Join(cgroup, "cgroup.procs"), []byte("0"), 0644); err != nil {
+			return fmt.Errorf("failed to join cgroup: %w", err)
+		}
+	} else {
+		if l.Memory > 0 {
+			rlimits[unix.RLIMIT_AS] = l.Memory
+		}
+		if l.Pids > 0 {
+			rlimits[unix.RLIMIT_NPROC] = int64(l.Pids)
+		}
+	}
+	for resource, n := range rlimits {
+		lim := unix.Rlimit{Cur: uint64(n), Max: uint64(n)}
+		if err := unix.Setrlimit(resource, &lim); err != nil {
+			return fmt.Errorf("failed to set rlimit %d to %d: %w", resource, n, err)
+		}
+	}
+
+	path, err := exec.LookPath(args[2])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, args[2:], os.Environ())
+}
+
+// enforceTimeout stops a task once it has run for its wall-clock limit,
+// unless done is closed first. The deadline is set once, when the task
+// starts: a task restarted by its restart policy keeps it, so a crash
+// looping task can't run forever.
+func (m *Manager) enforceTimeout(id int, deadline time.Time, done <-chan struct{}) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+
+	task, err := m.storage.GetTask(id)
+	if err != nil || !(task.Running() || task.Status == "restarting") {
+		return
+	}
+	m.logNotice(task.LogPath, "timeout of %s reached; stopping", task.Options.Limits.Timeout)
+	m.StopTask(id, StopOptions{Reason: ReasonTimeout})
+}
+
+// Deadline returns when a task with a timeout will be stopped. Automatic
+// restarts don't extend it.
+func (t *Task) Deadline() (time.Time, bool) {
+	if t.Options.Limits.Timeout <= 0 {
+		return time.Time{}, false
+	}
+	return t.CreatedAt.Add(t.Options.Limits.Timeout), true
+}
@@ -0,0 +1,412 @@
+package task
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LogWriterCommand is the hidden watchy subcommand that runs RunLogWriter.
+// Tasks write into pipes read by this helper rather than by the daemon, so
+// their output keeps flowing while watchyd is restarted.
+const LogWriterCommand = "__log-writer"
+
+// LogOptions controls rotation of a task's log file. Once the live file
+// reaches MaxSize it is renamed to <log>.1, older segments shift up
+// (<log>.2, ...) and anything beyond MaxFiles segments is deleted.
+type LogOptions struct {
+	MaxSize  int64 `json:"max_size,omitempty"`  // bytes; 0 means the Manager default, negative means never rotate
+	MaxFiles int   `json:"max_files,omitempty"` // rotated segments to keep; 0 means the Manager default
+	Compress bool  `json:"compress,omitempty"`  // gzip rotated segments (<log>.N.gz)
+}
+
+// rotates reports whether the log should go through a LogWriter at all
+func (o LogOptions) rotates() bool {
+	return o.MaxSize > 0
+}
+
+// withDefaults fills unset fields from d
+func (o LogOptions) withDefaults(d LogOptions) LogOptions {
+	if o.MaxSize == 0 {
+		o.MaxSize = d.MaxSize
+	}
+	if o.MaxFiles == 0 {
+		o.MaxFiles = d.MaxFiles
+	}
+	if !o.Compress {
+		o.Compress = d.Compress
+	}
+	return o
+}
+
+// ParseSize parses a size such as "512", "64KB", "10M" or "1GB".
+// "0", "none" and "unlimited" return -1, meaning no limit.
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	switch s {
+	case "0", "NONE", "UNLIMITED":
+		return -1, nil
+	}
+
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{
+		{"GB", 1 << 30}, {"G", 1 << 30},
+		{"MB", 1 << 20}, {"M", 1 << 20},
+		{"KB", 1 << 10}, {"K", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			mult = u.mult
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 512KB, 50MB or 1GB)", s)
+	}
+	return n * mult, nil
+}
+
+// LogWriter is an io.Writer that appends to a log file and rotates it
+// according to LogOptions
+type LogWriter struct {
+	path string
+	opts LogOptions
+	f    *os.File
+	size int64
+}
+
+// NewLogWriter opens path for appending
+func NewLogWriter(path string, opts LogOptions) (*LogWriter, error) {
+	w := &LogWriter{path: path, opts: opts}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *LogWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f = f
+	w.size = info.Size()
+	return nil
+}
+
+// Write appends p, rotating whenever the file would grow past MaxSize.
+// Segments are split after a newline where possible, so lines only span
+// two segments when a single line is longer than MaxSize.
+func (w *LogWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if w.opts.rotates() {
+			room := w.opts.MaxSize - w.size
+			if int64(len(p)) > room {
+				if room > 0 {
+					chunk = p[:room]
+				} else {
+					chunk = nil
+				}
+				if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+					chunk = chunk[:i+1]
+				} else if w.size > 0 {
+					chunk = nil
+				}
+			}
+		}
+
+		if len(chunk) > 0 {
+			n, err := w.f.Write(chunk)
+			w.size += int64(n)
+			written += n
+			if err != nil {
+				return written, err
+			}
+			p = p[n:]
+		}
+		if len(p) > 0 {
+			if err := w.rotate(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close closes the live log file
+func (w *LogWriter) Close() error {
+	return w.f.Close()
+}
+
+func (w *LogWriter) rotate() error {
+	w.f.Close()
+
+	// Drop the oldest segment, then shift the rest up by one
+	os.Remove(segmentPath(w.path, w.opts.MaxFiles))
+	os.Remove(segmentPath(w.path, w.opts.MaxFiles) + ".gz")
+	for i := w.opts.MaxFiles - 1; i >= 1; i-- {
+		from := segmentPath(w.path, i)
+		if _, err := os.Stat(from); err == nil {
+			os.Rename(from, segmentPath(w.path, i+1))
+		} else if _, err := os.Stat(from + ".gz"); err == nil {
+			os.Rename(from+".gz", segmentPath(w.path, i+1)+".gz")
+		}
+	}
+
+	if w.opts.MaxFiles > 0 {
+		first := segmentPath(w.path, 1)
+		if err := os.Rename(w.path, first); err != nil {
+			return err
+		}
+		if w.opts.Compress {
+			if err := gzipFile(first); err != nil {
+				return err
+			}
+		}
+	} else {
+		os.Remove(w.path)
+	}
+
+	return w.open()
+}
+
+func segmentPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// gzipFile replaces path with path.gz
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// LogSegments returns the files making up a task log, oldest first. The live
+// file is always last, even if it doesn't exist yet.
+func LogSegments(path string) []string {
+	var rotated []string
+	for i := 1; ; i++ {
+		seg := segmentPath(path, i)
+		if _, err := os.Stat(seg); err == nil {
+			rotated = append(rotated, seg)
+		} else if _, err := os.Stat(seg + ".gz"); err == nil {
+			rotated = append(rotated, seg+".gz")
+		} else {
+			break
+		}
+	}
+
+	segments := make([]string, 0, len(rotated)+1)
+	for i := len(rotated) - 1; i >= 0; i-- {
+		segments = append(segments, rotated[i])
+	}
+	return append(segments, path)
+}
+
+// readSegment reads a whole log segment, decompressing .gz segments
+func readSegment(path string) ([]byte, error) {
+	if !strings.HasSuffix(path, ".gz") {
+		return os.ReadFile(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// tailChunk is how much of an uncompressed segment readLogTail reads at a
+// time, working back from the end
+const tailChunk = 64 * 1024
+
+// readLogTail reads a log backwards, newest segment first, prepending what
+// it reads until enough reports it has sufficient data. fresh is how many
+// bytes at the front of data were just added. Uncompressed segments are read
+// from the end in chunks, so a short tail of a huge log stays cheap.
+func readLogTail(path string, enough func(data []byte, fresh int) bool) ([]byte, error) {
+	segments := LogSegments(path)
+	var data []byte
+	for i := len(segments) - 1; i >= 0; i-- {
+		seg := segments[i]
+		if strings.HasSuffix(seg, ".gz") {
+			b, err := readSegment(seg)
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+			data = append(b, data...)
+			if enough(data, len(b)) {
+				return data, nil
+			}
+			continue
+		}
+
+		done, err := func() (bool, error) {
+			f, err := os.Open(seg)
+			if err != nil {
+				return false, err
+			}
+			defer f.Close()
+			info, err := f.Stat()
+			if err != nil {
+				return false, err
+			}
+			for off := info.Size(); off > 0; {
+				n := min(int64(tailChunk), off)
+				off -= n
+				chunk := make([]byte, n)
+				if _, err := f.ReadAt(chunk, off); err != nil && err != io.EOF {
+					return false, err
+				}
+				data = append(chunk, data...)
+				if enough(data, len(chunk)) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}()
+		if err != nil {
+			// A segment can be rotated away between listing and reading
+			if os.IsNotExist(err) && len(segments) > 1 {
+				continue
+			}
+			return nil, err
+		}
+		if done {
+			break
+		}
+	}
+	return data, nil
+}
+
+// TailLogFile returns the last n lines of a task log, reading back through
+// rotated segments as needed
+func TailLogFile(path string, n int) ([]string, error) {
+	newlines := 0
+	data, err := readLogTail(path, func(b []byte, fresh int) bool {
+		newlines += bytes.Count(b[:fresh], []byte("\n"))
+		return newlines > n
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// ReadLogTail returns up to the last maxBytes of a task log across rotated
+// segments, and whether anything earlier was left out
+func ReadLogTail(path string, maxBytes int) ([]byte, bool, error) {
+	data, err := readLogTail(path, func(b []byte, _ int) bool {
+		return len(b) > maxBytes
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) > maxBytes {
+		return data[len(data)-maxBytes:], true, nil
+	}
+	return data, false, nil
+}
+
+// RemoveLog deletes a task log, its stream log and all rotated segments
+func RemoveLog(path string) {
+	for _, seg := range LogSegments(path) {
+		os.Remove(seg)
+	}
+	for _, seg := range LogSegments(StreamLogPath(path)) {
+		os.Remove(seg)
+	}
+}
+
+// RunLogWriter implements LogWriterCommand. It records the task's stdout
+// (our stdin) and stderr (fd 3) into the plain log at args[0] and its stream
+// log, rotating both per the JSON LogOptions in args[1], until every writer
+// of the pipes has exited.
+func RunLogWriter(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: watchy %s <log-path> <options-json>", LogWriterCommand)
+	}
+	var opts LogOptions
+	if err := json.Unmarshal([]byte(args[1]), &opts); err != nil {
+		return fmt.Errorf("invalid log options: %w", err)
+	}
+
+	plain, err := NewLogWriter(args[0], opts)
+	if err != nil {
+		return err
+	}
+	defer plain.Close()
+
+	streams, err := NewLogWriter(StreamLogPath(args[0]), opts)
+	if err != nil {
+		return err
+	}
+	defer streams.Close()
+
+	rec := &streamRecorder{plain: plain, streams: streams}
+	stderr := os.NewFile(3, "stderr")
+	errc := make(chan error, 1)
+	go func() { errc <- rec.copy(stderr, StreamStderr) }()
+	err = rec.copy(os.Stdin, StreamStdout)
+	if serr := <-errc; err == nil {
+		err = serr
+	}
+	return err
+}
@@ -1,115 +1,537 @@
 package task
 
 import (
-	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 type Manager struct {
-	storage *Storage
-	logsDir string
+	storage     *Storage
+	logsDir     string
+	logDefaults LogOptions
+	exe         string // this binary, for running LogWriterCommand
+
+	mu    sync.Mutex
+	procs map[int]*proc
+
+	cgroupOnce sync.Once
+	cgroups    string // cgroup v2 directory task cgroups go under, "" if unavailable
+}
+
+// proc tracks a process started by this Manager
+type proc struct {
+	cmd     *exec.Cmd
+	started time.Time
+	opts    StartOptions  // as passed to StartTask, including Environ
+	done    chan struct{} // closed when watchProcess has recorded the final exit
+	exited  chan struct{} // closed when the current process exits; ends its readiness probe
+
+	// cgroup is the current process's cgroup if it has one, and oomKills
+	// the cgroup's OOM kill count when the process started
+	cgroup   string
+	oomKills int
+
+	// stopReason is set by StopTask before signalling, so watchProcess
+	// doesn't mistake the kill for a crash or restart the task
+	stopReason string
+
+	// quickFailures counts consecutive runs shorter than crashLoopMinUptime
+	quickFailures int
 }
 
 // NewManager creates a new task manager
 func NewManager(storage *Storage, logsDir string) *Manager {
+	exe, _ := os.Executable()
 	return &Manager{
 		storage: storage,
 		logsDir: logsDir,
+		exe:     exe,
+		procs:   make(map[int]*proc),
 	}
 }
 
+// SetLogDefaults sets the rotation settings used for tasks that don't
+// specify their own
+func (m *Manager) SetLogDefaults(opts LogOptions) {
+	m.logDefaults = opts
+}
+
 // StartTask starts a new background task
-func (m *Manager) StartTask(name, command string) (int64, error) {
+func (m *Manager) StartTask(name, command string, opts StartOptions) (int64, error) {
 	if command == "" {
 		return 0, fmt.Errorf("empty command")
 	}
+	if err := opts.Validate(); err != nil {
+		return 0, err
+	}
+	// Resolve defaults now so they're stored with the task and restarts
+	// rotate the same way
+	opts.Log = opts.Log.withDefaults(m.logDefaults)
 
-	// Create log file
+	if opts.Cwd != "" {
+		if info, err := os.Stat(opts.Cwd); err != nil || !info.IsDir() {
+			return 0, fmt.Errorf("working directory %s does not exist", opts.Cwd)
+		}
+	}
+	if _, err := exec.LookPath(opts.shell()); err != nil {
+		return 0, fmt.Errorf("shell %q not found", opts.shell())
+	}
+
+	// Create log file. The random suffix keeps tasks started in the same
+	// second from sharing one.
 	timestamp := time.Now().Format("20060102-150405")
-	logPath := filepath.Join(m.logsDir, fmt.Sprintf("task-%s.log", timestamp))
-	logFile, err := os.Create(logPath)
+	logFile, err := os.CreateTemp(m.logsDir, fmt.Sprintf("task-%s-*.log", timestamp))
 	if err != nil {
 		return 0, fmt.Errorf("failed to create log file: %w", err)
 	}
+	logPath := logFile.Name()
+	logFile.Close()
+
+	logs := probeLogs(logPath, opts)
+	cmd, cgroup, err := m.spawn(command, logPath, opts)
+	if err != nil {
+		if logs != nil {
+			logs.Close()
+		}
+		os.Remove(logPath)
+		return 0, err
+	}
+
+	pid := cmd.Process.Pid
+
+	// Save task to database
+	taskID, err := m.storage.CreateTask(name, command, pid, logPath, opts)
+	if err != nil {
+		// Try to kill the process if database save fails
+		syscall.Kill(-pid, syscall.SIGTERM)
+		if logs != nil {
+			logs.Close()
+		}
+		return 0, fmt.Errorf("failed to save task: %w", err)
+	}
+
+	p := &proc{cmd: cmd, started: time.Now(), opts: opts, done: make(chan struct{}), exited: make(chan struct{})}
+	p.setCgroup(cgroup)
+	m.mu.Lock()
+	m.procs[int(taskID)] = p
+	m.mu.Unlock()
+
+	// Start goroutine to wait for process completion
+	go m.watchProcess(int(taskID), p)
+	if opts.Ready != nil {
+		go m.watchReadiness(int(taskID), pid, logPath, "starting", newProber(opts, logs), p.exited)
+	}
+	if opts.Limits.Timeout > 0 {
+		go m.enforceTimeout(int(taskID), p.started.Add(opts.Limits.Timeout), p.done)
+	}
+
+	return taskID, nil
+}
+
+// spawn starts command in its own process group with output appended to
+// logPath and its limits applied. It returns the process's cgroup, or "" if
+// it wasn't given one.
+func (m *Manager) spawn(command, logPath string, opts StartOptions) (*exec.Cmd, string, error) {
+	env, err := opts.environment()
+	if err != nil {
+		return nil, "", err
+	}
+	cgroup := m.taskCgroup(logPath, opts.Limits)
+
+	// Run through a shell (bash by default) to handle complex commands
+	cmd, err := m.limitedCommand(opts.shell(), command, cgroup, opts.Limits)
+	if err != nil {
+		return nil, "", err
+	}
+
+	stdout, stderr, err := m.openLogOutput(logPath, opts.Log)
+	if err != nil {
+		return nil, "", err
+	}
+	// Close our handles; the process keeps its own
+	defer stdout.Close()
+	defer stderr.Close()
 
-	// Always run through bash -c to handle complex commands
-	cmd := exec.Command("bash", "-c", command)
+	cmd.Dir = opts.Cwd
+	cmd.Env = env
 
 	// Set process group to detach from parent
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
 	}
 
-	// Redirect stdout and stderr to log file
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
-	// Start the process
 	if err := cmd.Start(); err != nil {
-		logFile.Close()
-		return 0, fmt.Errorf("failed to start process: %w", err)
+		return nil, "", fmt.Errorf("failed to start process: %w", err)
 	}
 
-	pid := cmd.Process.Pid
+	return cmd, cgroup, nil
+}
 
-	// Save task to database
-	taskID, err := m.storage.CreateTask(name, command, pid, logPath)
+// taskCgroup sets up the cgroup for a task's next run, returning "" if its
+// limits don't need one or cgroups aren't available
+func (m *Manager) taskCgroup(logPath string, l Limits) string {
+	if l.Memory == 0 && l.CPUs == 0 && l.Pids == 0 {
+		return ""
+	}
+	m.cgroupOnce.Do(func() { m.cgroups = cgroupSetup() })
+
+	if m.cgroups != "" {
+		dir := cgroupFor(m.cgroups, logPath)
+		err := createCgroup(dir, l)
+		if err == nil {
+			return dir
+		}
+		m.logNotice(logPath, "%s; using rlimits instead", err)
+	}
+	if l.CPUs > 0 {
+		m.logNotice(logPath, "cgroup v2 is not available; the cpu limit is not enforced")
+	}
+	return ""
+}
+
+// setCgroup records the cgroup the process was started in
+func (p *proc) setCgroup(dir string) {
+	p.cgroup = dir
+	if dir != "" {
+		p.oomKills = cgroupOOMKills(dir)
+	}
+}
+
+// openLogOutput returns the files a task's stdout and stderr should go to.
+// Normally these are pipes drained by a LogWriterCommand helper, which
+// timestamps and rotates the logs; it runs in its own session so stop
+// signals don't reach it, and exits once the task and all of its children
+// have closed the pipes. Without a helper binary both go straight to the log.
+func (m *Manager) openLogOutput(logPath string, opts LogOptions) (stdout, stderr *os.File, err error) {
+	if m.exe == "" {
+		f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create log file: %w", err)
+		}
+		return f, f, nil
+	}
+
+	optsJSON, err := json.Marshal(opts)
 	if err != nil {
-		// Try to kill the process if database save fails
-		syscall.Kill(-pid, syscall.SIGTERM)
-		logFile.Close()
-		return 0, fmt.Errorf("failed to save task: %w", err)
+		return nil, nil, err
 	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create log pipe: %w", err)
+	}
+	defer outR.Close()
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		outW.Close()
+		return nil, nil, fmt.Errorf("failed to create log pipe: %w", err)
+	}
+	defer errR.Close()
+
+	writer := exec.Command(m.exe, LogWriterCommand, logPath, string(optsJSON))
+	writer.Stdin = outR
+	writer.ExtraFiles = []*os.File{errR} // fd 3
+	writer.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := writer.Start(); err != nil {
+		outW.Close()
+		errW.Close()
+		return nil, nil, fmt.Errorf("failed to start log writer: %w", err)
+	}
+	go writer.Wait()
 
-	// Close log file handle (process keeps it open)
-	logFile.Close()
+	return outW, errW, nil
+}
 
-	// Start goroutine to wait for process completion
-	go m.watchProcess(int(taskID), cmd)
+// watchProcess waits for a process to complete, restarts it if the task's
+// restart policy says so, and otherwise records how it ended
+func (m *Manager) watchProcess(taskID int, p *proc) {
+	defer close(p.done)
 
-	return taskID, nil
+	for {
+		p.cmd.Wait()
+		uptime := time.Since(p.started)
+
+		m.mu.Lock()
+		stopReason := p.stopReason
+		close(p.exited)
+		m.mu.Unlock()
+
+		status, exitCode, signal, reason := exitStatus(p.cmd.ProcessState)
+		if p.cgroup != "" {
+			if cgroupOOMKills(p.cgroup) > p.oomKills {
+				reason = ReasonMemoryLimit
+			}
+			// Fails if something the task started outlived it
+			os.Remove(p.cgroup)
+		}
+		if stopReason != "" {
+			status = stoppedStatus(stopReason)
+			reason = stopReason
+		}
+
+		if stopReason == "" && m.scheduleRestart(taskID, p, status, exitCode, signal, uptime, &reason) {
+			continue
+		}
+
+		m.mu.Lock()
+		delete(m.procs, taskID)
+		stoppedDuringBackoff := stopReason == "" && p.stopReason != ""
+		m.mu.Unlock()
+
+		// StopTask already finished a task stopped while waiting to restart
+		if stoppedDuringBackoff {
+			return
+		}
+
+		m.storage.FinishTask(taskID, status, exitCode, signal, reason)
+		return
+	}
 }
 
-// watchProcess waits for a process to complete and updates status
-func (m *Manager) watchProcess(taskID int, cmd *exec.Cmd) {
-	err := cmd.Wait()
+// scheduleRestart applies the task's restart policy after its process
+// exited. It returns true once the process has been restarted (p is updated
+// in place), or false if the task should be finished. reason is updated if
+// the policy gives up because of a crash loop.
+func (m *Manager) scheduleRestart(taskID int, p *proc, status string, exitCode *int, signal string, uptime time.Duration, reason *string) bool {
+	task, err := m.storage.GetTask(taskID)
+	if err != nil || !task.Options.shouldRestart(status, task.RestartCount) {
+		return false
+	}
 
-	status := "stopped"
+	if uptime < crashLoopMinUptime {
+		p.quickFailures++
+	} else {
+		p.quickFailures = 0
+	}
+	if p.quickFailures >= crashLoopThreshold {
+		m.logNotice(task.LogPath, "exited %d times within %s of starting; giving up on restarts", p.quickFailures, crashLoopMinUptime)
+		*reason = ReasonCrashLoop
+		return false
+	}
+
+	delay := restartBackoff(p.quickFailures)
+	m.logNotice(task.LogPath, "process ended (%s); restarting in %s", describeExit(exitCode, signal), delay)
+	if err := m.storage.MarkRestarting(taskID, exitCode, signal); err != nil {
+		return false
+	}
+
+	time.Sleep(delay)
+
+	// The task may have been stopped while we were waiting
+	task, err = m.storage.GetTask(taskID)
+	if err != nil || task.Status != "restarting" {
+		return false
+	}
+
+	logs := probeLogs(task.LogPath, p.opts)
+	cmd, cgroup, err := m.spawn(task.Command, task.LogPath, p.opts)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() != 0 {
-			status = "crashed"
+		if logs != nil {
+			logs.Close()
 		}
+		m.logNotice(task.LogPath, "restart failed: %s", err)
+		return false
 	}
 
-	m.storage.UpdateTaskStatus(taskID, status)
+	m.mu.Lock()
+	p.cmd = cmd
+	p.started = time.Now()
+	p.exited = make(chan struct{})
+	p.setCgroup(cgroup)
+	m.mu.Unlock()
+
+	if err := m.storage.RecordRestart(taskID, cmd.Process.Pid, p.opts.initialStatus()); err != nil {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	if p.opts.Ready != nil {
+		go m.watchReadiness(taskID, cmd.Process.Pid, task.LogPath, "starting", newProber(p.opts, logs), p.exited)
+	}
+	return true
 }
 
-// StopTask stops a running task
-func (m *Manager) StopTask(id int) error {
+// exitStatus classifies a finished process into a task status, exit code,
+// signal name and termination reason
+func exitStatus(state *os.ProcessState) (status string, exitCode *int, signal, reason string) {
+	status = "crashed"
+	reason = ReasonExited
+
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		signal = unix.SignalName(ws.Signal())
+		reason = ReasonSignaled
+		if ws.Signal() == syscall.SIGKILL {
+			reason = ReasonKilled
+		}
+		return status, nil, signal, reason
+	}
+
+	code := state.ExitCode()
+	if code == 0 {
+		status = "stopped"
+	}
+	return status, &code, "", reason
+}
+
+func describeExit(exitCode *int, signal string) string {
+	if signal != "" {
+		return signal
+	}
+	if exitCode != nil {
+		return fmt.Sprintf("exit %d", *exitCode)
+	}
+	return "unknown"
+}
+
+// logNotice appends a watchy status line to a task's log so restarts are
+// visible alongside the task's own output
+func (m *Manager) logNotice(logPath, format string, args ...any) {
+	appendLogNotice(logPath, fmt.Sprintf(format, args...))
+}
+
+// StopTask gracefully stops a running task. It sends the stop signal to the
+// process group and waits up to the grace period for the process to exit
+// before sending SIGKILL; the task is "stopping" until the process is gone.
+// Stopping a task that is already stopping kills it immediately.
+func (m *Manager) StopTask(id int, opts StopOptions) error {
 	task, err := m.storage.GetTask(id)
 	if err != nil {
 		return err
 	}
 
-	if task.Status != "running" {
+	reason := opts.Reason
+	if reason == "" {
+		reason = ReasonUserStop
+	}
+
+	// A task waiting out its restart backoff has no process to signal;
+	// marking it stopped cancels the pending restart
+	if task.Status == "restarting" {
+		m.setStopReason(id, reason)
+		return m.storage.FinishTask(id, stoppedStatus(reason), task.ExitCode, task.Signal, reason)
+	}
+
+	if !task.Alive() {
 		return fmt.Errorf("task %d is not running (status: %s)", id, task.Status)
 	}
 
-	// Kill the process group (negative PID)
-	if err := syscall.Kill(-task.PID, syscall.SIGTERM); err != nil {
-		// If SIGTERM fails, try SIGKILL
-		if err := syscall.Kill(-task.PID, syscall.SIGKILL); err != nil {
-			return fmt.Errorf("failed to kill process: %w", err)
+	sig, timeout, err := stopSettings(task.Options, opts)
+	if err != nil {
+		return err
+	}
+	if task.Status == "stopping" {
+		sig, timeout = syscall.SIGKILL, 0
+	}
+
+	done := m.exitChan(id)
+	m.setStopReason(id, reason)
+	if live, err := m.storage.MarkStopping(id); err != nil || !live {
+		return err
+	}
+
+	// Signal the whole process group (negative PID)
+	if err := syscall.Kill(-task.PID, sig); err != nil && err != syscall.ESRCH {
+		m.setStopReason(id, "")
+		m.storage.UpdateTaskStatus(id, task.Status)
+		return fmt.Errorf("failed to signal process: %w", err)
+	}
+
+	if !m.waitForExit(done, task.PID, timeout) {
+		m.logNotice(task.LogPath, "still running %s after %s; sending SIGKILL", unix.SignalName(sig), timeout)
+		syscall.Kill(-task.PID, syscall.SIGKILL)
+		if !m.waitForExit(done, task.PID, killWait) {
+			return fmt.Errorf("task %d did not exit after SIGKILL", id)
 		}
 	}
 
-	// Update status
-	return m.storage.UpdateTaskStatus(id, "stopped")
+	// watchProcess records the exit of processes this Manager started;
+	// for anything else all we know is that it's gone
+	if done == nil {
+		return m.storage.FinishTask(id, stoppedStatus(reason), nil, "", reason)
+	}
+	return nil
+}
+
+// stoppedStatus is the final status of a task stopped for reason
+func stoppedStatus(reason string) string {
+	if reason == ReasonTimeout {
+		return "timed_out"
+	}
+	return "stopped"
+}
+
+// stopSettings resolves the signal and grace period for a stop request
+func stopSettings(task StartOptions, req StopOptions) (syscall.Signal, time.Duration, error) {
+	name := DefaultStopSignal
+	if task.StopSignal != "" {
+		name = task.StopSignal
+	}
+	if req.Signal != "" {
+		name = req.Signal
+	}
+	sig, err := ParseStopSignal(name)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	timeout := DefaultStopTimeout
+	if task.StopTimeout > 0 {
+		timeout = task.StopTimeout
+	}
+	if req.Timeout > 0 {
+		timeout = req.Timeout
+	}
+	return sig, timeout, nil
+}
+
+// exitChan returns a channel closed once the task's process has exited and
+// been recorded, or nil if this Manager didn't start it
+func (m *Manager) exitChan(id int) <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.procs[id]; ok {
+		return p.done
+	}
+	return nil
+}
+
+// waitForExit waits up to timeout for a process to exit, using done if we
+// own the process and polling the PID otherwise. Returns false on timeout.
+func (m *Manager) waitForExit(done <-chan struct{}, pid int, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	if done != nil {
+		select {
+		case <-done:
+			return true
+		case <-deadline:
+			return false
+		}
+	}
+
+	for m.CheckPID(pid) {
+		select {
+		case <-deadline:
+			return false
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return true
+}
+
+// setStopReason records why a task is being stopped, if this Manager owns its process
+func (m *Manager) setStopReason(id int, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.procs[id]; ok {
+		p.stopReason = reason
+	}
 }
 
 // ListTasks lists all tasks
@@ -122,35 +544,33 @@ func (m *Manager) GetTask(id int) (*Task, error) {
 	return m.storage.GetTask(id)
 }
 
-// TailLogs reads the last N lines from a task's log file
-func (m *Manager) TailLogs(id int, lines int) ([]string, error) {
+// TailLogs reads the last N lines from a task's log, including rotated segments
+func (m *Manager) TailLogs(id int, n int) ([]string, error) {
 	task, err := m.storage.GetTask(id)
 	if err != nil {
 		return nil, err
 	}
 
-	file, err := os.Open(task.LogPath)
+	lines, err := TailLogFile(task.LogPath, n)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open log file: %w", err)
+		return nil, fmt.Errorf("failed to read log file: %w", err)
 	}
-	defer file.Close()
+	return lines, nil
+}
 
-	// Read all lines
-	var allLines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		allLines = append(allLines, scanner.Text())
+// TailLogLines returns the last N lines of a task's output matching filter,
+// with the stream and time each line was written
+func (m *Manager) TailLogLines(id int, n int, filter LogFilter) ([]LogLine, error) {
+	task, err := m.storage.GetTask(id)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := scanner.Err(); err != nil {
+	lines, err := ReadLogLines(task.LogPath, n, filter)
+	if err != nil {
 		return nil, fmt.Errorf("failed to read log file: %w", err)
 	}
-
-	// Return last N lines
-	if len(allLines) <= lines {
-		return allLines, nil
-	}
-	return allLines[len(allLines)-lines:], nil
+	return lines, nil
 }
 
 // CheckPID checks if a PID is still running
@@ -174,7 +594,7 @@ func (m *Manager) Cleanup(retentionDays int) (int, error) {
 
 	count := 0
 	for _, t := range tasks {
-		os.Remove(t.LogPath)
+		RemoveLog(t.LogPath)
 		if err := m.storage.DeleteTask(t.ID); err != nil {
 			continue
 		}
@@ -192,9 +612,20 @@ func (m *Manager) SyncTaskStatus() error {
 	}
 
 	for _, task := range tasks {
-		if task.Status == "running" {
+		if task.Status == "restarting" {
+			m.storage.FinishTask(task.ID, "crashed", task.ExitCode, task.Signal, ReasonLost)
+		} else if task.Running() {
+			if !m.CheckPID(task.PID) {
+				m.storage.FinishTask(task.ID, "crashed", nil, "", ReasonLost)
+			} else if !m.owns(task.ID) {
+				go m.adopt(task)
+			}
+		} else if task.Status == "stopping" && !m.owns(task.ID) {
+			// Whoever was stopping it went away mid-stop; finish the job
 			if !m.CheckPID(task.PID) {
-				m.storage.UpdateTaskStatus(task.ID, "crashed")
+				m.storage.FinishTask(task.ID, "stopped", nil, "", ReasonLost)
+			} else {
+				go m.StopTask(task.ID, StopOptions{})
 			}
 		}
 	}
@@ -202,20 +633,62 @@ func (m *Manager) SyncTaskStatus() error {
 	return nil
 }
 
+// owns reports whether this Manager started the task's current process
+func (m *Manager) owns(id int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.procs[id]
+	return ok
+}
+
+// adopt watches a running task whose process was started by an earlier
+// watchy (e.g. before the daemon restarted), resuming its readiness probe
+// and timeout.
+// Its exit status can't be collected, so once the PID disappears the task
+// is marked lost.
+func (m *Manager) adopt(t *Task) {
+	id, pid := t.ID, t.PID
+	exited := make(chan struct{})
+	defer close(exited)
+	if t.Options.Ready != nil {
+		// Output written while no daemon was watching is missed, so a log
+		// probe that hadn't matched yet only sees new lines
+		go m.watchReadiness(id, pid, t.LogPath, t.Status, newProber(t.Options, probeLogs(t.LogPath, t.Options)), exited)
+	}
+	if deadline, ok := t.Deadline(); ok {
+		go m.enforceTimeout(id, deadline, exited)
+	}
+
+	for m.CheckPID(pid) {
+		time.Sleep(2 * time.Second)
+	}
+	if task, err := m.storage.GetTask(id); err == nil && task.Running() && task.PID == pid {
+		m.storage.FinishTask(id, "crashed", nil, "", ReasonLost)
+	}
+}
+
 // RestartTask restarts a stopped or crashed task with the same command
 func (m *Manager) RestartTask(id int) (int64, error) {
+	return m.RestartTaskWithEnv(id, nil)
+}
+
+// RestartTaskWithEnv is RestartTask with the environment the new process
+// should inherit (nil for the Manager's own)
+func (m *Manager) RestartTaskWithEnv(id int, environ []string) (int64, error) {
 	task, err := m.GetTask(id)
 	if err != nil {
 		return 0, err
 	}
 
 	// If task is running, stop it first
-	if task.Status == "running" {
-		if err := m.StopTask(id); err != nil {
+	if task.Alive() || task.Status == "restarting" {
+		if err := m.StopTask(id, StopOptions{Reason: ReasonUserStop}); err != nil {
 			return 0, fmt.Errorf("failed to stop running task: %w", err)
 		}
 	}
 
-	// Start a new task with the same name and command
-	return m.StartTask(task.Name, task.Command)
+	// Start a new task with the same name, command and options
+	opts := task.Options
+	opts.Environ = environ
+	return m.StartTask(task.Name, task.Command, opts)
 }
@@ -0,0 +1,101 @@
+package task
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMain runs the log writer when the manager starts it: the manager
+// runs it as its own executable, which here is the test binary
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == LogWriterCommand {
+		if err := RunLogWriter(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	dir := t.TempDir()
+	storage, err := NewStorage(filepath.Join(dir, "watchy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	logs := filepath.Join(dir, "logs")
+	if err := os.Mkdir(logs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(storage, logs)
+}
+
+// waitDone waits for a task to end and returns it
+func waitDone(t *testing.T, mgr *Manager, id int64, timeout time.Duration) *Task {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		task, err := mgr.GetTask(int(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !task.Alive() && task.Status != "restarting" {
+			return task
+		}
+		if time.Now().After(deadline) {
+			mgr.StopTask(int(id), StopOptions{})
+			t.Fatalf("task still %s after %s", task.Status, timeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	mgr := newTestManager(t)
+	start := time.Now()
+	id, err := mgr.StartTask("slow", "sleep 60", StartOptions{Limits: Limits{Timeout: 300 * time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := waitDone(t, mgr, id, 5*time.Second)
+	if task.Status != "timed_out" || task.TerminationReason != ReasonTimeout {
+		t.Errorf("task ended %s (%s), want timed_out", task.Status, task.TerminationReason)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("stopped after %s, before its timeout", elapsed)
+	}
+}
+
+func TestTimeoutCoversRestarts(t *testing.T) {
+	mgr := newTestManager(t)
+	// The first run fails at once and is restarted after a 1s backoff; the
+	// second would run for a minute
+	marker := filepath.Join(t.TempDir(), "ran")
+	command := fmt.Sprintf("if [ -e %[1]s ]; then sleep 60; else touch %[1]s; exit 1; fi", marker)
+	timeout := 2 * time.Second
+
+	start := time.Now()
+	id, err := mgr.StartTask("flaky", command, StartOptions{Restart: RestartOnFailure, Limits: Limits{Timeout: timeout}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := waitDone(t, mgr, id, 10*time.Second)
+	elapsed := time.Since(start)
+
+	if task.Status != "timed_out" || task.RestartCount != 1 {
+		t.Errorf("task ended %s after %d restarts, want timed_out after 1", task.Status, task.RestartCount)
+	}
+	// A deadline reset by the restart would only pass a second later
+	if elapsed > timeout+800*time.Millisecond {
+		t.Errorf("stopped after %s, want the restart to keep the %s deadline", elapsed, timeout)
+	}
+	if deadline, ok := task.Deadline(); !ok || !deadline.Equal(task.CreatedAt.Add(timeout)) {
+		t.Errorf("Deadline() = %s, %v, want %s after creation", deadline, ok, timeout)
+	}
+}
@@ -0,0 +1,185 @@
+package task
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// clockTicks is the kernel's USER_HZ, the unit of CPU times in /proc/<pid>/stat.
+// It is 100 on every Linux architecture Go supports.
+const clockTicks = 100
+
+// metricsPruneEvery is how often SampleMetrics drops samples past retention
+const metricsPruneEvery = time.Minute
+
+// Metric is one resource usage sample for a task's process group
+type Metric struct {
+	Time    time.Time
+	CPU     float64 // percent of one core, averaged since the previous sample
+	RSS     int64   // resident memory in bytes
+	Threads int
+	FDs     int // open file descriptors
+	Procs   int // processes in the group
+}
+
+// groupUsage is a task's process group as read from /proc at one instant
+type groupUsage struct {
+	at       time.Time
+	cpuTicks uint64 // user + system time of every process, in clockTicks
+	rss      int64
+	threads  int
+	fds      int
+	procs    int
+}
+
+// readGroupUsage sums the usage of every process in process group pgid.
+// Tasks run in their own group led by the task's PID.
+func readGroupUsage(pgid int) (groupUsage, error) {
+	u := groupUsage{at: time.Now()}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return u, err
+	}
+	pageSize := int64(unix.Getpagesize())
+
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			continue // exited since we listed /proc
+		}
+		// The command name is in parentheses and may contain spaces, so
+		// fields are counted from the last ')'. fields[0] is field 3 (state).
+		s := string(stat)
+		i := strings.LastIndexByte(s, ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(s[i+1:])
+		if len(fields) < 22 {
+			continue
+		}
+		if pgrp, _ := strconv.Atoi(fields[2]); pgrp != pgid {
+			continue
+		}
+
+		utime, _ := strconv.ParseUint(fields[11], 10, 64)
+		stime, _ := strconv.ParseUint(fields[12], 10, 64)
+		threads, _ := strconv.Atoi(fields[17])
+		rssPages, _ := strconv.ParseInt(fields[21], 10, 64)
+
+		u.cpuTicks += utime + stime
+		u.threads += threads
+		u.rss += rssPages * pageSize
+		u.procs++
+		if fds, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid)); err == nil {
+			u.fds += len(fds)
+		}
+	}
+
+	if u.procs == 0 {
+		return u, fmt.Errorf("no processes in group %d", pgid)
+	}
+	return u, nil
+}
+
+// metricSince turns two readings of the same group into a sample, with CPU
+// averaged over the time between them
+func metricSince(prev, cur groupUsage) Metric {
+	m := Metric{
+		Time:    cur.at,
+		RSS:     cur.rss,
+		Threads: cur.threads,
+		FDs:     cur.fds,
+		Procs:   cur.procs,
+	}
+	elapsed := cur.at.Sub(prev.at).Seconds()
+	// A process leaving the group takes its CPU time with it
+	if elapsed > 0 && cur.cpuTicks >= prev.cpuTicks {
+		m.CPU = float64(cur.cpuTicks-prev.cpuTicks) / clockTicks / elapsed * 100
+	}
+	return m
+}
+
+// SampleMetrics records the resource usage of every running task each
+// interval and drops samples older than retention, until stop is closed.
+// A task's first sample is taken one interval after it is first seen, since
+// CPU usage is measured between readings.
+func (m *Manager) SampleMetrics(interval, retention time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	type key struct{ id, pid int }
+	prev := make(map[key]groupUsage)
+	lastPrune := time.Time{}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		tasks, err := m.storage.ListTasks()
+		if err != nil {
+			continue
+		}
+		seen := make(map[key]groupUsage)
+		for _, t := range tasks {
+			if !t.Alive() {
+				continue
+			}
+			k := key{t.ID, t.PID}
+			cur, err := readGroupUsage(t.PID)
+			if err != nil {
+				continue
+			}
+			seen[k] = cur
+			if p, ok := prev[k]; ok {
+				m.storage.AddMetric(t.ID, metricSince(p, cur))
+			}
+		}
+		prev = seen
+
+		if time.Since(lastPrune) >= metricsPruneEvery {
+			m.storage.PruneMetrics(time.Now().Add(-retention))
+			lastPrune = time.Now()
+		}
+	}
+}
+
+// TaskMetrics returns a task's resource usage samples taken since the given
+// time, oldest first
+func (m *Manager) TaskMetrics(id int, since time.Time) ([]Metric, error) {
+	if _, err := m.storage.GetTask(id); err != nil {
+		return nil, err
+	}
+	return m.storage.ListMetrics(id, since)
+}
+
+// FormatBytes formats a byte count for display, e.g. "512K" or "1.5G"
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	v := float64(n) / float64(div)
+	suffix := "KMGT"[exp : exp+1]
+	if v < 10 {
+		return fmt.Sprintf("%.1f%s", v, suffix)
+	}
+	return fmt.Sprintf("%.0f%s", v, suffix)
+}
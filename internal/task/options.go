@@ -0,0 +1,231 @@
+package task
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Restart policies
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+const (
+	restartBackoffBase = time.Second
+	restartBackoffMax  = time.Minute
+
+	// A run shorter than crashLoopMinUptime counts as a quick failure.
+	// crashLoopThreshold quick failures in a row stop further restarts.
+	crashLoopMinUptime = 10 * time.Second
+	crashLoopThreshold = 5
+
+	// DefaultStopSignal and DefaultStopTimeout apply when neither the task
+	// nor the stop request says otherwise
+	DefaultStopSignal  = "SIGTERM"
+	DefaultStopTimeout = 10 * time.Second
+
+	// killWait is how long StopTask waits for a SIGKILLed group to be reaped
+	killWait = 5 * time.Second
+)
+
+// StartOptions configures how a task is launched and supervised.
+// It is stored with the task so restarts behave like the original start.
+type StartOptions struct {
+	Restart     string `json:"restart,omitempty"`      // RestartNever (default), RestartOnFailure or RestartAlways
+	MaxRestarts int    `json:"max_restarts,omitempty"` // 0 means no limit
+
+	// StopSignal is sent to the process group by StopTask (default SIGTERM).
+	// If the group is still alive after StopTimeout it gets SIGKILL.
+	StopSignal  string        `json:"stop_signal,omitempty"`
+	StopTimeout time.Duration `json:"stop_timeout,omitempty"`
+
+	// Cwd is the directory the command runs in. Empty means the current
+	// directory of the process running the Manager.
+	Cwd string `json:"cwd,omitempty"`
+
+	// Env holds KEY=VALUE overrides applied last, over the inherited
+	// environment and EnvFiles
+	Env []string `json:"env,omitempty"`
+
+	// EnvFiles are dotenv files read on every start, so edits take effect
+	// on restart. Relative paths are resolved against Cwd.
+	EnvFiles []string `json:"env_files,omitempty"`
+
+	// ClearEnv starts from an empty environment instead of the inherited
+	// one, keeping only PATH and HOME
+	ClearEnv bool `json:"clear_env,omitempty"`
+
+	// Shell runs the command as "<shell> -c <command>" (default bash)
+	Shell string `json:"shell,omitempty"`
+
+	// Ready is the task's readiness probe. Tasks without one count as
+	// ready as soon as they're running.
+	Ready *Probe `json:"ready,omitempty"`
+
+	// Limits caps the task's memory, CPU, processes, open files and run time
+	Limits Limits `json:"limits"`
+
+	// Stack is the stack this task was started for by "watchy up", if any
+	Stack string `json:"stack,omitempty"`
+
+	// Tick is the tick this task is a run of, if any. It is also kept in
+	// the tasks table for tick history.
+	Tick string `json:"tick,omitempty"`
+
+	// Log controls rotation of the task's log file. Unset fields take the
+	// Manager's defaults when the task starts.
+	Log LogOptions `json:"log"`
+
+	// Environ is the environment the command inherits, normally the
+	// caller's. It is not stored; nil means the Manager's own environment.
+	Environ []string `json:"-"`
+}
+
+// Validate checks that the options are well formed
+func (o StartOptions) Validate() error {
+	switch o.Restart {
+	case "", RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("invalid restart policy %q (use never, on-failure, or always)", o.Restart)
+	}
+	if o.MaxRestarts < 0 {
+		return fmt.Errorf("max restarts must not be negative")
+	}
+	if o.StopSignal != "" {
+		if _, err := ParseStopSignal(o.StopSignal); err != nil {
+			return err
+		}
+	}
+	if o.StopTimeout < 0 {
+		return fmt.Errorf("stop timeout must not be negative")
+	}
+	for _, kv := range o.Env {
+		if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+			return fmt.Errorf("invalid env %q (use KEY=VALUE)", kv)
+		}
+	}
+	if o.Ready != nil {
+		if err := o.Ready.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := o.Limits.Validate(); err != nil {
+		return err
+	}
+	if o.Log.MaxFiles < 0 {
+		return fmt.Errorf("log max files must not be negative")
+	}
+	return nil
+}
+
+// initialStatus is the status a freshly spawned process starts in
+func (o StartOptions) initialStatus() string {
+	if o.Ready != nil {
+		return "starting"
+	}
+	return "running"
+}
+
+// shell returns the shell the command runs under
+func (o StartOptions) shell() string {
+	if o.Shell == "" {
+		return "bash"
+	}
+	return o.Shell
+}
+
+// environment builds the command's environment: the inherited one (or just
+// PATH and HOME with ClearEnv), then each env file, then Env
+func (o StartOptions) environment() ([]string, error) {
+	base := o.Environ
+	if base == nil {
+		base = os.Environ()
+	}
+
+	var env []string
+	if o.ClearEnv {
+		for _, kv := range base {
+			if strings.HasPrefix(kv, "PATH=") || strings.HasPrefix(kv, "HOME=") {
+				env = append(env, kv)
+			}
+		}
+	} else {
+		env = append(env, base...)
+	}
+
+	for _, path := range o.EnvFiles {
+		if !filepath.IsAbs(path) && o.Cwd != "" {
+			path = filepath.Join(o.Cwd, path)
+		}
+		vars, err := LoadEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range vars {
+			env = setEnv(env, kv)
+		}
+	}
+
+	for _, kv := range o.Env {
+		env = setEnv(env, kv)
+	}
+	return env, nil
+}
+
+// StopOptions controls how StopTask ends a task. Zero values fall back to
+// the task's own StartOptions, then to the defaults.
+type StopOptions struct {
+	Reason  string // ReasonUserStop or ReasonAgentStop
+	Signal  string
+	Timeout time.Duration
+}
+
+// ParseStopSignal parses a signal name such as "INT", "sigterm" or "SIGQUIT".
+// Only signals that make sense for stopping a task are accepted.
+func ParseStopSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	switch name {
+	case "SIGINT", "SIGTERM", "SIGQUIT", "SIGHUP", "SIGKILL":
+		return unix.SignalNum(name), nil
+	}
+	return 0, fmt.Errorf("invalid stop signal %q (use INT, TERM, QUIT, HUP, or KILL)", name)
+}
+
+// shouldRestart reports whether a process that ended with the given status
+// should be restarted under these options
+func (o StartOptions) shouldRestart(status string, restarts int) bool {
+	if o.MaxRestarts > 0 && restarts >= o.MaxRestarts {
+		return false
+	}
+	switch o.Restart {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return status == "crashed"
+	}
+	return false
+}
+
+// restartBackoff returns how long to wait before the next restart, doubling
+// with each consecutive quick failure after the first
+func restartBackoff(quickFailures int) time.Duration {
+	d := restartBackoffBase
+	for i := 1; i < quickFailures && d < restartBackoffMax; i++ {
+		d *= 2
+	}
+	if d > restartBackoffMax {
+		d = restartBackoffMax
+	}
+	return d
+}
@@ -0,0 +1,336 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Readiness probe types
+const (
+	ProbeTCP  = "tcp"  // a TCP connection to Target succeeds
+	ProbeHTTP = "http" // GET Target returns 2xx
+	ProbeLog  = "log"  // the task writes a line matching the regex Target
+	ProbeCmd  = "cmd"  // the command Target exits 0
+)
+
+const (
+	defaultProbeInterval = time.Second
+	defaultProbeTimeout  = 2 * time.Second
+	defaultProbeFailures = 3
+	defaultProbeGrace    = time.Minute
+	probeOutputLimit     = 200 // bytes of cmd probe output kept in errors
+)
+
+// Probe is a readiness and health check. A task with a probe starts as
+// "starting" and becomes "ready" once a check passes. If it isn't ready
+// within Grace, or once ready fails FailureThreshold checks in a row, it is
+// "unhealthy" until a check passes again. Log probes only check readiness:
+// once the line has been seen the task stays ready.
+type Probe struct {
+	Type             string        `json:"type"`   // ProbeTCP, ProbeHTTP, ProbeLog or ProbeCmd
+	Target           string        `json:"target"` // address, URL, regex or command
+	Interval         time.Duration `json:"interval,omitempty"`
+	Timeout          time.Duration `json:"timeout,omitempty"` // per check
+	FailureThreshold int           `json:"failure_threshold,omitempty"`
+	Grace            time.Duration `json:"grace,omitempty"` // time allowed to become ready
+}
+
+// ParseProbe parses a probe spec: "tcp:<host:port>" (or "tcp::<port>" for
+// localhost), an http:// or https:// URL, "log:<regex>" or "cmd:<command>"
+func ParseProbe(spec string) (*Probe, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return &Probe{Type: ProbeHTTP, Target: spec}, nil
+	}
+	kind, target, ok := strings.Cut(spec, ":")
+	if !ok || target == "" {
+		return nil, fmt.Errorf("invalid ready probe %q (use tcp:<host:port>, an http:// URL, log:<regex> or cmd:<command>)", spec)
+	}
+	p := &Probe{Type: kind, Target: target}
+	if kind == ProbeTCP {
+		p.Target = strings.TrimPrefix(target, ":")
+		if !strings.Contains(p.Target, ":") {
+			p.Target = "localhost:" + p.Target
+		}
+	}
+	return p, p.Validate()
+}
+
+// String returns the probe in the form ParseProbe accepts
+func (p *Probe) String() string {
+	if p.Type == ProbeHTTP {
+		return p.Target
+	}
+	return p.Type + ":" + p.Target
+}
+
+// Validate checks that the probe is well formed
+func (p *Probe) Validate() error {
+	switch p.Type {
+	case ProbeTCP:
+		if _, _, err := net.SplitHostPort(p.Target); err != nil {
+			return fmt.Errorf("invalid tcp probe address %q: %w", p.Target, err)
+		}
+	case ProbeHTTP:
+		if !strings.HasPrefix(p.Target, "http://") && !strings.HasPrefix(p.Target, "https://") {
+			return fmt.Errorf("invalid http probe URL %q", p.Target)
+		}
+	case ProbeLog:
+		if _, err := regexp.Compile(p.Target); err != nil {
+			return fmt.Errorf("invalid log probe regex: %w", err)
+		}
+	case ProbeCmd:
+	default:
+		return fmt.Errorf("invalid ready probe type %q (use tcp, http, log, or cmd)", p.Type)
+	}
+	if p.Interval < 0 || p.Timeout < 0 || p.Grace < 0 {
+		return fmt.Errorf("ready probe durations must not be negative")
+	}
+	if p.FailureThreshold < 0 {
+		return fmt.Errorf("ready probe failure threshold must not be negative")
+	}
+	return nil
+}
+
+func (p *Probe) interval() time.Duration {
+	if p.Interval > 0 {
+		return p.Interval
+	}
+	return defaultProbeInterval
+}
+
+func (p *Probe) timeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return defaultProbeTimeout
+}
+
+func (p *Probe) failureThreshold() int {
+	if p.FailureThreshold > 0 {
+		return p.FailureThreshold
+	}
+	return defaultProbeFailures
+}
+
+func (p *Probe) grace() time.Duration {
+	if p.Grace > 0 {
+		return p.Grace
+	}
+	return defaultProbeGrace
+}
+
+// probeLogs starts following a task's log for a log probe, from its current
+// end. Call it before spawning the process so none of its output is missed.
+// Returns nil for other probes.
+func probeLogs(logPath string, opts StartOptions) *LogFollower {
+	if opts.Ready == nil || opts.Ready.Type != ProbeLog {
+		return nil
+	}
+	return NewLogFollower(logPath)
+}
+
+// prober runs one probe's checks. logs is only used by log probes.
+type prober struct {
+	probe *Probe
+	opts  StartOptions
+	re    *regexp.Regexp
+	logs  *LogFollower
+}
+
+func newProber(opts StartOptions, logs *LogFollower) *prober {
+	pr := &prober{probe: opts.Ready, opts: opts, logs: logs}
+	if opts.Ready.Type == ProbeLog {
+		pr.re = regexp.MustCompile(opts.Ready.Target)
+	}
+	return pr
+}
+
+// check runs a single check, returning nil if it passed
+func (pr *prober) check() error {
+	p := pr.probe
+	switch p.Type {
+	case ProbeTCP:
+		conn, err := net.DialTimeout("tcp", p.Target, p.timeout())
+		if err != nil {
+			return err
+		}
+		conn.Close()
+		return nil
+
+	case ProbeHTTP:
+		client := &http.Client{Timeout: p.timeout()}
+		resp, err := client.Get(p.Target)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("GET %s returned %s", p.Target, resp.Status)
+		}
+		return nil
+
+	case ProbeLog:
+		if pr.logs == nil {
+			return fmt.Errorf("no log to watch")
+		}
+		lines, err := pr.logs.Poll()
+		for _, l := range lines {
+			if pr.re.MatchString(l) {
+				return nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("no line matching %q yet", p.Target)
+
+	case ProbeCmd:
+		return pr.runCommand()
+	}
+	return fmt.Errorf("unknown probe type %q", p.Type)
+}
+
+// runCommand runs a cmd probe in the task's directory and environment,
+// killing its process group if it outlives the probe timeout
+func (pr *prober) runCommand() error {
+	env, err := pr.opts.environment()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pr.probe.timeout())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, pr.opts.shell(), "-c", pr.probe.Target)
+	cmd.Dir = pr.opts.Cwd
+	cmd.Env = env
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", pr.probe.timeout())
+	}
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if len(msg) > probeOutputLimit {
+			msg = msg[len(msg)-probeOutputLimit:]
+		}
+		if msg != "" {
+			return fmt.Errorf("%s: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// watchReadiness probes a task's current process until exited is closed,
+// moving the task between starting, ready and unhealthy as checks pass and
+// fail. status is the task's status when watching begins.
+func (m *Manager) watchReadiness(id, pid int, logPath, status string, pr *prober, exited <-chan struct{}) {
+	p := pr.probe
+	started := time.Now()
+	failures := 0
+	ticker := time.NewTicker(p.interval())
+	defer ticker.Stop()
+	if pr.logs != nil {
+		defer pr.logs.Close()
+	}
+
+	set := func(next, note string) bool {
+		if ok, err := m.storage.SetReadiness(id, pid, next); err != nil || !ok {
+			return false
+		}
+		status = next
+		m.logNotice(logPath, "%s", note)
+		return true
+	}
+
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+		}
+
+		err := pr.check()
+		if err == nil {
+			failures = 0
+			switch status {
+			case "starting":
+				if !set("ready", fmt.Sprintf("ready after %s (%s)", time.Since(started).Round(100*time.Millisecond), p)) {
+					return
+				}
+			case "unhealthy":
+				if !set("ready", fmt.Sprintf("healthy again (%s)", p)) {
+					return
+				}
+			}
+			// A log line can't "un-appear", so log probes stop here
+			if p.Type == ProbeLog {
+				return
+			}
+			continue
+		}
+
+		if status == "starting" && time.Since(started) < p.grace() {
+			continue
+		}
+		failures++
+		if failures < p.failureThreshold() || status == "unhealthy" {
+			continue
+		}
+
+		note := fmt.Sprintf("unhealthy: %s failed %d times: %s", p, failures, err)
+		if status == "starting" {
+			note = fmt.Sprintf("unhealthy: not ready after %s: %s", time.Since(started).Round(time.Second), err)
+		}
+		if !set("unhealthy", note) {
+			return
+		}
+	}
+}
+
+// WaitReady waits for a task to pass its readiness probe, returning the
+// task once it is ready. A task without a probe is ready once it's running.
+// It fails if the task becomes unhealthy or ends first, or after timeout
+// (zero waits for as long as it takes).
+func WaitReady(c Controller, id int, timeout time.Duration) (*Task, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		t, err := c.GetTask(id)
+		if err != nil {
+			return nil, err
+		}
+		switch t.Status {
+		case "ready", "running":
+			return t, nil
+		case "unhealthy":
+			return t, fmt.Errorf("task %d is unhealthy; see watchy logs %d", id, id)
+		case "starting", "restarting":
+		default:
+			if summary := t.ExitSummary(); summary != "" {
+				return t, fmt.Errorf("task %d ended (%s) before it was ready; see watchy logs %d", id, summary, id)
+			}
+			return t, fmt.Errorf("task %d is %s, not ready", id, t.Status)
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return t, fmt.Errorf("task %d not ready after %s", id, timeout)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
@@ -2,76 +2,557 @@ package task
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
 type Storage struct {
-	db *sql.DB
+	db   *sql.DB
+	path string
 }
 
 type Task struct {
-	ID        int
-	Name      string
-	Command   string
-	PID       int
-	Status    string // "running", "stopped", "crashed"
-	StartTime time.Time
-	EndTime   *time.Time
-	LogPath   string
-	CreatedAt time.Time
-}
-
-// NewStorage creates a new Storage instance and initializes the database
+	ID                int
+	Name              string
+	Command           string
+	PID               int
+	Status            string // "running" (or "starting", "ready", "unhealthy" with a probe), "restarting", "stopping", "stopped", "crashed", "timed_out"
+	StartTime         time.Time
+	EndTime           *time.Time
+	LogPath           string
+	CreatedAt         time.Time
+	ExitCode          *int   // nil until the process exits normally
+	Signal            string // e.g. "SIGSEGV" if the process was killed by a signal
+	TerminationReason string // one of the Reason* constants, empty while running
+	Options           StartOptions
+	RestartCount      int    // automatic restarts under the task's restart policy
+	TickName          string // the tick this task is a run of, if any (Options.Tick)
+}
+
+// Termination reasons recorded when a task ends
+const (
+	ReasonUserStop  = "user-stop"  // stopped from the CLI or TUI
+	ReasonAgentStop = "agent-stop" // stopped by the agent's stop_task tool
+	ReasonExited    = "exited"     // the process exited on its own
+	ReasonKilled    = "killed"     // SIGKILL from outside watchy (usually the OOM killer)
+	ReasonSignaled  = "signaled"   // any other fatal signal (SIGSEGV, SIGABRT, ...)
+	ReasonLost      = "lost"       // process was gone when watchy restarted
+	ReasonCrashLoop = "crash-loop" // restart policy gave up after repeated quick failures
+
+	ReasonTimeout     = "timeout"      // stopped after running for its timeout limit
+	ReasonMemoryLimit = "memory-limit" // OOM-killed for exceeding its memory limit
+	ReasonReplaced    = "replaced"     // stopped for a newer run of its scheduled tick
+)
+
+// Alive reports whether the task's process should still exist
+func (t *Task) Alive() bool {
+	return t.Running() || t.Status == "stopping"
+}
+
+// Running reports whether the task's process is up and not being stopped,
+// whatever its readiness
+func (t *Task) Running() bool {
+	switch t.Status {
+	case "running", "starting", "ready", "unhealthy":
+		return true
+	}
+	return false
+}
+
+// ExitSummary describes how a finished task ended, e.g. "exit 1" or "SIGSEGV".
+// Returns "" for tasks that are still running or whose exit status is unknown.
+func (t *Task) ExitSummary() string {
+	if t.Signal != "" {
+		return t.Signal
+	}
+	if t.ExitCode != nil {
+		return fmt.Sprintf("exit %d", *t.ExitCode)
+	}
+	return ""
+}
+
+// taskColumns is the column list used by every task SELECT, in scanTask order
+const taskColumns = `id, name, command, pid, status, start_time, end_time, log_path, created_at,
+	exit_code, signal, termination_reason, options, restart_count, tick_name`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTask(row rowScanner) (*Task, error) {
+	var t Task
+	var startTime, createdAt int64
+	var endTime, exitCode sql.NullInt64
+	var signal, reason, tickName sql.NullString
+	var options string
+
+	err := row.Scan(&t.ID, &t.Name, &t.Command, &t.PID, &t.Status, &startTime, &endTime, &t.LogPath, &createdAt,
+		&exitCode, &signal, &reason, &options, &t.RestartCount, &tickName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(options), &t.Options); err != nil {
+		return nil, fmt.Errorf("invalid options for task %d: %w", t.ID, err)
+	}
+
+	t.StartTime = time.Unix(startTime, 0)
+	t.CreatedAt = time.Unix(createdAt, 0)
+	if endTime.Valid {
+		et := time.Unix(endTime.Int64, 0)
+		t.EndTime = &et
+	}
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		t.ExitCode = &code
+	}
+	t.Signal = signal.String
+	t.TerminationReason = reason.String
+	t.TickName = tickName.String
+
+	return &t, nil
+}
+
+// NewStorage opens the database and applies any pending schema migrations,
+// backing up the existing file first.
 func NewStorage(dbPath string) (*Storage, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	s, err := OpenStorage(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := s.Migrate(); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// OpenStorage opens the database without touching its schema. Use it to
+// inspect or migrate a database explicitly; everything else should use NewStorage.
+func OpenStorage(dbPath string) (*Storage, error) {
+	// busy_timeout lets concurrent writers (e.g. several watchProcess
+	// goroutines finishing at once) wait for the lock instead of failing.
+	// _txlock=immediate makes two processes migrating at once serialize.
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	s := &Storage{db: db}
-	if err := s.initSchema(); err != nil {
+	return &Storage{db: db, path: dbPath}, nil
+}
+
+// OpenStorageReadOnly opens an existing database read-only, for inspecting
+// it without creating the file or writing to it.
+func OpenStorageReadOnly(dbPath string) (*Storage, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	u := url.URL{Scheme: "file", OmitHost: true, Path: dbPath, RawQuery: "mode=ro&_pragma=busy_timeout(5000)"}
+	db, err := sql.Open("sqlite", u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return &Storage{db: db, path: dbPath}, nil
+}
+
+// Migration is a single schema change. Migrations are applied in version
+// order, each in its own transaction, and recorded in the schema_version table.
+type Migration struct {
+	Version     int
+	Description string
+	up          func(tx *sql.Tx) error
+}
+
+// migrations is the full schema history. Never edit or reorder an entry
+// that has shipped; append a new one instead.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create tasks table",
+		up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS tasks (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				command TEXT NOT NULL,
+				pid INTEGER,
+				status TEXT CHECK(status IN ('running', 'stopped', 'crashed')) NOT NULL,
+				start_time INTEGER NOT NULL,
+				end_time INTEGER,
+				log_path TEXT NOT NULL,
+				created_at INTEGER NOT NULL
+			)`)
+			return err
+		},
+	},
+	{
+		Version:     2,
+		Description: "record exit code, signal and termination reason",
+		up: func(tx *sql.Tx) error {
+			// Earlier builds added these columns ad hoc, so some
+			// unversioned databases already have them.
+			for _, c := range []struct{ name, def string }{
+				{"exit_code", "INTEGER"},
+				{"signal", "TEXT"},
+				{"termination_reason", "TEXT"},
+			} {
+				if err := addColumnIfMissing(tx, "tasks", c.name, c.def); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     3,
+		Description: "add restart policies and restart counts",
+		up: func(tx *sql.Tx) error {
+			if err := addColumnIfMissing(tx, "tasks", "options", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+				return err
+			}
+			if err := addColumnIfMissing(tx, "tasks", "restart_count", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+				return err
+			}
+			return setStatusValues(tx, "running", "restarting", "stopped", "crashed")
+		},
+	},
+	{
+		Version:     4,
+		Description: "add stopping status for graceful stops",
+		up: func(tx *sql.Tx) error {
+			return setStatusValues(tx, "running", "restarting", "stopping", "stopped", "crashed")
+		},
+	},
+	{
+		Version:     5,
+		Description: "add starting, ready and unhealthy statuses for readiness probes",
+		up: func(tx *sql.Tx) error {
+			return setStatusValues(tx, "running", "starting", "ready", "unhealthy", "restarting", "stopping", "stopped", "crashed")
+		},
+	},
+	{
+		Version:     6,
+		Description: "create task_metrics table for resource usage samples",
+		up: func(tx *sql.Tx) error {
+			for _, stmt := range []string{
+				`CREATE TABLE IF NOT EXISTS task_metrics (
+					task_id INTEGER NOT NULL,
+					time INTEGER NOT NULL,
+					cpu REAL NOT NULL,
+					rss INTEGER NOT NULL,
+					threads INTEGER NOT NULL,
+					fds INTEGER NOT NULL,
+					procs INTEGER NOT NULL
+				)`,
+				`CREATE INDEX IF NOT EXISTS task_metrics_task_time ON task_metrics (task_id, time)`,
+				`CREATE INDEX IF NOT EXISTS task_metrics_time ON task_metrics (time)`,
+			} {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     7,
+		Description: "add timed_out status for tasks stopped by their timeout",
+		up: func(tx *sql.Tx) error {
+			return setStatusValues(tx, "running", "starting", "ready", "unhealthy", "restarting", "stopping", "stopped", "crashed", "timed_out")
+		},
+	},
+	{
+		Version:     8,
+		Description: "link tasks to the tick they were started from",
+		up: func(tx *sql.Tx) error {
+			if err := addColumnIfMissing(tx, "tasks", "tick_name", "TEXT"); err != nil {
+				return err
+			}
+			for _, stmt := range []string{
+				`CREATE INDEX IF NOT EXISTS tasks_tick_name ON tasks (tick_name, created_at)`,
+				// Stack steps were always named after their tick
+				`UPDATE tasks SET tick_name = name WHERE tick_name IS NULL AND json_extract(options, '$.stack') IS NOT NULL`,
+			} {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     9,
+		Description: "create chat_sessions and chat_messages tables for agent conversations",
+		up: func(tx *sql.Tx) error {
+			for _, stmt := range []string{
+				`CREATE TABLE IF NOT EXISTS chat_sessions (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					title TEXT NOT NULL,
+					model TEXT NOT NULL,
+					task_id INTEGER,
+					created_at INTEGER NOT NULL,
+					updated_at INTEGER NOT NULL
+				)`,
+				`CREATE TABLE IF NOT EXISTS chat_messages (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					session_id INTEGER NOT NULL,
+					role TEXT NOT NULL,
+					content TEXT NOT NULL,
+					thinking TEXT NOT NULL,
+					tool_calls TEXT,
+					tool_name TEXT,
+					model TEXT,
+					created_at INTEGER NOT NULL
+				)`,
+				`CREATE INDEX IF NOT EXISTS chat_messages_session ON chat_messages (session_id, id)`,
+				`CREATE INDEX IF NOT EXISTS chat_sessions_updated_at ON chat_sessions (updated_at)`,
+			} {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// LatestSchemaVersion is the version a fully migrated database is at
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the database's current schema version (0 if it has
+// never been migrated). It only reads the database.
+func (s *Storage) SchemaVersion() (int, error) {
+	exists, err := s.hasTable("schema_version")
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// PendingMigrations returns the migrations that have not been applied yet, in order
+func (s *Storage) PendingMigrations() ([]Migration, error) {
+	version, err := s.SchemaVersion()
+	if err != nil {
 		return nil, err
 	}
+	if version > LatestSchemaVersion() {
+		return nil, fmt.Errorf("database schema version %d is newer than this watchy supports (%d); upgrade watchy", version, LatestSchemaVersion())
+	}
 
-	return s, nil
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies all pending migrations. If the database already holds
+// data, it is copied to a backup file first; the backup path is returned
+// ("" if no backup was needed).
+func (s *Storage) Migrate() (backupPath string, applied []Migration, err error) {
+	pending, err := s.PendingMigrations()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(pending) == 0 {
+		return "", nil, nil
+	}
+
+	hasData, err := s.hasTable("tasks")
+	if err != nil {
+		return "", nil, err
+	}
+	if hasData {
+		backupPath, err = s.Backup(pending[0].Version - 1)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	if err := s.createSchemaVersionTable(); err != nil {
+		return backupPath, nil, err
+	}
+
+	for _, m := range pending {
+		if err := s.applyMigration(m); err != nil {
+			return backupPath, applied, err
+		}
+		applied = append(applied, m)
+	}
+
+	return backupPath, applied, nil
+}
+
+func (s *Storage) createSchemaVersionTable() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) applyMigration(m Migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("migration %d: failed to begin transaction: %w", m.Version, err)
+	}
+	defer tx.Rollback()
+
+	// Another process may have applied it while we waited for the lock
+	var done bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM schema_version WHERE version = ?)`, m.Version).Scan(&done); err != nil {
+		return fmt.Errorf("migration %d: %w", m.Version, err)
+	}
+	if done {
+		return nil
+	}
+
+	if err := m.up(tx); err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)`,
+		m.Version, m.Description, time.Now().Unix(),
+	); err != nil {
+		return fmt.Errorf("migration %d: failed to record version: %w", m.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migration %d: failed to commit: %w", m.Version, err)
+	}
+	return nil
+}
+
+// Backup writes a consistent copy of the database next to it, named after
+// the schema version it was taken at, and returns its path.
+func (s *Storage) Backup(version int) (string, error) {
+	path := fmt.Sprintf("%s.v%d-%s.bak", s.path, version, time.Now().Format("20060102-150405"))
+	if _, err := s.db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return "", fmt.Errorf("failed to back up database: %w", err)
+	}
+	return path, nil
+}
+
+func (s *Storage) hasTable(name string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)`, name,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect database: %w", err)
+	}
+	return exists, nil
 }
 
-func (s *Storage) initSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS tasks (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		command TEXT NOT NULL,
-		pid INTEGER,
-		status TEXT CHECK(status IN ('running', 'stopped', 'crashed')) NOT NULL,
-		start_time INTEGER NOT NULL,
-		end_time INTEGER,
-		log_path TEXT NOT NULL,
-		created_at INTEGER NOT NULL
-	);
-	`
+var statusCheckPattern = regexp.MustCompile(`CHECK\s*\(\s*status\s+IN\s*\([^)]*\)\s*\)`)
+
+// setStatusValues replaces the CHECK constraint on tasks.status. SQLite
+// can't alter constraints in place, so the table is rebuilt from its own
+// definition with the new value list and the rows copied across.
+func setStatusValues(tx *sql.Tx, statuses ...string) error {
+	var createSQL string
+	if err := tx.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'tasks'`).Scan(&createSQL); err != nil {
+		return fmt.Errorf("failed to read tasks table definition: %w", err)
+	}
 
-	if _, err := s.db.Exec(schema); err != nil {
-		return fmt.Errorf("failed to create schema: %w", err)
+	if !statusCheckPattern.MatchString(createSQL) {
+		return fmt.Errorf("tasks table has no status CHECK constraint to replace")
+	}
+	check := fmt.Sprintf("CHECK(status IN ('%s'))", strings.Join(statuses, "', '"))
+	createSQL = statusCheckPattern.ReplaceAllLiteralString(createSQL, check)
+
+	columns := strings.Index(createSQL, "(")
+	createSQL = "CREATE TABLE tasks_new " + createSQL[columns:]
+
+	for _, stmt := range []string{
+		createSQL,
+		`INSERT INTO tasks_new SELECT * FROM tasks`,
+		`DROP TABLE tasks`,
+		`ALTER TABLE tasks_new RENAME TO tasks`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to rebuild tasks table: %w", err)
+		}
+	}
+	return nil
+}
+
+// addColumnIfMissing adds a column to a table unless it already exists
+func addColumnIfMissing(tx *sql.Tx, table, column, def string) error {
+	rows, err := tx.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return fmt.Errorf("failed to inspect table %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
 	}
+	rows.Close()
 
+	if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, def)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
 	return nil
 }
 
 // CreateTask inserts a new task into the database
-func (s *Storage) CreateTask(name, command string, pid int, logPath string) (int64, error) {
+func (s *Storage) CreateTask(name, command string, pid int, logPath string, opts StartOptions) (int64, error) {
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode task options: %w", err)
+	}
+
 	now := time.Now().Unix()
 	result, err := s.db.Exec(
-		`INSERT INTO tasks (name, command, pid, status, start_time, log_path, created_at)
-		 VALUES (?, ?, ?, 'running', ?, ?, ?)`,
-		name, command, pid, now, logPath, now,
+		`INSERT INTO tasks (name, command, pid, status, start_time, log_path, created_at, options, tick_name)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		name, command, pid, opts.initialStatus(), now, logPath, now, string(options), nullString(opts.Tick),
 	)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create task: %w", err)
@@ -82,15 +563,9 @@ func (s *Storage) CreateTask(name, command string, pid int, logPath string) (int
 
 // GetTask retrieves a task by ID
 func (s *Storage) GetTask(id int) (*Task, error) {
-	var t Task
-	var startTime, createdAt int64
-	var endTime sql.NullInt64
-
-	err := s.db.QueryRow(
-		`SELECT id, name, command, pid, status, start_time, end_time, log_path, created_at
-		 FROM tasks WHERE id = ?`, id,
-	).Scan(&t.ID, &t.Name, &t.Command, &t.PID, &t.Status, &startTime, &endTime, &t.LogPath, &createdAt)
-
+	t, err := scanTask(s.db.QueryRow(
+		`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, id,
+	))
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("task %d not found", id)
 	}
@@ -98,46 +573,34 @@ func (s *Storage) GetTask(id int) (*Task, error) {
 		return nil, fmt.Errorf("failed to get task: %w", err)
 	}
 
-	t.StartTime = time.Unix(startTime, 0)
-	t.CreatedAt = time.Unix(createdAt, 0)
-	if endTime.Valid {
-		et := time.Unix(endTime.Int64, 0)
-		t.EndTime = &et
-	}
-
-	return &t, nil
+	return t, nil
 }
 
 // ListTasks retrieves all tasks
 func (s *Storage) ListTasks() ([]*Task, error) {
 	rows, err := s.db.Query(
-		`SELECT id, name, command, pid, status, start_time, end_time, log_path, created_at
-		 FROM tasks ORDER BY created_at DESC`,
+		`SELECT ` + taskColumns + ` FROM tasks ORDER BY created_at DESC`,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list tasks: %w", err)
 	}
 	defer rows.Close()
 
+	return scanTasks(rows)
+}
+
+func scanTasks(rows *sql.Rows) ([]*Task, error) {
 	var tasks []*Task
 	for rows.Next() {
-		var t Task
-		var startTime, createdAt int64
-		var endTime sql.NullInt64
-
-		err := rows.Scan(&t.ID, &t.Name, &t.Command, &t.PID, &t.Status, &startTime, &endTime, &t.LogPath, &createdAt)
+		t, err := scanTask(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan task: %w", err)
 		}
+		tasks = append(tasks, t)
+	}
 
-		t.StartTime = time.Unix(startTime, 0)
-		t.CreatedAt = time.Unix(createdAt, 0)
-		if endTime.Valid {
-			et := time.Unix(endTime.Int64, 0)
-			t.EndTime = &et
-		}
-
-		tasks = append(tasks, &t)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tasks: %w", err)
 	}
 
 	return tasks, nil
@@ -146,7 +609,7 @@ func (s *Storage) ListTasks() ([]*Task, error) {
 // UpdateTaskStatus updates a task's status and optionally end time
 func (s *Storage) UpdateTaskStatus(id int, status string) error {
 	var err error
-	if status == "stopped" || status == "crashed" {
+	if status == "stopped" || status == "crashed" || status == "timed_out" {
 		now := time.Now().Unix()
 		_, err = s.db.Exec(
 			`UPDATE tasks SET status = ?, end_time = ? WHERE id = ?`,
@@ -166,6 +629,94 @@ func (s *Storage) UpdateTaskStatus(id int, status string) error {
 	return nil
 }
 
+// FinishTask marks a task as ended and records how it terminated.
+// exitCode is nil when the process was killed by a signal or its status is unknown.
+func (s *Storage) FinishTask(id int, status string, exitCode *int, signal, reason string) error {
+	var code sql.NullInt64
+	if exitCode != nil {
+		code = sql.NullInt64{Int64: int64(*exitCode), Valid: true}
+	}
+
+	_, err := s.db.Exec(
+		`UPDATE tasks SET status = ?, end_time = ?, exit_code = ?, signal = ?, termination_reason = ?
+		 WHERE id = ?`,
+		status, time.Now().Unix(), code, nullString(signal), nullString(reason), id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to finish task: %w", err)
+	}
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+// MarkStopping moves a live task to "stopping". Returns false if the task
+// had already finished, e.g. because its process exited on its own.
+func (s *Storage) MarkStopping(id int) (bool, error) {
+	result, err := s.db.Exec(
+		`UPDATE tasks SET status = 'stopping' WHERE id = ? AND status IN ('running', 'starting', 'ready', 'unhealthy', 'stopping')`, id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark task stopping: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// MarkRestarting records that a task's process exited and is waiting to be
+// restarted by its restart policy
+func (s *Storage) MarkRestarting(id int, exitCode *int, signal string) error {
+	var code sql.NullInt64
+	if exitCode != nil {
+		code = sql.NullInt64{Int64: int64(*exitCode), Valid: true}
+	}
+
+	_, err := s.db.Exec(
+		`UPDATE tasks SET status = 'restarting', exit_code = ?, signal = ? WHERE id = ?`,
+		code, nullString(signal), id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark task restarting: %w", err)
+	}
+	return nil
+}
+
+// RecordRestart marks a task as running again (status "running" or
+// "starting") under a new PID and bumps its restart count
+func (s *Storage) RecordRestart(id, pid int, status string) error {
+	_, err := s.db.Exec(
+		`UPDATE tasks SET status = ?, pid = ?, restart_count = restart_count + 1,
+		 end_time = NULL, exit_code = NULL, signal = NULL, termination_reason = NULL
+		 WHERE id = ?`,
+		status, pid, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record restart: %w", err)
+	}
+	return nil
+}
+
+// SetReadiness moves a task between "starting", "ready" and "unhealthy".
+// Returns false if the task is no longer in one of those states under pid,
+// e.g. because it is being stopped or has been restarted.
+func (s *Storage) SetReadiness(id, pid int, status string) (bool, error) {
+	result, err := s.db.Exec(
+		`UPDATE tasks SET status = ? WHERE id = ? AND pid = ? AND status IN ('starting', 'ready', 'unhealthy')`,
+		status, id, pid,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update task readiness: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
 // UpdateTaskPID updates a task's PID
 func (s *Storage) UpdateTaskPID(id, pid int) error {
 	_, err := s.db.Exec(`UPDATE tasks SET pid = ? WHERE id = ?`, pid, id)
@@ -175,49 +726,95 @@ func (s *Storage) UpdateTaskPID(id, pid int) error {
 	return nil
 }
 
+// ListTickRuns returns the tasks started from a tick since the given time,
+// newest first
+func (s *Storage) ListTickRuns(tickName string, since time.Time) ([]*Task, error) {
+	rows, err := s.db.Query(
+		`SELECT `+taskColumns+` FROM tasks
+		 WHERE tick_name = ? AND created_at >= ? ORDER BY created_at DESC, id DESC`, tickName, since.Unix(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tick runs: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTasks(rows)
+}
+
 // ListTasksOlderThan returns completed/crashed tasks older than N days
 func (s *Storage) ListTasksOlderThan(days int) ([]*Task, error) {
 	cutoff := time.Now().AddDate(0, 0, -days).Unix()
 	rows, err := s.db.Query(
-		`SELECT id, name, command, pid, status, start_time, end_time, log_path, created_at
-		 FROM tasks WHERE end_time IS NOT NULL AND end_time < ? ORDER BY created_at DESC`, cutoff,
+		`SELECT `+taskColumns+` FROM tasks
+		 WHERE end_time IS NOT NULL AND end_time < ? ORDER BY created_at DESC`, cutoff,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list old tasks: %w", err)
 	}
 	defer rows.Close()
 
-	var tasks []*Task
-	for rows.Next() {
-		var t Task
-		var startTime, createdAt int64
-		var endTime sql.NullInt64
+	return scanTasks(rows)
+}
 
-		err := rows.Scan(&t.ID, &t.Name, &t.Command, &t.PID, &t.Status, &startTime, &endTime, &t.LogPath, &createdAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan task: %w", err)
-		}
+// DeleteTask deletes a task by ID, along with its metrics
+func (s *Storage) DeleteTask(id int) error {
+	if _, err := s.db.Exec(`DELETE FROM task_metrics WHERE task_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete task metrics: %w", err)
+	}
+	_, err := s.db.Exec(`DELETE FROM tasks WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete task: %w", err)
+	}
+	return nil
+}
 
-		t.StartTime = time.Unix(startTime, 0)
-		t.CreatedAt = time.Unix(createdAt, 0)
-		if endTime.Valid {
-			et := time.Unix(endTime.Int64, 0)
-			t.EndTime = &et
-		}
+// AddMetric records a resource usage sample for a task
+func (s *Storage) AddMetric(taskID int, m Metric) error {
+	_, err := s.db.Exec(
+		`INSERT INTO task_metrics (task_id, time, cpu, rss, threads, fds, procs) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		taskID, m.Time.UnixMilli(), m.CPU, m.RSS, m.Threads, m.FDs, m.Procs,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record metric: %w", err)
+	}
+	return nil
+}
 
-		tasks = append(tasks, &t)
+// ListMetrics returns a task's samples taken since the given time, oldest first
+func (s *Storage) ListMetrics(taskID int, since time.Time) ([]Metric, error) {
+	rows, err := s.db.Query(
+		`SELECT time, cpu, rss, threads, fds, procs FROM task_metrics
+		 WHERE task_id = ? AND time >= ? ORDER BY time`,
+		taskID, since.UnixMilli(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metrics: %w", err)
 	}
+	defer rows.Close()
 
-	return tasks, nil
+	var metrics []Metric
+	for rows.Next() {
+		var m Metric
+		var at int64
+		if err := rows.Scan(&at, &m.CPU, &m.RSS, &m.Threads, &m.FDs, &m.Procs); err != nil {
+			return nil, fmt.Errorf("failed to scan metric: %w", err)
+		}
+		m.Time = time.UnixMilli(at)
+		metrics = append(metrics, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read metrics: %w", err)
+	}
+	return metrics, nil
 }
 
-// DeleteTask deletes a task by ID
-func (s *Storage) DeleteTask(id int) error {
-	_, err := s.db.Exec(`DELETE FROM tasks WHERE id = ?`, id)
+// PruneMetrics deletes samples taken before the given time
+func (s *Storage) PruneMetrics(before time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM task_metrics WHERE time < ?`, before.UnixMilli())
 	if err != nil {
-		return fmt.Errorf("failed to delete task: %w", err)
+		return 0, fmt.Errorf("failed to prune metrics: %w", err)
 	}
-	return nil
+	return result.RowsAffected()
 }
 
 // Close closes the database connection
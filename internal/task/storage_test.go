@@ -0,0 +1,284 @@
+package task
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// v1Schema is the tasks table as the first release created it
+const v1Schema = `CREATE TABLE tasks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	command TEXT NOT NULL,
+	pid INTEGER,
+	status TEXT CHECK(status IN ('running', 'stopped', 'crashed')) NOT NULL,
+	start_time INTEGER NOT NULL,
+	end_time INTEGER,
+	log_path TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+)`
+
+// newV1Storage creates an unversioned database with the v1 schema and a
+// few tasks in it
+func newV1Storage(t *testing.T) *Storage {
+	t.Helper()
+	s, err := OpenStorage(filepath.Join(t.TempDir(), "watchy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	mustExec(t, s, v1Schema)
+	mustExec(t, s, `INSERT INTO tasks (name, command, pid, status, start_time, end_time, log_path, created_at) VALUES
+		('web', 'npm start', 100, 'running', 1000, NULL, '/logs/1.log', 1000),
+		('api', 'go run .', 101, 'stopped', 2000, 2500, '/logs/2.log', 2000),
+		('job', 'make', 102, 'crashed', 3000, 3100, '/logs/3.log', 3000)`)
+	return s
+}
+
+func mustExec(t *testing.T, s *Storage, query string, args ...any) {
+	t.Helper()
+	if _, err := s.db.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+// checkRows fails unless the three v1 tasks survived unchanged
+func checkRows(t *testing.T, s *Storage) {
+	t.Helper()
+	rows, err := s.db.Query(`SELECT id, name, command, pid, status, start_time, log_path FROM tasks WHERE id <= 3 ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	want := []struct {
+		name, command, status string
+		pid, start            int
+	}{
+		{"web", "npm start", "running", 100, 1000},
+		{"api", "go run .", "stopped", 101, 2000},
+		{"job", "make", "crashed", 102, 3000},
+	}
+	i := 0
+	for ; rows.Next(); i++ {
+		var id, pid, start int
+		var name, command, status, logPath string
+		if err := rows.Scan(&id, &name, &command, &pid, &status, &start, &logPath); err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(want) {
+			break
+		}
+		w := want[i]
+		if id != i+1 || name != w.name || command != w.command || status != w.status || pid != w.pid || start != w.start {
+			t.Errorf("row %d = %d %q %q %q %d %d, want %q %q %q %d %d", i, id, name, command, status, pid, start, w.name, w.command, w.status, w.pid, w.start)
+		}
+	}
+	if i != len(want) {
+		t.Errorf("got %d v1 rows, want %d", i, len(want))
+	}
+}
+
+// checkStatuses fails unless exactly the given statuses are accepted
+func checkStatuses(t *testing.T, s *Storage, allowed ...string) {
+	t.Helper()
+	for _, status := range append(allowed, "bogus") {
+		valid := status != "bogus"
+		_, err := s.db.Exec(`INSERT INTO tasks (name, command, status, start_time, log_path, created_at) VALUES ('probe', 'true', ?, 0, '', 0)`, status)
+		if valid && err != nil {
+			t.Errorf("status %q rejected: %v", status, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("status %q accepted", status)
+		}
+	}
+	mustExec(t, s, `DELETE FROM tasks WHERE name = 'probe'`)
+}
+
+func checkTable(t *testing.T, s *Storage, name string) {
+	t.Helper()
+	exists, err := s.hasTable(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Errorf("table %s is missing", name)
+	}
+}
+
+func TestMigrateStepByStep(t *testing.T) {
+	s := newV1Storage(t)
+
+	checks := map[int]func(t *testing.T){
+		1: func(t *testing.T) {
+			checkStatuses(t, s, "running", "stopped", "crashed")
+		},
+		2: func(t *testing.T) {
+			mustExec(t, s, `UPDATE tasks SET exit_code = 1, signal = '', termination_reason = 'exited' WHERE name = 'job'`)
+		},
+		3: func(t *testing.T) {
+			var options string
+			var restarts int
+			if err := s.db.QueryRow(`SELECT options, restart_count FROM tasks WHERE name = 'web'`).Scan(&options, &restarts); err != nil {
+				t.Fatal(err)
+			}
+			if options != "{}" || restarts != 0 {
+				t.Errorf("defaults = %q, %d, want {} and 0", options, restarts)
+			}
+			checkStatuses(t, s, "running", "restarting", "stopped", "crashed")
+
+			// Later builds recorded the stack a task was started for
+			mustExec(t, s, `UPDATE tasks SET options = '{"stack":"dev"}' WHERE name = 'api'`)
+		},
+		4: func(t *testing.T) {
+			checkStatuses(t, s, "running", "restarting", "stopping", "stopped", "crashed")
+		},
+		5: func(t *testing.T) {
+			checkStatuses(t, s, "running", "starting", "ready", "unhealthy", "restarting", "stopping", "stopped", "crashed")
+		},
+		6: func(t *testing.T) {
+			checkTable(t, s, "task_metrics")
+		},
+		7: func(t *testing.T) {
+			checkStatuses(t, s, "running", "starting", "ready", "unhealthy", "restarting", "stopping", "stopped", "crashed", "timed_out")
+		},
+		8: func(t *testing.T) {
+			var api, web *string
+			if err := s.db.QueryRow(`SELECT (SELECT tick_name FROM tasks WHERE name = 'api'), (SELECT tick_name FROM tasks WHERE name = 'web')`).Scan(&api, &web); err != nil {
+				t.Fatal(err)
+			}
+			if api == nil || *api != "api" {
+				t.Errorf("stack step tick_name = %v, want api", api)
+			}
+			if web != nil {
+				t.Errorf("plain task tick_name = %q, want NULL", *web)
+			}
+		},
+		9: func(t *testing.T) {
+			checkTable(t, s, "chat_sessions")
+			checkTable(t, s, "chat_messages")
+		},
+	}
+
+	if err := s.createSchemaVersionTable(); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if err := s.applyMigration(m); err != nil {
+			t.Fatal(err)
+		}
+		version, err := s.SchemaVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != m.Version {
+			t.Fatalf("after migration %d, SchemaVersion() = %d", m.Version, version)
+		}
+		checkRows(t, s)
+		check, ok := checks[m.Version]
+		if !ok {
+			t.Fatalf("migration %d has no check", m.Version)
+		}
+		t.Run(m.Description, check)
+	}
+
+	// The migrated rows read back through the current API
+	job, err := s.GetTask(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != "crashed" || job.ExitCode == nil || *job.ExitCode != 1 || job.EndTime == nil || job.EndTime.Unix() != 3100 {
+		t.Errorf("GetTask(3) = %+v", job)
+	}
+	api, err := s.GetTask(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if api.Options.Stack != "dev" || api.TickName != "api" {
+		t.Errorf("GetTask(2) stack = %q, tick = %q", api.Options.Stack, api.TickName)
+	}
+
+	backup, applied, err := s.Migrate()
+	if err != nil || backup != "" || len(applied) != 0 {
+		t.Errorf("Migrate() on latest = %q, %d applied, %v", backup, len(applied), err)
+	}
+}
+
+func TestMigrateBacksUp(t *testing.T) {
+	s := newV1Storage(t)
+
+	backup, applied, err := s.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("applied %d migrations, want %d", len(applied), len(migrations))
+	}
+	checkRows(t, s)
+
+	old, err := OpenStorageReadOnly(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	checkRows(t, old)
+	if version, err := old.SchemaVersion(); err != nil || version != 0 {
+		t.Errorf("backup SchemaVersion() = %d, %v, want 0", version, err)
+	}
+}
+
+func TestMigrateEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchy.db")
+	s, err := NewStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if version, err := s.SchemaVersion(); err != nil || version != LatestSchemaVersion() {
+		t.Errorf("SchemaVersion() = %d, %v, want %d", version, err, LatestSchemaVersion())
+	}
+	backups, _ := filepath.Glob(path + ".*.bak")
+	if len(backups) != 0 {
+		t.Errorf("new database was backed up: %v", backups)
+	}
+}
+
+func TestSchemaVersionReadOnly(t *testing.T) {
+	s := newV1Storage(t)
+	s.Close()
+
+	ro, err := OpenStorageReadOnly(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+
+	if version, err := ro.SchemaVersion(); err != nil || version != 0 {
+		t.Errorf("SchemaVersion() = %d, %v, want 0", version, err)
+	}
+	pending, err := ro.PendingMigrations()
+	if err != nil || len(pending) != len(migrations) {
+		t.Errorf("PendingMigrations() = %d, %v, want %d", len(pending), err, len(migrations))
+	}
+	if exists, _ := ro.hasTable("schema_version"); exists {
+		t.Error("SchemaVersion created schema_version")
+	}
+	if _, err := ro.db.Exec(`DELETE FROM tasks`); err == nil {
+		t.Error("read-only storage allowed a write")
+	}
+}
+
+func TestOpenStorageReadOnlyMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchy.db")
+	if _, err := OpenStorageReadOnly(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("OpenStorageReadOnly(missing) = %v, want ErrNotExist", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("database file was created")
+	}
+}
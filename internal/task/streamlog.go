@@ -0,0 +1,216 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Streams recorded in a task's stream log
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+	StreamWatchy = "watchy" // notices watchy writes about the task
+)
+
+// streamTimeFormat is fixed width, so stream log lines sort by time as text
+const streamTimeFormat = "2006-01-02T15:04:05.000000Z"
+
+// maxStreamLine is the longest partial line held back waiting for a newline
+const maxStreamLine = 64 * 1024
+
+// LogLine is one line of task output as recorded in the stream log
+type LogLine struct {
+	Time   time.Time // zero for logs written before streams were recorded
+	Stream string    // StreamStdout, StreamStderr or StreamWatchy; empty if unknown
+	Text   string
+}
+
+// LogFilter selects lines from a task's stream log. Zero values match everything.
+type LogFilter struct {
+	Stream string
+	Since  time.Time
+}
+
+// IsZero reports whether the filter matches every line
+func (f LogFilter) IsZero() bool {
+	return f.Stream == "" && f.Since.IsZero()
+}
+
+func (f LogFilter) match(l LogLine) bool {
+	if f.Stream != "" && l.Stream != f.Stream {
+		return false
+	}
+	return f.Since.IsZero() || !l.Time.Before(f.Since)
+}
+
+// StreamLogPath returns the stream log kept alongside a task's plain log.
+// Each line is "<time>\t<stream>\t<text>" with times in UTC.
+func StreamLogPath(logPath string) string {
+	return strings.TrimSuffix(logPath, ".log") + ".streams"
+}
+
+func formatLogLine(t time.Time, stream string, text []byte) []byte {
+	line := make([]byte, 0, len(streamTimeFormat)+len(stream)+len(text)+3)
+	line = t.UTC().AppendFormat(line, streamTimeFormat)
+	line = append(line, '\t')
+	line = append(line, stream...)
+	line = append(line, '\t')
+	line = append(line, text...)
+	return append(line, '\n')
+}
+
+func parseLogLine(s string) (LogLine, bool) {
+	parts := strings.SplitN(s, "\t", 3)
+	if len(parts) != 3 {
+		return LogLine{}, false
+	}
+	t, err := time.Parse(streamTimeFormat, parts[0])
+	if err != nil {
+		return LogLine{}, false
+	}
+	return LogLine{Time: t.Local(), Stream: parts[1], Text: parts[2]}, true
+}
+
+// hasStreamLog reports whether any part of the stream log exists
+func hasStreamLog(logPath string) bool {
+	for _, seg := range LogSegments(StreamLogPath(logPath)) {
+		if _, err := os.Stat(seg); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadLogLines returns the last n lines of a task's output that match f,
+// reading back through rotated segments as needed. Tasks started before
+// streams were recorded only support an empty filter.
+func ReadLogLines(logPath string, n int, f LogFilter) ([]LogLine, error) {
+	if !hasStreamLog(logPath) {
+		if !f.IsZero() {
+			return nil, fmt.Errorf("no stream log for this task (it predates stream capture)")
+		}
+		lines, err := TailLogFile(logPath, n)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]LogLine, len(lines))
+		for i, l := range lines {
+			out[i] = LogLine{Text: l}
+		}
+		return out, nil
+	}
+
+	parse := func(b []byte) []LogLine {
+		var lines []LogLine
+		for _, s := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+			if l, ok := parseLogLine(s); ok {
+				lines = append(lines, l)
+			}
+		}
+		return lines
+	}
+
+	// Only complete lines count towards stopping: the first line of the
+	// data read so far may be the tail end of one in an earlier chunk.
+	// examined is how many bytes at the end have been counted already.
+	matched, examined := 0, 0
+	data, err := readLogTail(StreamLogPath(logPath), func(b []byte, _ int) bool {
+		fresh := b[:len(b)-examined]
+		start := bytes.IndexByte(fresh, '\n') + 1
+		if start == 0 {
+			return false
+		}
+		lines := parse(fresh[start:])
+		examined = len(b) - start
+		if len(lines) > 0 && !f.Since.IsZero() && lines[0].Time.Before(f.Since) {
+			return true
+		}
+		for _, l := range lines {
+			if f.match(l) {
+				matched++
+			}
+		}
+		return matched >= n
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var out []LogLine
+	for _, l := range parse(data) {
+		if f.match(l) {
+			out = append(out, l)
+		}
+	}
+	if len(out) > n {
+		out = out[len(out)-n:]
+	}
+	return out, nil
+}
+
+// appendLogNotice records a watchy notice in both the plain and stream logs
+func appendLogNotice(logPath, text string) {
+	if f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err == nil {
+		fmt.Fprintf(f, "[watchy] %s\n", text)
+		f.Close()
+	}
+	if !hasStreamLog(logPath) {
+		return
+	}
+	if f, err := os.OpenFile(StreamLogPath(logPath), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err == nil {
+		f.Write(formatLogLine(time.Now(), StreamWatchy, []byte(text)))
+		f.Close()
+	}
+}
+
+// streamRecorder writes task output to the plain log as it arrives and to
+// the stream log a line at a time, tagged with its stream and arrival time
+type streamRecorder struct {
+	mu      sync.Mutex
+	plain   io.Writer
+	streams io.Writer
+}
+
+func (r *streamRecorder) copy(src io.Reader, stream string) error {
+	buf := make([]byte, 32*1024)
+	var partial []byte
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			now := time.Now()
+			r.mu.Lock()
+			r.plain.Write(buf[:n])
+			data := append(partial, buf[:n]...)
+			for {
+				i := bytes.IndexByte(data, '\n')
+				if i < 0 {
+					break
+				}
+				r.streams.Write(formatLogLine(now, stream, data[:i]))
+				data = data[i+1:]
+			}
+			if len(data) > maxStreamLine {
+				r.streams.Write(formatLogLine(now, stream, data))
+				data = nil
+			}
+			r.mu.Unlock()
+			partial = append([]byte(nil), data...)
+		}
+		if err != nil {
+			if len(partial) > 0 {
+				r.mu.Lock()
+				r.streams.Write(formatLogLine(time.Now(), stream, partial))
+				r.mu.Unlock()
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
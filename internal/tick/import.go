@@ -0,0 +1,652 @@
+package tick
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Formats ticks can be imported from
+const (
+	FormatProcfile = "procfile"
+	FormatNpm      = "npm"
+	FormatMake     = "make"
+	FormatJust     = "justfile"
+)
+
+// importFormats lists each format's file names, in the order they are
+// looked for, and the name prefix its ticks get by default
+var importFormats = []struct {
+	format string
+	files  []string
+	prefix string
+}{
+	{FormatProcfile, []string{"Procfile"}, "proc"},
+	{FormatNpm, []string{"package.json"}, "npm"},
+	{FormatMake, []string{"GNUmakefile", "makefile", "Makefile"}, "make"},
+	{FormatJust, []string{"justfile", "Justfile", ".justfile"}, "just"},
+}
+
+// ImportSource records the file a tick was imported from
+type ImportSource struct {
+	Format  string    `json:"format"`
+	Path    string    `json:"path"` // absolute
+	Prefix  string    `json:"prefix,omitempty"`
+	Sync    bool      `json:"sync,omitempty"` // re-import when the file changes
+	ModTime time.Time `json:"mod_time"`       // of the file when last imported
+}
+
+// DefaultPrefix returns the prefix ticks imported from format are named with,
+// e.g. "npm" for "npm-build"
+func DefaultPrefix(format string) string {
+	for _, f := range importFormats {
+		if f.format == format {
+			return f.prefix
+		}
+	}
+	return ""
+}
+
+// FindImportSource finds the file to import from: path itself, or the file
+// for format in the directory path. With no format, a file's format is
+// told from its name, and a directory must hold exactly one known file.
+func FindImportSource(path, format string) (ImportSource, error) {
+	if format != "" && DefaultPrefix(format) == "" {
+		return ImportSource{}, fmt.Errorf("unknown format %q (use procfile, npm, make, or justfile)", format)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return ImportSource{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ImportSource{}, err
+	}
+
+	if !info.IsDir() {
+		if format == "" {
+			format = detectFormat(filepath.Base(path))
+		}
+		if format == "" {
+			return ImportSource{}, fmt.Errorf("can't tell what %s is; use --from", path)
+		}
+		return ImportSource{Format: format, Path: path, Prefix: DefaultPrefix(format), ModTime: info.ModTime()}, nil
+	}
+
+	var found []ImportSource
+	for _, f := range importFormats {
+		if format != "" && f.format != format {
+			continue
+		}
+		for _, name := range f.files {
+			if info, err := os.Stat(filepath.Join(path, name)); err == nil {
+				found = append(found, ImportSource{Format: f.format, Path: filepath.Join(path, name), Prefix: f.prefix, ModTime: info.ModTime()})
+				break
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		if format != "" {
+			return ImportSource{}, fmt.Errorf("no %s file in %s", format, path)
+		}
+		return ImportSource{}, fmt.Errorf("no Procfile, package.json, Makefile, or justfile in %s", path)
+	case 1:
+		return found[0], nil
+	}
+	names := make([]string, len(found))
+	for i, src := range found {
+		names[i] = filepath.Base(src.Path)
+	}
+	return ImportSource{}, fmt.Errorf("found %s in %s; choose one with --from", strings.Join(names, ", "), path)
+}
+
+func detectFormat(base string) string {
+	for _, f := range importFormats {
+		for _, name := range f.files {
+			if base == name {
+				return f.format
+			}
+		}
+	}
+	switch {
+	case strings.HasPrefix(base, "Procfile"):
+		return FormatProcfile
+	case strings.HasSuffix(base, ".mk"):
+		return FormatMake
+	case strings.HasSuffix(base, ".just"):
+		return FormatJust
+	}
+	return ""
+}
+
+// importEntry is one process, script, target or recipe found in a file
+type importEntry struct {
+	name        string
+	command     string
+	description string
+	params      []Param
+}
+
+// ParseImport reads the ticks defined by src. They are named after their
+// entries with src.Prefix and a dash in front, and run in the file's directory.
+// Two entries that would get the same tick name, like "build:prod" and
+// "build-prod", are an error.
+func ParseImport(src ImportSource) ([]NamedTick, error) {
+	data, err := os.ReadFile(src.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []importEntry
+	switch src.Format {
+	case FormatProcfile:
+		entries = parseProcfile(string(data))
+	case FormatNpm:
+		entries, err = parseNpm(data, filepath.Dir(src.Path))
+	case FormatMake:
+		entries = parseMakefile(string(data), filepath.Base(src.Path))
+	case FormatJust:
+		entries = parseJustfile(string(data), filepath.Base(src.Path))
+	default:
+		err = fmt.Errorf("unknown format %q", src.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", src.Path, err)
+	}
+
+	var ticks []NamedTick
+	seen := make(map[string]string) // tick name -> entry it was made from
+	for _, e := range entries {
+		name := importName(src.Prefix, e.name)
+		if prev, ok := seen[name]; ok {
+			if prev == e.name {
+				continue
+			}
+			return nil, fmt.Errorf("%s: %q and %q would both become tick %q; rename one of them", src.Path, prev, e.name, name)
+		}
+		seen[name] = e.name
+		source := src
+		ticks = append(ticks, NamedTick{Name: name, Tick: Tick{
+			Command:     e.command,
+			Description: e.description,
+			Params:      e.params,
+			Cwd:         filepath.Dir(src.Path),
+			Import:      &source,
+		}})
+	}
+	return ticks, nil
+}
+
+// importName turns an entry's name into a tick name, replacing characters
+// tick names can't have, e.g. "build:prod" becomes "npm-build-prod"
+func importName(prefix, name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			b[i] = '-'
+		}
+	}
+	if prefix == "" {
+		return string(b)
+	}
+	return prefix + "-" + string(b)
+}
+
+// parseProcfile parses "name: command" lines
+func parseProcfile(data string) []importEntry {
+	var entries []importEntry
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, command, ok := strings.Cut(line, ":")
+		name, command = strings.TrimSpace(name), strings.TrimSpace(command)
+		if !ok || name == "" || command == "" || strings.ContainsAny(name, " \t") {
+			continue
+		}
+		entries = append(entries, importEntry{name: name, command: command})
+	}
+	return entries
+}
+
+// parseNpm turns package.json scripts into "npm run" commands, or the
+// equivalent for the package manager whose lock file is in dir. Pre and
+// post hooks are left out, as running the script runs them.
+func parseNpm(data []byte, dir string) ([]importEntry, error) {
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, err
+	}
+
+	runner := "npm run"
+	for _, lock := range []struct{ file, runner string }{
+		{"pnpm-lock.yaml", "pnpm run"},
+		{"yarn.lock", "yarn run"},
+		{"bun.lock", "bun run"},
+		{"bun.lockb", "bun run"},
+	} {
+		if _, err := os.Stat(filepath.Join(dir, lock.file)); err == nil {
+			runner = lock.runner
+			break
+		}
+	}
+
+	names := make([]string, 0, len(pkg.Scripts))
+	for name := range pkg.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var entries []importEntry
+	for _, name := range names {
+		if hook, ok := strings.CutPrefix(name, "pre"); ok && pkg.Scripts[hook] != "" {
+			continue
+		}
+		if hook, ok := strings.CutPrefix(name, "post"); ok && pkg.Scripts[hook] != "" {
+			continue
+		}
+		entries = append(entries, importEntry{
+			name:        name,
+			command:     runner + " " + ShellQuote(name),
+			description: pkg.Scripts[name],
+		})
+	}
+	return entries, nil
+}
+
+// parseMakefile finds the explicit targets of a Makefile. Special targets
+// (".PHONY"), pattern rules and file targets ("build/app", "main.o") are
+// left out. A "## text" comment on the rule line becomes the description.
+func parseMakefile(data, base string) []importEntry {
+	run := "make"
+	if base != "Makefile" && base != "makefile" && base != "GNUmakefile" {
+		run = "make -f " + ShellQuote(base)
+	}
+
+	var entries []importEntry
+	inDefine := false
+	for _, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "define ") || trimmed == "define" {
+			inDefine = true
+			continue
+		}
+		if inDefine {
+			inDefine = trimmed != "endef"
+			continue
+		}
+		if line == "" || line[0] == '\t' || line[0] == ' ' || line[0] == '#' {
+			continue
+		}
+
+		targets, rest, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(strings.TrimLeft(rest, ":"), "=") || strings.ContainsAny(targets, "=$%(") {
+			continue
+		}
+		var description string
+		if _, comment, ok := strings.Cut(rest, "##"); ok {
+			description = strings.TrimSpace(comment)
+		}
+		for _, target := range strings.Fields(targets) {
+			if !ValidName(target) {
+				continue
+			}
+			entries = append(entries, importEntry{
+				name:        target,
+				command:     run + " " + target,
+				description: description,
+			})
+		}
+	}
+	return entries
+}
+
+// parseJustfile finds the public recipes of a justfile. Recipe parameters
+// become tick parameters; a parameter whose default isn't a plain string,
+// and any after it, are left for just to fill in. The comment line above a
+// recipe becomes its description.
+func parseJustfile(data, base string) []importEntry {
+	run := "just"
+	if base != "justfile" && base != "Justfile" && base != ".justfile" {
+		run = "just -f " + ShellQuote(base)
+	}
+
+	var entries []importEntry
+	var comment string
+	private := false
+	for _, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			comment, private = "", false
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			continue
+		case strings.HasPrefix(line, "#"):
+			comment = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			continue
+		case strings.HasPrefix(line, "["):
+			private = private || strings.Contains(line, "private")
+			continue
+		}
+
+		header, ok := justRecipeHeader(line)
+		isPrivate := private
+		description := comment
+		comment, private = "", false
+		if !ok {
+			continue
+		}
+		words := splitQuoted(strings.TrimPrefix(header, "@"))
+		if len(words) == 0 {
+			continue
+		}
+		name := words[0]
+		switch name {
+		case "set", "alias", "export", "import", "mod":
+			continue
+		}
+		if isPrivate || strings.HasPrefix(name, "_") {
+			continue
+		}
+
+		command := run + " " + name
+		var params []Param
+		for _, w := range words[1:] {
+			w = strings.TrimPrefix(w, "$")
+			if strings.HasPrefix(w, "*") {
+				break // optional variadic; nothing to pass
+			}
+			w = strings.TrimPrefix(strings.TrimPrefix(w, "+"), "$")
+			pname, def, hasDefault := strings.Cut(w, "=")
+			pname = strings.ReplaceAll(pname, "-", "_")
+			if !paramNamePattern.MatchString(pname) {
+				break
+			}
+			p := Param{Name: pname}
+			if hasDefault {
+				value, ok := justString(def)
+				if !ok {
+					break
+				}
+				p.Default = &value
+			}
+			params = append(params, p)
+			command += " {{" + pname + "}}"
+		}
+		entries = append(entries, importEntry{name: name, command: command, description: description, params: params})
+	}
+	return entries
+}
+
+// justRecipeHeader returns what comes before a recipe line's colon, or false
+// if the line isn't a recipe (e.g. an assignment, "x := 1")
+func justRecipeHeader(line string) (string, bool) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '#':
+			return "", false
+		case c == ':':
+			if i+1 < len(line) && line[i+1] == '=' {
+				return "", false
+			}
+			return line[:i], true
+		}
+	}
+	return "", false
+}
+
+// splitQuoted splits s at spaces outside quotes
+func splitQuoted(s string) []string {
+	var words []string
+	var cur strings.Builder
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == ' ' || c == '\t':
+			if cur.Len() > 0 {
+				words = append(words, cur.String())
+				cur.Reset()
+			}
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	if cur.Len() > 0 {
+		words = append(words, cur.String())
+	}
+	return words
+}
+
+// justString returns the value of a quoted string default, or false for an
+// expression just has to evaluate, like a variable or a backtick
+func justString(s string) (string, bool) {
+	if len(s) < 2 || (s[0] != '\'' && s[0] != '"') || s[len(s)-1] != s[0] {
+		return "", false
+	}
+	inner := s[1 : len(s)-1]
+	if s[0] == '"' && strings.Contains(inner, `\`) {
+		return "", false
+	}
+	return inner, true
+}
+
+// ImportPlan is what importing a file would change
+type ImportPlan struct {
+	Source ImportSource
+	Add    []NamedTick
+	Update []NamedTick // with their new fields
+	Remove []string    // imported from the file earlier, but no longer in it
+	Skip   []string    // why entries can't be imported, e.g. `"npm-x" is a reserved command name`
+}
+
+// Empty reports whether applying the plan would change no ticks
+func (p ImportPlan) Empty() bool {
+	return len(p.Add) == 0 && len(p.Update) == 0 && len(p.Remove) == 0
+}
+
+// PlanImport works out how to bring the store in line with ticks imported
+// from src. Ticks imported from the same file before are updated or
+// removed; other ticks are never touched, so clashing entries are skipped.
+func (s *Store) PlanImport(src ImportSource, ticks []NamedTick) ImportPlan {
+	plan := ImportPlan{Source: src}
+	wanted := make(map[string]bool)
+	for _, nt := range ticks {
+		name := nt.Name
+		wanted[name] = true
+		existing, exists := s.ticks[name]
+		switch {
+		case !ValidName(name):
+			plan.Skip = append(plan.Skip, fmt.Sprintf("%q is not a valid tick name", name))
+		case reservedNames[name]:
+			plan.Skip = append(plan.Skip, fmt.Sprintf("%q is a reserved command name", name))
+		case s.checkGlobal(name) != nil:
+			plan.Skip = append(plan.Skip, s.checkGlobal(name).Error())
+		case !exists:
+			plan.Add = append(plan.Add, nt)
+		case !sameSource(existing.Import, src):
+			plan.Skip = append(plan.Skip, fmt.Sprintf("tick %q already exists", name))
+		default:
+			updated := withImported(existing, nt.Tick)
+			if updated.Command != existing.Command || updated.Description != existing.Description ||
+				updated.Cwd != existing.Cwd || !reflect.DeepEqual(updated.Params, existing.Params) {
+				plan.Update = append(plan.Update, NamedTick{Name: name, Tick: updated})
+			}
+		}
+	}
+	for name, t := range s.ticks {
+		if !wanted[name] && sameSource(t.Import, src) {
+			plan.Remove = append(plan.Remove, name)
+		}
+	}
+	sort.Strings(plan.Remove)
+	return plan
+}
+
+func sameSource(a *ImportSource, b ImportSource) bool {
+	return a != nil && a.Path == b.Path && a.Format == b.Format
+}
+
+// withImported returns t with the fields an import sets taken from
+// imported, keeping the settings added since, like restart policy or
+// schedule
+func withImported(t, imported Tick) Tick {
+	t.Command = imported.Command
+	t.Description = imported.Description
+	t.Params = imported.Params
+	t.Cwd = imported.Cwd
+	return t
+}
+
+// ApplyImport makes the plan's changes and records the file's current
+// state on every tick imported from it. The ticks are re-read first, and
+// changes made since the plan are kept: ticks that now clash aren't
+// added, and only the imported fields of updated ticks are set.
+func (s *Store) ApplyImport(plan ImportPlan) error {
+	return s.update(func() error {
+		s.applyImport(plan)
+		return nil
+	})
+}
+
+func (s *Store) applyImport(plan ImportPlan) {
+	now := time.Now()
+	for _, nt := range plan.Add {
+		if _, exists := s.ticks[nt.Name]; !exists {
+			nt.Tick.CreatedAt = now
+			s.ticks[nt.Name] = nt.Tick
+		}
+	}
+	for _, nt := range plan.Update {
+		if t, ok := s.ticks[nt.Name]; ok && sameSource(t.Import, plan.Source) {
+			t = withImported(t, nt.Tick)
+			t.UpdatedAt = now
+			s.ticks[nt.Name] = t
+		}
+	}
+	for _, name := range plan.Remove {
+		if t, ok := s.ticks[name]; ok && sameSource(t.Import, plan.Source) {
+			delete(s.ticks, name)
+		}
+	}
+	for name, t := range s.ticks {
+		if sameSource(t.Import, plan.Source) {
+			src := plan.Source
+			t.Import = &src
+			s.ticks[name] = t
+		}
+	}
+}
+
+// Sync re-imports the files of ticks imported with sync on that have
+// changed since, and describes what changed. Files that are gone are left
+// alone, along with their ticks.
+func (s *Store) Sync() ([]string, error) {
+	// Checked without the lock first, as watchyd syncs every second
+	if len(s.changedSources()) == 0 {
+		return nil, nil
+	}
+
+	var changes []string
+	var errs []error
+	err := s.update(func() error {
+		synced := false
+		for _, src := range s.changedSources() {
+			ticks, err := ParseImport(src)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			plan := s.PlanImport(src, ticks)
+			s.applyImport(plan)
+			synced = true
+			if !plan.Empty() {
+				changes = append(changes, fmt.Sprintf("Synced ticks from %s: %s", src.Path, plan.Summary()))
+			}
+		}
+		if !synced {
+			return errUnchanged
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(changes)
+	return changes, errors.Join(errs...)
+}
+
+// changedSources returns the files of ticks imported with sync on that
+// have changed since, with their new modification times
+func (s *Store) changedSources() []ImportSource {
+	seen := make(map[string]bool)
+	var sources []ImportSource
+	for _, t := range s.ticks {
+		if t.Import == nil || !t.Import.Sync || seen[t.Import.Format+":"+t.Import.Path] {
+			continue
+		}
+		seen[t.Import.Format+":"+t.Import.Path] = true
+		info, err := os.Stat(t.Import.Path)
+		if err != nil || info.ModTime().Equal(t.Import.ModTime) {
+			continue
+		}
+		src := *t.Import
+		src.ModTime = info.ModTime()
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+// Summary describes the plan's changes, e.g. "added npm-dev; removed npm-old"
+func (p ImportPlan) Summary() string {
+	var parts []string
+	for _, c := range []struct {
+		verb  string
+		names []string
+	}{
+		{"added", namesOf(p.Add)},
+		{"updated", namesOf(p.Update)},
+		{"removed", p.Remove},
+	} {
+		if len(c.names) > 0 {
+			parts = append(parts, c.verb+" "+strings.Join(c.names, ", "))
+		}
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, "; ")
+}
+
+func namesOf(ticks []NamedTick) []string {
+	names := make([]string, len(ticks))
+	for i, nt := range ticks {
+		names[i] = nt.Name
+	}
+	return names
+}
@@ -0,0 +1,69 @@
+package tick
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseImportNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "sanitized",
+			file: "package.json",
+			data: `{"scripts": {"build:prod": "vite build", "dev": "vite"}}`,
+			want: []string{"x-build-prod", "x-dev"},
+		},
+		{
+			name:    "collision",
+			file:    "package.json",
+			data:    `{"scripts": {"build:prod": "vite build", "build-prod": "vite build --mode prod"}}`,
+			wantErr: `"build-prod" and "build:prod" would both become tick "x-build-prod"`,
+		},
+		{
+			name:    "procfile collision",
+			file:    "Procfile",
+			data:    "web.1: node a.js\nweb-1: node b.js\n",
+			wantErr: `"web.1" and "web-1" would both become tick "x-web-1"`,
+		},
+		{
+			name: "same entry twice",
+			file: "Procfile",
+			data: "web: node a.js\nweb: node b.js\n",
+			want: []string{"x-web"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			format := detectFormat(tt.file)
+			ticks, err := ParseImport(ImportSource{Path: path, Format: format, Prefix: "x"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseImport() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, nt := range ticks {
+				names = append(names, nt.Name)
+			}
+			if strings.Join(names, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("names = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
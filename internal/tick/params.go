@@ -0,0 +1,251 @@
+package tick
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Param is a named parameter of a tick's command, written {{name}} in the
+// command and filled in when the tick is run
+type Param struct {
+	Name    string  `json:"name"`
+	Default *string `json:"default,omitempty"` // nil means the parameter is required
+}
+
+var (
+	placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	paramNamePattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ParseParam parses a parameter declaration: "name" for a required
+// parameter or "name=default"
+func ParseParam(s string) (Param, error) {
+	name, def, hasDefault := strings.Cut(s, "=")
+	if !paramNamePattern.MatchString(name) {
+		return Param{}, fmt.Errorf("invalid parameter name %q (use letters, digits, or underscore)", name)
+	}
+	p := Param{Name: name}
+	if hasDefault {
+		p.Default = &def
+	}
+	return p, nil
+}
+
+func (p Param) String() string {
+	if p.Default == nil {
+		return p.Name
+	}
+	return p.Name + "=" + *p.Default
+}
+
+// Parameters returns the tick's parameters in the order they first appear
+// in the command, which is the order positional values fill them. Those
+// not declared in Params are required.
+func (t Tick) Parameters() []Param {
+	declared := make(map[string]Param, len(t.Params))
+	for _, p := range t.Params {
+		declared[p.Name] = p
+	}
+	var params []Param
+	seen := make(map[string]bool)
+	for _, m := range placeholderPattern.FindAllStringSubmatch(t.Command, -1) {
+		if seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		p, ok := declared[m[1]]
+		if !ok {
+			p = Param{Name: m[1]}
+		}
+		params = append(params, p)
+	}
+	return params
+}
+
+// validateParams checks that every declared parameter appears in the
+// command exactly as {{name}}, and that none appears inside quotes, where
+// the quoting Render adds would become part of the value
+func (t Tick) validateParams() error {
+	used := make(map[string]bool)
+	for _, m := range placeholderPattern.FindAllStringSubmatch(t.Command, -1) {
+		used[m[1]] = true
+	}
+	declared := make(map[string]bool)
+	for _, p := range t.Params {
+		if !paramNamePattern.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name %q (use letters, digits, or underscore)", p.Name)
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("parameter %q is declared twice", p.Name)
+		}
+		declared[p.Name] = true
+		if !used[p.Name] {
+			return fmt.Errorf("parameter %q is not used in the command (write it as {{%s}})", p.Name, p.Name)
+		}
+	}
+
+	var quote byte
+	for i := 0; i < len(t.Command); i++ {
+		c := t.Command[i]
+		switch {
+		case c == '\\' && quote != '\'':
+			i++
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+		case c == quote:
+			quote = 0
+		case quote != 0 && strings.HasPrefix(t.Command[i:], "{{"):
+			if m := placeholderPattern.FindStringSubmatch(t.Command[i:]); m != nil {
+				return fmt.Errorf("parameter {{%s}} is inside quotes; leave it unquoted, values are quoted for you", m[1])
+			}
+		}
+	}
+	return nil
+}
+
+// Render fills in the command's parameters from args, which are either
+// name=value or positional values in parameter order. Unset parameters
+// take their defaults. Every value is shell-quoted.
+func (t Tick) Render(args []string) (string, error) {
+	params := t.Parameters()
+	if len(params) == 0 {
+		if len(args) > 0 {
+			return "", fmt.Errorf("tick takes no parameters")
+		}
+		return t.Command, nil
+	}
+
+	known := make(map[string]bool, len(params))
+	for _, p := range params {
+		known[p.Name] = true
+	}
+	values := make(map[string]string)
+	var positional []string
+	for _, arg := range args {
+		if name, value, ok := strings.Cut(arg, "="); ok && known[name] {
+			values[name] = value
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+
+	next := 0
+	for _, p := range params {
+		if _, ok := values[p.Name]; ok {
+			continue
+		}
+		if next < len(positional) {
+			values[p.Name] = positional[next]
+			next++
+		} else if p.Default != nil {
+			values[p.Name] = *p.Default
+		} else {
+			return "", fmt.Errorf("missing parameter %q (usage: %s)", p.Name, usage(params))
+		}
+	}
+	if next < len(positional) {
+		return "", fmt.Errorf("unexpected argument %q (usage: %s)", positional[next], usage(params))
+	}
+
+	return placeholderPattern.ReplaceAllStringFunc(t.Command, func(s string) string {
+		return ShellQuote(values[placeholderPattern.FindStringSubmatch(s)[1]])
+	}), nil
+}
+
+// usage describes how to pass params, e.g. "pkg=<pkg> [filter=.]"
+func usage(params []Param) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		if p.Default == nil {
+			parts[i] = fmt.Sprintf("%s=<%s>", p.Name, p.Name)
+		} else {
+			parts[i] = fmt.Sprintf("[%s]", p)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Generalize turns a concrete command into a template: each parameter
+// whose {{name}} isn't in the command yet replaces its default value
+// wherever the value appears as a whole word, e.g. "go test ./api/..." with
+// pkg=api becomes "go test ./{{pkg}}/...". Longer values are replaced
+// first, so env=prod doesn't take the prod out of tag=prod-1.
+func Generalize(command string, params []Param) (string, error) {
+	params = slices.Clone(params)
+	slices.SortStableFunc(params, func(a, b Param) int {
+		return valueLen(b) - valueLen(a)
+	})
+	for _, p := range params {
+		if strings.Contains(command, "{{"+p.Name+"}}") {
+			continue
+		}
+		if p.Default == nil || *p.Default == "" {
+			return "", fmt.Errorf("parameter %q needs a value that appears in the command, or {{%s}} in the command", p.Name, p.Name)
+		}
+		var found bool
+		command, found = replaceWord(command, *p.Default, "{{"+p.Name+"}}")
+		if !found {
+			return "", fmt.Errorf("%q (parameter %s) does not appear in the command", *p.Default, p.Name)
+		}
+	}
+	return command, nil
+}
+
+func valueLen(p Param) int {
+	if p.Default == nil {
+		return 0
+	}
+	return len(*p.Default)
+}
+
+// replaceWord replaces each whole-word occurrence of old in s, leaving
+// existing {{placeholders}} alone
+func replaceWord(s, old, new string) (string, bool) {
+	isWord := func(i int) bool {
+		if i < 0 || i >= len(s) {
+			return false
+		}
+		c := s[i]
+		return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+	}
+
+	var b strings.Builder
+	found := false
+	for i := 0; i < len(s); {
+		if loc := placeholderPattern.FindStringIndex(s[i:]); strings.HasPrefix(s[i:], "{{") && loc != nil && loc[0] == 0 {
+			b.WriteString(s[i : i+loc[1]])
+			i += loc[1]
+			continue
+		}
+		if strings.HasPrefix(s[i:], old) && !isWord(i-1) && !isWord(i+len(old)) {
+			b.WriteString(new)
+			i += len(old)
+			found = true
+			continue
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String(), found
+}
+
+// ShellQuote quotes s for use as one word in a POSIX shell command. Words
+// made only of safe characters are left as they are.
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("_-./:=@%+,", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,176 @@
+package tick
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "''"},
+		{"api", "api"},
+		{"./cmd/...", "./cmd/..."},
+		{"a=b,c@d:1%2+3", "a=b,c@d:1%2+3"},
+		{"two words", "'two words'"},
+		{"it's", `'it'\''s'`},
+		{`say "hi"`, `'say "hi"'`},
+		{"$HOME", "'$HOME'"},
+		{"`id`", "'`id`'"},
+		{"$(id)", "'$(id)'"},
+		{"a\nb", "'a\nb'"},
+		{"*.go", "'*.go'"},
+		{"a;rm -rf /", "'a;rm -rf /'"},
+		{`back\slash`, `'back\slash'`},
+		{"''", `''\'''\'''`},
+	}
+	for _, tt := range tests {
+		got := ShellQuote(tt.in)
+		if got != tt.want {
+			t.Errorf("ShellQuote(%q) = %q, want %q", tt.in, got, tt.want)
+			continue
+		}
+		// The shell reads it back as the original, as a single word
+		out, err := exec.Command("sh", "-c", "printf '%s|' "+got).Output()
+		if err != nil {
+			t.Fatalf("sh: %v", err)
+		}
+		if string(out) != tt.in+"|" {
+			t.Errorf("sh read ShellQuote(%q) back as %q", tt.in, out)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	filter := "."
+	empty := ""
+	test := Tick{
+		Command: "go test ./{{pkg}}/... -run {{filter}}",
+		Params:  []Param{{Name: "filter", Default: &filter}},
+	}
+
+	tests := []struct {
+		name    string
+		tick    Tick
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{name: "no params", tick: Tick{Command: "make"}, want: "make"},
+		{name: "no params with args", tick: Tick{Command: "make"}, args: []string{"x"}, wantErr: "takes no parameters"},
+		{name: "by name", tick: test, args: []string{"filter=TestFoo", "pkg=api"}, want: "go test ./api/... -run TestFoo"},
+		{name: "positional", tick: test, args: []string{"api", "TestFoo"}, want: "go test ./api/... -run TestFoo"},
+		{name: "default", tick: test, args: []string{"web"}, want: "go test ./web/... -run ."},
+		{name: "missing", tick: test, args: []string{"filter=x"}, wantErr: `missing parameter "pkg" (usage: pkg=<pkg> [filter=.])`},
+		{name: "none given", tick: test, wantErr: `missing parameter "pkg"`},
+		{name: "too many", tick: test, args: []string{"api", "x", "y"}, wantErr: `unexpected argument "y"`},
+		{name: "unknown name is positional", tick: test, args: []string{"pkg=api", "color=red"}, want: "go test ./api/... -run color=red"},
+		{name: "unknown name left over", tick: test, args: []string{"pkg=api", "filter=x", "color=red"}, wantErr: `unexpected argument "color=red"`},
+		{name: "empty value", tick: test, args: []string{"pkg=", "filter="}, want: "go test ./''/... -run ''"},
+		{
+			name: "empty default",
+			tick: Tick{Command: "ls {{flags}}", Params: []Param{{Name: "flags", Default: &empty}}},
+			want: "ls ''",
+		},
+		{name: "quotes", tick: test, args: []string{"api", `it's "x"`}, want: `go test ./api/... -run 'it'\''s "x"'`},
+		{name: "dollar", tick: test, args: []string{"api", "$HOME"}, want: "go test ./api/... -run '$HOME'"},
+		{name: "backticks", tick: test, args: []string{"api", "`rm -rf ~`"}, want: "go test ./api/... -run '`rm -rf ~`'"},
+		{name: "newline", tick: test, args: []string{"api", "a\nb"}, want: "go test ./api/... -run 'a\nb'"},
+		{name: "value with equals", tick: test, args: []string{"pkg=a=b"}, want: "go test ./a=b/... -run ."},
+		{
+			name: "repeated placeholder",
+			tick: Tick{Command: "cp {{f}} {{f}}.bak"},
+			args: []string{"my file"},
+			want: "cp 'my file' 'my file'.bak",
+		},
+		{
+			name: "spaces inside braces",
+			tick: Tick{Command: "echo {{ msg }}"},
+			args: []string{"hi there"},
+			want: "echo 'hi there'",
+		},
+	}
+	for _, tt := range tests {
+		got, err := tt.tick.Render(tt.args)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: Render(%q) = %q, %v, want error %q", tt.name, tt.args, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Render(%q) = %q, %v, want %q", tt.name, tt.args, got, err, tt.want)
+		}
+	}
+}
+
+func TestGeneralize(t *testing.T) {
+	param := func(s string) Param {
+		p, err := ParseParam(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	tests := []struct {
+		command string
+		params  []string
+		want    string
+		wantErr string
+	}{
+		{"go test ./api/...", []string{"pkg=api"}, "go test ./{{pkg}}/...", ""},
+		{"cp api api.bak", []string{"f=api"}, "cp {{f}} {{f}}.bak", ""},
+		{"go test ./apis/... ./api/...", []string{"pkg=api"}, "go test ./apis/... ./{{pkg}}/...", ""},
+		{"go test ./{{pkg}}/...", []string{"pkg=api"}, "go test ./{{pkg}}/...", ""},
+		{"deploy prod --tag prod-1", []string{"env=prod", "tag=prod-1"}, "deploy {{env}} --tag {{tag}}", ""},
+		{"run {{a}} a", []string{"a=a"}, "run {{a}} a", ""},
+		{"make", nil, "make", ""},
+		{"go test ./api/...", []string{"pkg"}, "", `parameter "pkg" needs a value`},
+		{"go test ./api/...", []string{"pkg="}, "", `parameter "pkg" needs a value`},
+		{"go test ./api/...", []string{"pkg=web"}, "", `"web" (parameter pkg) does not appear in the command`},
+		{"go test ./apis/...", []string{"pkg=api"}, "", "does not appear"},
+	}
+	for _, tt := range tests {
+		var params []Param
+		for _, s := range tt.params {
+			params = append(params, param(s))
+		}
+		got, err := Generalize(tt.command, params)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Generalize(%q, %q) = %q, %v, want error %q", tt.command, tt.params, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Generalize(%q, %q) = %q, %v, want %q", tt.command, tt.params, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	dot := "."
+	tests := []struct {
+		tick    Tick
+		wantErr string
+	}{
+		{Tick{Command: "go test ./{{pkg}}/... -run {{filter}}", Params: []Param{{Name: "filter", Default: &dot}}}, ""},
+		{Tick{Command: "echo {{x}}", Params: []Param{{Name: "y"}}}, `parameter "y" is not used`},
+		{Tick{Command: "echo {{x}}", Params: []Param{{Name: "x"}, {Name: "x"}}}, "declared twice"},
+		{Tick{Command: "echo {{x}}", Params: []Param{{Name: "1x"}}}, "invalid parameter name"},
+		{Tick{Command: `echo "{{x}}"`}, "inside quotes"},
+		{Tick{Command: `echo '{{x}}'`}, "inside quotes"},
+		{Tick{Command: `echo "a" {{x}} 'b'`}, ""},
+		{Tick{Command: `echo \"{{x}}`}, ""},
+	}
+	for _, tt := range tests {
+		err := tt.tick.validateParams()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("validateParams(%q) = %v, want %q", tt.tick.Command, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package tick
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ProjectFiles are the names of project tick files, in the order they are
+// looked for in each directory. Only the first one found in a directory is read.
+var ProjectFiles = []string{".watchy.yaml", "watchy.json"}
+
+// projectFile is the layout of a project tick file. Ticks use the same
+// fields as ~/.watchy/ticks.json.
+type projectFile struct {
+	Ticks map[string]Tick `json:"ticks"`
+}
+
+// LoadProject adds the ticks from project files in dir and each of its
+// parents. A tick in a nearer file shadows one with the same name further
+// up, and project ticks shadow global ones. Project ticks run in the
+// directory of the file that defines them, unless they set their own cwd
+// (relative paths are resolved against that directory).
+func (s *Store) LoadProject(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	for {
+		for _, name := range ProjectFiles {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			if err := s.loadProjectFile(path); err != nil {
+				return err
+			}
+			break
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+func (s *Store) loadProjectFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if filepath.Ext(path) == ".yaml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	var f projectFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	root := filepath.Dir(path)
+	for name, t := range f.Ticks {
+		if _, nearer := s.sources[name]; nearer {
+			continue
+		}
+		if !ValidName(name) || reservedNames[name] {
+			return fmt.Errorf("%s: invalid tick name %q", path, name)
+		}
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("%s: tick %q: %w", path, name, err)
+		}
+		switch {
+		case t.Cwd == "":
+			t.Cwd = root
+		case !filepath.IsAbs(t.Cwd):
+			t.Cwd = filepath.Join(root, t.Cwd)
+		}
+		s.project[name] = t
+		s.sources[name] = path
+	}
+	return nil
+}
+
+// Source returns the project file a tick comes from, or "" for a global tick
+func (s *Store) Source(name string) string {
+	return s.sources[name]
+}
+
+// Shadows reports whether name is a project tick that hides a global tick
+// of the same name
+func (s *Store) Shadows(name string) bool {
+	_, inProject := s.project[name]
+	_, global := s.ticks[name]
+	return inProject && global
+}
+
+// checkGlobal returns an error if name is a project tick, which can only be
+// changed by editing its file
+func (s *Store) checkGlobal(name string) error {
+	if path, ok := s.sources[name]; ok {
+		return fmt.Errorf("tick %q is defined in %s; edit it there", name, path)
+	}
+	return nil
+}
+
+// UnmarshalJSON accepts a parameter either as an object or, as is handier
+// in project files, as a "name" or "name=default" string
+func (p *Param) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := ParseParam(s)
+		if err != nil {
+			return err
+		}
+		*p = parsed
+		return nil
+	}
+	type param Param // without this method
+	return json.Unmarshal(data, (*param)(p))
+}
@@ -0,0 +1,70 @@
+package tick
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadProject(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "svc", "api")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(root, ".watchy.yaml"):       "ticks:\n  test:\n    command: make test\n  lint:\n    command: make lint\n",
+		filepath.Join(root, "svc", "watchy.json"): `{"ticks": {"test": {"command": "go test ./..."}, "api": {"command": "go run .", "cwd": "api"}}}`,
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := newTestStore(t, filepath.Join(t.TempDir(), "ticks.json"))
+	for name, command := range map[string]string{"api": "./global-api", "deploy": "./deploy"} {
+		if err := s.Save(name, command, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.LoadProject(sub); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		cwd     string
+		source  string
+		shadows bool
+	}{
+		{"api", "go run .", sub, filepath.Join(root, "svc", "watchy.json"), true},
+		{"test", "go test ./...", filepath.Join(root, "svc"), filepath.Join(root, "svc", "watchy.json"), false},
+		{"lint", "make lint", root, filepath.Join(root, ".watchy.yaml"), false},
+		{"deploy", "./deploy", "", "", false},
+	}
+	for _, tt := range tests {
+		got, err := s.Get(tt.name)
+		if err != nil {
+			t.Errorf("Get(%q): %v", tt.name, err)
+			continue
+		}
+		if got.Command != tt.command || got.Cwd != tt.cwd {
+			t.Errorf("%s = %q in %q, want %q in %q", tt.name, got.Command, got.Cwd, tt.command, tt.cwd)
+		}
+		if source := s.Source(tt.name); source != tt.source {
+			t.Errorf("Source(%q) = %q, want %q", tt.name, source, tt.source)
+		}
+		if shadows := s.Shadows(tt.name); shadows != tt.shadows {
+			t.Errorf("Shadows(%q) = %v, want %v", tt.name, shadows, tt.shadows)
+		}
+	}
+
+	if n := len(s.List()); n != 4 {
+		t.Errorf("List() has %d ticks, want the shadowed global api left out", n)
+	}
+	if err := s.Remove("api"); err == nil {
+		t.Error("Remove() of a project tick succeeded")
+	}
+}
@@ -2,41 +2,175 @@ package tick
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"sort"
+	"syscall"
 	"time"
+
+	"github.com/parth/watchy/internal/atomicfile"
+	"github.com/parth/watchy/internal/task"
 )
 
 // Tick represents a saved command shortcut
 type Tick struct {
-	Command     string    `json:"command"`
+	Command     string    `json:"command"` // may contain {{param}} placeholders; see Render
 	Description string    `json:"description,omitempty"`
+	Restart     string    `json:"restart,omitempty"`       // restart policy: never, on-failure, always
+	MaxRestarts int       `json:"max_restarts,omitempty"`  // 0 means no limit
+	StopSignal  string    `json:"stop_signal,omitempty"`   // e.g. "INT" for servers that flush on SIGINT
+	StopTimeout string    `json:"stop_timeout,omitempty"`  // grace period before SIGKILL, e.g. "30s"
+	LogMaxSize  string    `json:"log_max_size,omitempty"`  // e.g. "10MB"; "0" disables rotation
+	LogMaxFiles int       `json:"log_max_files,omitempty"` // rotated segments to keep
+	Cwd         string    `json:"cwd,omitempty"`           // absolute; empty runs in the caller's directory
+	Env         []string  `json:"env,omitempty"`           // KEY=VALUE overrides
+	EnvFiles    []string  `json:"env_files,omitempty"`     // relative to Cwd
+	ClearEnv    bool      `json:"clear_env,omitempty"`
+	Shell       string    `json:"shell,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at,omitzero"` // zero until the tick is first changed
+
+	// Readiness probe, as accepted by task.ParseProbe, and its settings
+	Ready         string `json:"ready,omitempty"`
+	ReadyInterval string `json:"ready_interval,omitempty"`
+	ReadyTimeout  string `json:"ready_timeout,omitempty"`
+	ReadyFailures int    `json:"ready_failures,omitempty"`
+	ReadyGrace    string `json:"ready_grace,omitempty"`
+
+	// Resource limits; see task.Limits
+	Memory  string  `json:"memory,omitempty"` // e.g. "512MB"
+	CPUs    float64 `json:"cpus,omitempty"`
+	Pids    int     `json:"pids,omitempty"`
+	NoFile  int     `json:"nofile,omitempty"`
+	Timeout string  `json:"timeout,omitempty"` // wall-clock limit across restarts, e.g. "1h"
+
+	// Schedule runs the tick automatically from watchyd: a cron expression
+	// or "@every <duration>". Overlap says what happens when a run is due
+	// while the previous one is still going.
+	Schedule string `json:"schedule,omitempty"`
+	Overlap  string `json:"overlap,omitempty"` // OverlapSkip (default), OverlapQueue or OverlapReplace
+
+	// Params declares defaults for the command's parameters
+	Params []Param `json:"params,omitempty"`
+
+	// Import is set on ticks imported from a Procfile, package.json,
+	// Makefile or justfile
+	Import *ImportSource `json:"import,omitempty"`
 }
 
+// Overlap policies for scheduled ticks
+const (
+	OverlapSkip    = "skip"    // don't start the new run
+	OverlapQueue   = "queue"   // start it once the previous run ends
+	OverlapReplace = "replace" // stop the previous run and start the new one
+)
+
 // NamedTick pairs a tick name with its data
 type NamedTick struct {
-	Name string
-	Tick Tick
+	Name   string
+	Tick   Tick
+	Source string // project file the tick comes from; "" for the global file
+}
+
+// StartOptions converts the tick's saved settings into task start options
+func (t Tick) StartOptions() (task.StartOptions, error) {
+	opts := task.StartOptions{
+		Restart:     t.Restart,
+		MaxRestarts: t.MaxRestarts,
+		StopSignal:  t.StopSignal,
+		Cwd:         t.Cwd,
+		Env:         t.Env,
+		EnvFiles:    t.EnvFiles,
+		ClearEnv:    t.ClearEnv,
+		Shell:       t.Shell,
+	}
+	if t.StopTimeout != "" {
+		d, err := time.ParseDuration(t.StopTimeout)
+		if err != nil {
+			return opts, fmt.Errorf("invalid stop_timeout %q: %w", t.StopTimeout, err)
+		}
+		opts.StopTimeout = d
+	}
+	if t.LogMaxSize != "" {
+		n, err := task.ParseSize(t.LogMaxSize)
+		if err != nil {
+			return opts, fmt.Errorf("invalid log_max_size: %w", err)
+		}
+		opts.Log.MaxSize = n
+	}
+	opts.Log.MaxFiles = t.LogMaxFiles
+
+	if t.Memory != "" {
+		n, err := task.ParseSize(t.Memory)
+		if err != nil {
+			return opts, fmt.Errorf("invalid memory: %w", err)
+		}
+		opts.Limits.Memory = max(n, 0)
+	}
+	opts.Limits.CPUs = t.CPUs
+	opts.Limits.Pids = t.Pids
+	opts.Limits.NoFile = t.NoFile
+	if t.Timeout != "" {
+		d, err := time.ParseDuration(t.Timeout)
+		if err != nil {
+			return opts, fmt.Errorf("invalid timeout %q: %w", t.Timeout, err)
+		}
+		opts.Limits.Timeout = d
+	}
+
+	if t.Ready != "" {
+		p, err := task.ParseProbe(t.Ready)
+		if err != nil {
+			return opts, err
+		}
+		p.FailureThreshold = t.ReadyFailures
+		for _, d := range []struct {
+			field string
+			value string
+			dest  *time.Duration
+		}{
+			{"ready_interval", t.ReadyInterval, &p.Interval},
+			{"ready_timeout", t.ReadyTimeout, &p.Timeout},
+			{"ready_grace", t.ReadyGrace, &p.Grace},
+		} {
+			if d.value == "" {
+				continue
+			}
+			v, err := time.ParseDuration(d.value)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %s %q: %w", d.field, d.value, err)
+			}
+			*d.dest = v
+		}
+		opts.Ready = p
+	}
+	return opts, nil
 }
 
-// Store manages the collection of ticks
+// Store manages the collection of ticks: the global ones, which it can
+// change, and any read-only project ticks added by LoadProject
 type Store struct {
 	path  string
 	ticks map[string]Tick
+
+	project map[string]Tick
+	sources map[string]string // project tick name -> file
 }
 
 var reservedNames = map[string]bool{
 	"start": true, "stop": true, "list": true, "logs": true,
-	"ask": true, "cleanup": true, "tick": true,
+	"ask": true, "cleanup": true, "tick": true, "db": true, "daemon": true, "__log-writer": true, "__run-limited": true, "__sandbox": true,
+	"up": true, "down": true, "stack": true, "top": true, "chat": true,
 }
 
 // NewStore creates a Store for the given JSON file path, loading existing ticks if the file exists.
 func NewStore(path string) (*Store, error) {
 	s := &Store{
-		path:  path,
-		ticks: make(map[string]Tick),
+		path:    path,
+		ticks:   make(map[string]Tick),
+		project: make(map[string]Tick),
+		sources: make(map[string]string),
 	}
 	if err := s.load(); err != nil {
 		return nil, err
@@ -52,7 +186,41 @@ func (s *Store) load() error {
 		}
 		return err
 	}
-	return json.Unmarshal(data, &s.ticks)
+	ticks := make(map[string]Tick)
+	if err := json.Unmarshal(data, &ticks); err != nil {
+		return err
+	}
+	s.ticks = ticks
+	return nil
+}
+
+// errUnchanged tells update that a change left the ticks as they were
+var errUnchanged = errors.New("ticks unchanged")
+
+// update re-reads the global ticks, applies change and saves them, holding
+// a lock on the file throughout. watchyd syncs imported ticks while watchy
+// commands save and edit others, so each change has to start from what
+// the last one wrote.
+func (s *Store) update(change func() error) error {
+	f, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", f.Name(), err)
+	}
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		if errors.Is(err, errUnchanged) {
+			return nil
+		}
+		return err
+	}
+	return s.save()
 }
 
 func (s *Store) save() error {
@@ -60,30 +228,139 @@ func (s *Store) save() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.path, data, 0644)
+	return atomicfile.WriteFile(s.path, data, 0644)
 }
 
 // Save saves a new tick. Returns error if name is reserved or already exists.
 func (s *Store) Save(name, command, description string) error {
-	if !isValidName(name) {
+	return s.SaveTick(name, Tick{Command: command, Description: description})
+}
+
+// SaveTick saves a new tick with all of its fields. CreatedAt is set automatically.
+// Returns error if name is reserved or already exists.
+func (s *Store) SaveTick(name string, t Tick) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+	return s.update(func() error {
+		if err := s.checkNewName(name); err != nil {
+			return err
+		}
+		t.CreatedAt = time.Now()
+		t.UpdatedAt = time.Time{}
+		s.ticks[name] = t
+		return nil
+	})
+}
+
+// Update replaces an existing tick's fields, keeping its CreatedAt and
+// setting UpdatedAt
+func (s *Store) Update(name string, t Tick) error {
+	if err := s.checkGlobal(name); err != nil {
+		return err
+	}
+	if err := t.validate(); err != nil {
+		return err
+	}
+	return s.update(func() error {
+		old, ok := s.ticks[name]
+		if !ok {
+			return fmt.Errorf("tick %q not found", name)
+		}
+		t.CreatedAt = old.CreatedAt
+		t.UpdatedAt = time.Now()
+		s.ticks[name] = t
+		return nil
+	})
+}
+
+// Rename gives a tick a new name. Returns error if the new name is reserved
+// or taken.
+func (s *Store) Rename(name, newName string) error {
+	if err := s.checkGlobal(name); err != nil {
+		return err
+	}
+	return s.update(func() error {
+		t, ok := s.ticks[name]
+		if !ok {
+			return fmt.Errorf("tick %q not found", name)
+		}
+		if err := s.checkNewName(newName); err != nil {
+			return err
+		}
+		t.UpdatedAt = time.Now()
+		delete(s.ticks, name)
+		s.ticks[newName] = t
+		return nil
+	})
+}
+
+// checkNewName returns an error if name can't be used for a new tick
+func (s *Store) checkNewName(name string) error {
+	if !ValidName(name) {
 		return fmt.Errorf("invalid tick name %q (use alphanumeric, dash, or underscore)", name)
 	}
 	if reservedNames[name] {
 		return fmt.Errorf("%q is a reserved command name", name)
 	}
+	if err := s.checkGlobal(name); err != nil {
+		return err
+	}
 	if _, exists := s.ticks[name]; exists {
-		return fmt.Errorf("tick %q already exists (use rm first to replace)", name)
+		return fmt.Errorf("tick %q already exists (use tick edit to change it)", name)
 	}
-	s.ticks[name] = Tick{
-		Command:     command,
-		Description: description,
-		CreatedAt:   time.Now(),
+	return nil
+}
+
+func (t Tick) validate() error {
+	if t.Command == "" {
+		return fmt.Errorf("tick has no command")
 	}
-	return s.save()
+	if err := validateOverlap(t.Overlap); err != nil {
+		return err
+	}
+	return t.validateParams()
+}
+
+// SetSchedule sets or, with an empty spec, clears a tick's schedule.
+// The spec is not parsed here; see scheduler.Parse.
+// Project ticks can't be scheduled, as watchyd only reads the global file.
+func (s *Store) SetSchedule(name, spec, overlap string) error {
+	if err := s.checkGlobal(name); err != nil {
+		return err
+	}
+	if err := validateOverlap(overlap); err != nil {
+		return err
+	}
+	if spec == "" {
+		overlap = ""
+	}
+	return s.update(func() error {
+		t, ok := s.ticks[name]
+		if !ok {
+			return fmt.Errorf("tick %q not found", name)
+		}
+		t.Schedule = spec
+		t.Overlap = overlap
+		t.UpdatedAt = time.Now()
+		s.ticks[name] = t
+		return nil
+	})
+}
+
+func validateOverlap(overlap string) error {
+	switch overlap {
+	case "", OverlapSkip, OverlapQueue, OverlapReplace:
+		return nil
+	}
+	return fmt.Errorf("invalid overlap policy %q (use skip, queue, or replace)", overlap)
 }
 
 // Get returns a tick by name, or an error if not found.
 func (s *Store) Get(name string) (Tick, error) {
+	if t, ok := s.project[name]; ok {
+		return t, nil
+	}
 	t, ok := s.ticks[name]
 	if !ok {
 		return Tick{}, fmt.Errorf("tick %q not found", name)
@@ -93,18 +370,29 @@ func (s *Store) Get(name string) (Tick, error) {
 
 // Remove deletes a tick by name. Returns error if not found.
 func (s *Store) Remove(name string) error {
-	if _, ok := s.ticks[name]; !ok {
-		return fmt.Errorf("tick %q not found", name)
+	if err := s.checkGlobal(name); err != nil {
+		return err
 	}
-	delete(s.ticks, name)
-	return s.save()
+	return s.update(func() error {
+		if _, ok := s.ticks[name]; !ok {
+			return fmt.Errorf("tick %q not found", name)
+		}
+		delete(s.ticks, name)
+		return nil
+	})
 }
 
-// List returns all ticks sorted by name.
+// List returns all ticks sorted by name. Global ticks shadowed by project
+// ticks are left out.
 func (s *Store) List() []NamedTick {
-	result := make([]NamedTick, 0, len(s.ticks))
+	result := make([]NamedTick, 0, len(s.ticks)+len(s.project))
+	for name, t := range s.project {
+		result = append(result, NamedTick{Name: name, Tick: t, Source: s.sources[name]})
+	}
 	for name, t := range s.ticks {
-		result = append(result, NamedTick{Name: name, Tick: t})
+		if _, shadowed := s.project[name]; !shadowed {
+			result = append(result, NamedTick{Name: name, Tick: t})
+		}
 	}
 	sort.Slice(result, func(i, j int) bool {
 		return result[i].Name < result[j].Name
@@ -115,10 +403,13 @@ func (s *Store) List() []NamedTick {
 // Has returns true if a tick with the given name exists.
 func (s *Store) Has(name string) bool {
 	_, ok := s.ticks[name]
-	return ok
+	_, inProject := s.project[name]
+	return ok || inProject
 }
 
-func isValidName(name string) bool {
+// ValidName reports whether name can be used for a tick or stack: letters,
+// digits, dashes and underscores
+func ValidName(name string) bool {
 	if name == "" {
 		return false
 	}
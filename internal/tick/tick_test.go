@@ -0,0 +1,119 @@
+package tick
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStoreKeepsOtherWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ticks.json")
+	a := newTestStore(t, path)
+	b := newTestStore(t, path)
+
+	if err := a.Save("web", "npm start", ""); err != nil {
+		t.Fatal(err)
+	}
+	// b was loaded before web was saved, and must not write it away
+	if err := b.Save("api", "./api", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetSchedule("web", "@daily", ""); err != nil {
+		t.Errorf("SetSchedule on a tick saved by another store: %v", err)
+	}
+	if err := a.Save("api", "./other", ""); err == nil {
+		t.Error("Save of a name another store took succeeded")
+	}
+
+	got := newTestStore(t, path)
+	web, _ := got.Get("web")
+	if !got.Has("api") || web.Schedule != "@daily" {
+		t.Errorf("ticks on disk = %+v", got.List())
+	}
+}
+
+func TestStoreConcurrentSaves(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ticks.json")
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := NewStore(path)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := s.Save(fmt.Sprintf("t%d", i), "true", ""); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(newTestStore(t, path).List()); n != 20 {
+		t.Errorf("%d ticks saved, want 20", n)
+	}
+}
+
+func TestSyncKeepsOtherWriters(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ticks.json")
+	procfile := filepath.Join(dir, "Procfile")
+	if err := os.WriteFile(procfile, []byte("web: node a.js\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestStore(t, path)
+	src := ImportSource{Format: FormatProcfile, Path: procfile, Prefix: "pf", Sync: true}
+	ticks, err := ParseImport(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ApplyImport(s.PlanImport(src, ticks)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Meanwhile another command saves a tick and gives the imported one a
+	// restart policy
+	other := newTestStore(t, path)
+	if err := other.Save("api", "./api", ""); err != nil {
+		t.Fatal(err)
+	}
+	web, _ := other.Get("pf-web")
+	web.Restart = "always"
+	if err := other.Update("pf-web", web); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stale store syncs the changed file
+	if err := os.WriteFile(procfile, []byte("web: node b.js\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(procfile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := s.Sync()
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("Sync() = %q, %v", changes, err)
+	}
+
+	got := newTestStore(t, path)
+	web, _ = got.Get("pf-web")
+	if !got.Has("api") || web.Command != "node b.js" || web.Restart != "always" {
+		t.Errorf("after sync, api kept = %v, pf-web = %+v", got.Has("api"), web)
+	}
+}
@@ -0,0 +1,76 @@
+package tick
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Ticks are written as YAML for people (project files, tick show and tick
+// edit) but keep their JSON field names. Going through JSON keeps the names
+// and order of ticks.json without a second set of struct tags.
+
+// yamlToJSON converts a YAML document to JSON
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// YAML formats the tick as YAML, leaving out the given fields
+// (by their JSON names)
+func (t Tick) YAML(omit ...string) ([]byte, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is YAML, so this keeps the fields in order
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	mapping := doc.Content[0]
+	skip := make(map[string]bool, len(omit))
+	for _, name := range omit {
+		skip[name] = true
+	}
+	var content []*yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if !skip[mapping.Content[i].Value] {
+			content = append(content, mapping.Content[i], mapping.Content[i+1])
+		}
+	}
+	mapping.Content = content
+	plainStyle(&doc)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// plainStyle drops the JSON flow style and quoting, letting the encoder
+// quote only what needs it
+func plainStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		plainStyle(c)
+	}
+}
+
+// ParseYAML parses a tick written by YAML
+func ParseYAML(data []byte) (Tick, error) {
+	var t Tick
+	data, err := yamlToJSON(data)
+	if err != nil {
+		return t, err
+	}
+	err = json.Unmarshal(data, &t)
+	return t, err
+}
@@ -3,15 +3,19 @@ package tui
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/parth/watchy/internal/agent"
+	"github.com/parth/watchy/internal/config"
 	"github.com/parth/watchy/internal/logcolor"
+	"github.com/parth/watchy/internal/scheduler"
 	"github.com/parth/watchy/internal/task"
+	"github.com/parth/watchy/internal/tick"
 )
 
-func fetchTasks(mgr *task.Manager) tea.Cmd {
+func fetchTasks(mgr task.Controller) tea.Cmd {
 	return func() tea.Msg {
 		tasks, err := mgr.ListTasks()
 		if err != nil {
@@ -21,8 +25,48 @@ func fetchTasks(mgr *task.Manager) tea.Cmd {
 	}
 }
 
-func fetchLogs(mgr *task.Manager, taskID int) tea.Cmd {
+// metricsWindow is how far back fetchMetrics looks for the task list sparklines
+const metricsWindow = 2 * time.Minute
+
+// fetchMetrics loads recent resource usage for each running task
+func fetchMetrics(mgr task.Controller, tasks []*task.Task) tea.Cmd {
+	var ids []int
+	for _, t := range tasks {
+		if t.Alive() {
+			ids = append(ids, t.ID)
+		}
+	}
+	return func() tea.Msg {
+		since := time.Now().Add(-metricsWindow)
+		metrics := make(metricsMsg, len(ids))
+		for _, id := range ids {
+			if samples, err := mgr.TaskMetrics(id, since); err == nil && len(samples) > 0 {
+				metrics[id] = samples
+			}
+		}
+		return metrics
+	}
+}
+
+// fetchSchedules loads the scheduled ticks, re-reading the tick file since
+// schedules are usually changed from the CLI
+func fetchSchedules(mgr task.Controller, cfg *config.Config) tea.Cmd {
 	return func() tea.Msg {
+		store, err := tick.NewStore(cfg.TicksPath)
+		if err != nil {
+			return nil
+		}
+		state, _ := scheduler.LoadState(cfg.SchedulePath)
+		return schedulesMsg(scheduler.Entries(store.List(), state, mgr, time.Now()))
+	}
+}
+
+func fetchLogs(mgr task.Controller, taskID int, view logView) tea.Cmd {
+	return func() tea.Msg {
+		if view.filtered() {
+			return fetchLogLines(mgr, taskID, view)
+		}
+
 		lines, err := mgr.TailLogs(taskID, 200)
 		if err != nil {
 			return logContentMsg("")
@@ -38,18 +82,39 @@ func fetchLogs(mgr *task.Manager, taskID int) tea.Cmd {
 	}
 }
 
-// sendToAgent runs the agent loop, sending tool call events back to the TUI
-// via p.Send so they appear in real time.
+// fetchLogLines reads the stream log for views that filter by stream or
+// time, or show timestamps
+func fetchLogLines(mgr task.Controller, taskID int, view logView) tea.Msg {
+	filter := task.LogFilter{Stream: view.stream}
+	if view.window > 0 {
+		filter.Since = time.Now().Add(-view.window)
+	}
+	lines, err := mgr.TailLogLines(taskID, 200, filter)
+	if err != nil {
+		return logContentMsg(err.Error())
+	}
+	content := make([]string, len(lines))
+	for i, l := range lines {
+		content[i] = renderLogLine(l, view)
+	}
+	return logContentMsg(strings.Join(content, "\n"))
+}
+
+// sendToAgent runs the agent loop, sending the streamed reply and tool call
+// events back to the TUI via p.Send so they appear in real time.
 func sendToAgent(conv *agent.Conversation, msg string, ctx context.Context, p *tea.Program) tea.Cmd {
 	return func() tea.Msg {
-		resp, err := conv.SendWithEvents(ctx, msg,
-			func(evt agent.ToolStartEvent) {
+		resp, err := conv.Run(ctx, msg, agent.Events{
+			Content: func(evt agent.ContentEvent) {
+				p.Send(agentContentMsg(evt))
+			},
+			ToolStart: func(evt agent.ToolStartEvent) {
 				p.Send(agentToolStartMsg(evt))
 			},
-			func(evt agent.ToolResultEvent) {
+			ToolResult: func(evt agent.ToolResultEvent) {
 				p.Send(agentToolResultMsg(evt))
 			},
-		)
+		})
 		if err != nil {
 			if ctx.Err() != nil {
 				return agentErrorMsg{err: fmt.Errorf("cancelled")}
@@ -60,14 +125,29 @@ func sendToAgent(conv *agent.Conversation, msg string, ctx context.Context, p *t
 	}
 }
 
-func stopTask(mgr *task.Manager, id int) tea.Cmd {
+// approveInChat asks about tool calls in the chat pane. It runs on the
+// agent's goroutine and waits for the answer from Update.
+func approveInChat(ref *programRef) agent.Approver {
+	return func(ctx context.Context, req agent.ApprovalRequest) (agent.Decision, error) {
+		reply := make(chan agent.Decision, 1)
+		ref.p.Send(agentApprovalMsg{req: req, reply: reply})
+		select {
+		case d := <-reply:
+			return d, nil
+		case <-ctx.Done():
+			return agent.Deny, ctx.Err()
+		}
+	}
+}
+
+func stopTask(mgr task.Controller, id int) tea.Cmd {
 	return func() tea.Msg {
-		mgr.StopTask(id)
+		mgr.StopTask(id, task.StopOptions{Reason: task.ReasonUserStop})
 		return taskStoppedMsg(id)
 	}
 }
 
-func restartTaskCmd(mgr *task.Manager, id int) tea.Cmd {
+func restartTaskCmd(mgr task.Controller, id int) tea.Cmd {
 	return func() tea.Msg {
 		newTaskID, err := mgr.RestartTask(id)
 		if err != nil {
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/parth/watchy/internal/agent"
+	"github.com/parth/watchy/internal/scheduler"
 	"github.com/parth/watchy/internal/task"
 )
 
@@ -11,9 +12,19 @@ type tasksUpdatedMsg []*task.Task
 type logContentMsg string
 type agentResponseMsg string
 type agentErrorMsg struct{ err error }
+type agentContentMsg agent.ContentEvent
 type agentToolStartMsg agent.ToolStartEvent
 type agentToolResultMsg agent.ToolResultEvent
+
+// agentApprovalMsg is a tool call waiting for the user's y/n/a in the chat
+// pane; the answer goes back on reply
+type agentApprovalMsg struct {
+	req   agent.ApprovalRequest
+	reply chan<- agent.Decision
+}
 type taskStoppedMsg int
 type taskRestartedMsg int64
 type selectTaskMsg int
 type tickMsg time.Time
+type metricsMsg map[int][]task.Metric
+type schedulesMsg []scheduler.Entry
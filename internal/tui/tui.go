@@ -2,6 +2,7 @@ package tui
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	"github.com/charmbracelet/bubbles/textinput"
@@ -10,6 +11,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/parth/watchy/internal/agent"
 	"github.com/parth/watchy/internal/config"
+	"github.com/parth/watchy/internal/scheduler"
 	"github.com/parth/watchy/internal/task"
 	"github.com/parth/watchy/internal/tick"
 )
@@ -29,8 +31,10 @@ const (
 )
 
 type chatMessage struct {
-	role    string // "user", "agent", or "tool"
-	content string
+	role      string // "user", "agent", or "tool"
+	content   string
+	thinking  string // the model's reasoning before an agent reply
+	streaming bool   // an agent reply still arriving
 }
 
 type slashCommand struct {
@@ -42,17 +46,34 @@ var slashCommands = []slashCommand{
 	{"/model", "Show or change the model"},
 	{"/save", "Save a command as a tick"},
 	{"/new", "Clear chat and start fresh"},
+	{"/sessions", "List saved chats, or resume one by ID"},
+}
+
+// logWindows are the time windows the log pane cycles through with w
+var logWindows = []time.Duration{0, 5 * time.Minute, 15 * time.Minute, time.Hour}
+
+// logView is the log pane's filter, captured when logs are fetched
+type logView struct {
+	stream     string
+	window     time.Duration
+	timestamps bool
+}
+
+func (v logView) filtered() bool {
+	return v.stream != "" || v.window > 0 || v.timestamps
 }
 
 // Model is the root bubbletea model
 type Model struct {
-	mgr          *task.Manager
+	mgr          task.Controller
 	agent        *agent.Agent
 	conversation *agent.Conversation
 	cfg          *config.Config
 	tickStore    *tick.Store
 
 	tasks       []*task.Task
+	metrics     map[int][]task.Metric // recent samples of running tasks, by task ID
+	schedules   []scheduler.Entry
 	selectedIdx int
 	activePane  pane
 	rightMode   mode
@@ -66,11 +87,19 @@ type Model struct {
 	chatHistory    []chatMessage
 	agentBusy      bool
 	agentCancel    context.CancelFunc
+	approval       *agentApprovalMsg // tool call waiting for y/n/a
+	showThinking   bool              // expand the model's thinking in chat
+	focusTask      int               // task to select once tasks load, from a resumed chat
 	programRef     *programRef
 	slashPickerIdx int
 	width          int
 	height         int
 
+	// Log filter state
+	logStream     string        // "", task.StreamStdout or task.StreamStderr
+	logWindow     time.Duration // only show output from this far back; 0 for all
+	logTimestamps bool
+
 	// Log search state
 	searchMode         bool
 	searchInput        textinput.Model
@@ -80,8 +109,18 @@ type Model struct {
 	originalLogContent string
 }
 
+// groupByStack orders tasks so those started by "watchy up" sit together
+// under their stack: tasks without a stack first, then each stack by name.
+// Order within a group is unchanged.
+func groupByStack(tasks []*task.Task) []*task.Task {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].Options.Stack < tasks[j].Options.Stack
+	})
+	return tasks
+}
+
 // New creates a new TUI model
-func New(mgr *task.Manager, ag *agent.Agent, cfg *config.Config, tickStore *tick.Store) Model {
+func New(mgr task.Controller, ag *agent.Agent, cfg *config.Config, tickStore *tick.Store) Model {
 	ti := textarea.New()
 	ti.Placeholder = "Ask the agent..."
 	ti.SetHeight(3)
@@ -92,6 +131,8 @@ func New(mgr *task.Manager, ag *agent.Agent, cfg *config.Config, tickStore *tick
 	si.Prompt = "/"
 	si.Width = 30
 
+	ref := &programRef{}
+	ag.SetApprover(approveInChat(ref))
 	conv := ag.NewConversation()
 
 	// Find theme index from config
@@ -116,8 +157,20 @@ func New(mgr *task.Manager, ag *agent.Agent, cfg *config.Config, tickStore *tick
 		chatViewport: viewport.New(0, 0),
 		chatInput:    ti,
 		searchInput:  si,
-		programRef:   &programRef{},
+		programRef:   ref,
+	}
+}
+
+// OpenChat starts the TUI in the chat pane, resuming the saved chat session
+// sessionID unless it is 0
+func (m *Model) OpenChat(sessionID int) error {
+	m.rightMode = modeChat
+	m.activePane = paneRight
+	m.chatInput.Focus()
+	if sessionID == 0 {
+		return nil
 	}
+	return m.resumeSession(sessionID)
 }
 
 type programRef struct {
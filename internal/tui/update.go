@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/parth/watchy/internal/agent"
 	"github.com/parth/watchy/internal/task"
+	"github.com/parth/watchy/internal/tick"
 )
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -25,19 +29,33 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tickMsg:
 		cmds = append(cmds, tickEvery(2*time.Second))
 		cmds = append(cmds, fetchTasks(m.mgr))
+		cmds = append(cmds, fetchMetrics(m.mgr, m.tasks))
+		cmds = append(cmds, fetchSchedules(m.mgr, m.cfg))
 		if len(m.tasks) > 0 && m.selectedIdx < len(m.tasks) && m.rightMode == modeLog {
-			cmds = append(cmds, fetchLogs(m.mgr, m.tasks[m.selectedIdx].ID))
+			cmds = append(cmds, fetchLogs(m.mgr, m.tasks[m.selectedIdx].ID, m.logView()))
 		}
 		return m, tea.Batch(cmds...)
 
 	case tasksUpdatedMsg:
-		m.tasks = ([]*task.Task)(msg)
+		m.tasks = groupByStack(msg)
 		if m.selectedIdx >= len(m.tasks) && len(m.tasks) > 0 {
 			m.selectedIdx = len(m.tasks) - 1
 		}
+		if m.focusTask != 0 {
+			m.selectTask(m.focusTask)
+			m.focusTask = 0
+		}
 		m.conversation.RefreshSystemPrompt()
 		return m, nil
 
+	case metricsMsg:
+		m.metrics = msg
+		return m, nil
+
+	case schedulesMsg:
+		m.schedules = msg
+		return m, nil
+
 	case logContentMsg:
 		m.originalLogContent = string(msg)
 		atBottom := m.logViewport.AtBottom()
@@ -54,7 +72,20 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, nil
 
+	case agentContentMsg:
+		n := len(m.chatHistory)
+		if n == 0 || !m.chatHistory[n-1].streaming {
+			m.chatHistory = append(m.chatHistory, chatMessage{role: "agent", streaming: true})
+			n++
+		}
+		reply := &m.chatHistory[n-1]
+		reply.content += msg.Content
+		reply.thinking += msg.Thinking
+		m.updateChatViewport()
+		return m, nil
+
 	case agentToolStartMsg:
+		m.endStream()
 		m.chatHistory = append(m.chatHistory, chatMessage{
 			role:    "tool",
 			content: fmt.Sprintf("[%s] %s", msg.Tool, msg.Args),
@@ -63,28 +94,39 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case agentToolResultMsg:
-		truncResult := msg.Result
-		if len(truncResult) > 300 {
-			truncResult = truncResult[:300] + "..."
-		}
 		m.chatHistory = append(m.chatHistory, chatMessage{
 			role:    "tool",
-			content: fmt.Sprintf("-> %s", truncResult),
+			content: toolResultLine(msg.Result),
 		})
 		m.updateChatViewport()
 		return m, nil
 
+	case agentApprovalMsg:
+		m.approval = &msg
+		m.updateChatViewport()
+		return m, nil
+
 	case agentResponseMsg:
 		m.agentBusy = false
 		m.agentCancel = nil
-		m.chatHistory = append(m.chatHistory, chatMessage{role: "agent", content: string(msg)})
+		m.approval = nil
+		if n := len(m.chatHistory); n > 0 && m.chatHistory[n-1].streaming {
+			m.chatHistory[n-1].content = string(msg)
+			m.endStream()
+		} else {
+			m.chatHistory = append(m.chatHistory, chatMessage{role: "agent", content: string(msg)})
+		}
+		m.noteSaveErr()
 		m.updateChatViewport()
 		return m, nil
 
 	case agentErrorMsg:
 		m.agentBusy = false
 		m.agentCancel = nil
+		m.approval = nil
+		m.endStream()
 		m.chatHistory = append(m.chatHistory, chatMessage{role: "agent", content: fmt.Sprintf("Error: %s", msg.err)})
+		m.noteSaveErr()
 		m.updateChatViewport()
 		return m, nil
 
@@ -113,7 +155,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case selectTaskMsg:
 		m.selectedIdx = int(msg)
 		if m.rightMode == modeLog && len(m.tasks) > 0 && m.selectedIdx < len(m.tasks) {
-			return m, fetchLogs(m.mgr, m.tasks[m.selectedIdx].ID)
+			return m, fetchLogs(m.mgr, m.tasks[m.selectedIdx].ID, m.logView())
 		}
 		return m, nil
 
@@ -147,11 +189,46 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.agentCancel()
 		m.agentBusy = false
 		m.agentCancel = nil
+		m.approval = nil
+		m.endStream()
 		m.chatHistory = append(m.chatHistory, chatMessage{role: "agent", content: "[cancelled]"})
 		m.updateChatViewport()
 		return m, nil
 	}
 
+	// A pending tool call takes y/n/a before anything else
+	if m.approval != nil {
+		var decision agent.Decision
+		var answer string
+		switch key {
+		case "y":
+			decision, answer = agent.Approve, "allowed"
+		case "n":
+			decision, answer = agent.Deny, "denied"
+		case "a":
+			decision, answer = agent.ApproveAlways, "allowed from now on"
+		case "ctrl+c":
+			return m, tea.Quit
+		default:
+			return m, nil
+		}
+		m.approval.reply <- decision
+		m.chatHistory = append(m.chatHistory, chatMessage{
+			role:    "tool",
+			content: fmt.Sprintf("%s %s", m.approval.req.Tool, answer),
+		})
+		m.approval = nil
+		m.updateChatViewport()
+		return m, nil
+	}
+
+	// Expand or collapse the model's thinking, even while typing
+	if key == "ctrl+t" && m.rightMode == modeChat {
+		m.showThinking = !m.showThinking
+		m.updateChatViewport()
+		return m, nil
+	}
+
 	// Search mode input handling
 	if m.searchMode {
 		switch key {
@@ -261,10 +338,19 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 					return m, nil
 				}
 
+				if text == "/sessions" || strings.HasPrefix(text, "/sessions ") {
+					m.handleSessionsCommand(text)
+					m.updateChatViewport()
+					return m, nil
+				}
+
+				if len(m.tasks) > 0 && m.selectedIdx < len(m.tasks) {
+					m.conversation.SetTask(m.tasks[m.selectedIdx].ID)
+				}
 				m.chatHistory = append(m.chatHistory, chatMessage{role: "user", content: text})
 				m.updateChatViewport()
 				m.agentBusy = true
-				ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+				ctx, cancel := context.WithCancel(context.Background())
 				m.agentCancel = cancel
 				return m, sendToAgent(m.conversation, text, ctx, m.programRef.p)
 			}
@@ -284,7 +370,7 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.selectedIdx = len(m.tasks) - 1
 			}
 			if m.rightMode == modeLog {
-				return m, fetchLogs(m.mgr, m.tasks[m.selectedIdx].ID)
+				return m, fetchLogs(m.mgr, m.tasks[m.selectedIdx].ID, m.logView())
 			}
 		} else if m.activePane == paneRight {
 			if m.rightMode == modeLog {
@@ -300,7 +386,7 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.selectedIdx = 0
 			}
 			if m.rightMode == modeLog {
-				return m, fetchLogs(m.mgr, m.tasks[m.selectedIdx].ID)
+				return m, fetchLogs(m.mgr, m.tasks[m.selectedIdx].ID, m.logView())
 			}
 		} else if m.activePane == paneRight {
 			if m.rightMode == modeLog {
@@ -336,13 +422,13 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.chatInput.Blur()
 		// Find latest running task
 		for i := len(m.tasks) - 1; i >= 0; i-- {
-			if m.tasks[i].Status == "running" {
+			if m.tasks[i].Alive() {
 				m.selectedIdx = i
 				break
 			}
 		}
 		if len(m.tasks) > 0 && m.selectedIdx < len(m.tasks) {
-			return m, fetchLogs(m.mgr, m.tasks[m.selectedIdx].ID)
+			return m, fetchLogs(m.mgr, m.tasks[m.selectedIdx].ID, m.logView())
 		}
 	case "c":
 		m.rightMode = modeChat
@@ -353,24 +439,52 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			// Open logs for selected task
 			m.rightMode = modeLog
 			m.activePane = paneRight
-			return m, fetchLogs(m.mgr, m.tasks[m.selectedIdx].ID)
+			return m, fetchLogs(m.mgr, m.tasks[m.selectedIdx].ID, m.logView())
 		} else if m.activePane == paneRight && m.rightMode == modeChat {
 			m.chatInput.Focus()
 		}
 	case "x":
 		if len(m.tasks) > 0 && m.selectedIdx < len(m.tasks) {
 			t := m.tasks[m.selectedIdx]
-			if t.Status == "running" {
+			// x on a task that is already stopping escalates to SIGKILL
+			if t.Alive() || t.Status == "restarting" {
 				return m, stopTask(m.mgr, t.ID)
 			}
 		}
 	case "r":
 		if m.activePane == paneLeft && len(m.tasks) > 0 && m.selectedIdx < len(m.tasks) {
 			t := m.tasks[m.selectedIdx]
-			if t.Status == "stopped" || t.Status == "crashed" {
+			if t.Status == "stopped" || t.Status == "crashed" || t.Status == "timed_out" {
 				return m, restartTaskCmd(m.mgr, t.ID)
 			}
 		}
+	case "s":
+		if m.rightMode == modeLog {
+			switch m.logStream {
+			case "":
+				m.logStream = task.StreamStdout
+			case task.StreamStdout:
+				m.logStream = task.StreamStderr
+			default:
+				m.logStream = ""
+			}
+			return m, m.refetchLogs()
+		}
+	case "w":
+		if m.rightMode == modeLog {
+			for i, w := range logWindows {
+				if w == m.logWindow {
+					m.logWindow = logWindows[(i+1)%len(logWindows)]
+					break
+				}
+			}
+			return m, m.refetchLogs()
+		}
+	case "T":
+		if m.rightMode == modeLog {
+			m.logTimestamps = !m.logTimestamps
+			return m, m.refetchLogs()
+		}
 	case "/":
 		if m.activePane == paneRight && m.rightMode == modeLog {
 			m.searchMode = true
@@ -404,6 +518,19 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// logView returns the current log pane filter settings
+func (m Model) logView() logView {
+	return logView{stream: m.logStream, window: m.logWindow, timestamps: m.logTimestamps}
+}
+
+// refetchLogs reloads the selected task's logs after a filter change
+func (m Model) refetchLogs() tea.Cmd {
+	if len(m.tasks) == 0 || m.selectedIdx >= len(m.tasks) {
+		return nil
+	}
+	return fetchLogs(m.mgr, m.tasks[m.selectedIdx].ID, m.logView())
+}
+
 // showSlashPicker returns true when the input starts with "/" and hasn't been completed yet
 func (m Model) showSlashPicker() bool {
 	val := m.chatInput.Value()
@@ -443,50 +570,218 @@ func (m *Model) recalcLayout() {
 }
 
 func (m *Model) handleSaveCommand(text string) {
-	parts := strings.Fields(text)
+	// --param name=value turns value into {{name}} in the saved command
+	var parts []string
+	var params []tick.Param
+	fields := strings.Fields(text)
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "--param" && i+1 < len(fields) {
+			p, err := tick.ParseParam(fields[i+1])
+			if err != nil {
+				m.chatHistory = append(m.chatHistory, chatMessage{
+					role: "agent", content: fmt.Sprintf("error: %s", err),
+				})
+				return
+			}
+			params = append(params, p)
+			i++
+		} else {
+			parts = append(parts, fields[i])
+		}
+	}
 
 	if len(parts) < 2 {
 		m.chatHistory = append(m.chatHistory, chatMessage{
-			role: "agent", content: "usage: /save <name> [command]\n  /save <name> <command>  save a specific command\n  /save <name>            save the last command the agent started",
+			role: "agent", content: "usage: /save <name> [command] [--param name=value]...\n  /save <name> <command>  save a specific command\n  /save <name>            save the last command the agent started\n  --param pkg=api         replace api in the command with a {{pkg}} parameter",
 		})
 		return
 	}
 
 	name := parts[1]
 
+	var command string
 	if len(parts) >= 3 {
 		// /save <name> <command...>
-		command := strings.Join(parts[2:], " ")
-		if err := m.tickStore.Save(name, command, ""); err != nil {
+		command = strings.Join(parts[2:], " ")
+	} else {
+		// /save <name> - find the last start_task from chat history
+		command = m.findLastStartTaskCommand()
+		if command == "" {
 			m.chatHistory = append(m.chatHistory, chatMessage{
-				role: "agent", content: fmt.Sprintf("error: %s", err),
+				role: "agent", content: "no start_task found in chat history",
 			})
 			return
 		}
+	}
+
+	command, err := tick.Generalize(command, params)
+	if err == nil {
+		err = m.tickStore.SaveTick(name, tick.Tick{Command: command, Params: params})
+	}
+	if err != nil {
 		m.chatHistory = append(m.chatHistory, chatMessage{
-			role: "agent", content: fmt.Sprintf("saved tick %q: %s", name, command),
+			role: "agent", content: fmt.Sprintf("error: %s", err),
 		})
 		return
 	}
+	m.chatHistory = append(m.chatHistory, chatMessage{
+		role: "agent", content: fmt.Sprintf("saved tick %q: %s", name, command),
+	})
+}
 
-	// /save <name> - find the last start_task from chat history
-	command := m.findLastStartTaskCommand()
-	if command == "" {
+// handleSessionsCommand lists saved chats, or resumes one with /sessions <id>
+func (m *Model) handleSessionsCommand(text string) {
+	fields := strings.Fields(text)
+	if len(fields) > 2 {
 		m.chatHistory = append(m.chatHistory, chatMessage{
-			role: "agent", content: "no start_task found in chat history",
+			role: "agent", content: "usage: /sessions [id]",
 		})
 		return
 	}
+	if len(fields) == 2 {
+		id, err := strconv.Atoi(fields[1])
+		if err != nil {
+			err = fmt.Errorf("invalid chat ID: %s", fields[1])
+		} else {
+			err = m.resumeSession(id)
+		}
+		if err != nil {
+			m.chatHistory = append(m.chatHistory, chatMessage{
+				role: "agent", content: fmt.Sprintf("error: %s", err),
+			})
+		}
+		return
+	}
 
-	if err := m.tickStore.Save(name, command, ""); err != nil {
+	sessions, err := m.mgr.ListChatSessions()
+	if err != nil {
 		m.chatHistory = append(m.chatHistory, chatMessage{
 			role: "agent", content: fmt.Sprintf("error: %s", err),
 		})
 		return
 	}
+	if len(sessions) == 0 {
+		m.chatHistory = append(m.chatHistory, chatMessage{
+			role: "agent", content: "no saved chats yet",
+		})
+		return
+	}
+
+	const maxListed = 20
+	var b strings.Builder
+	b.WriteString("saved chats, newest first (/sessions <id> to resume):")
+	for i, s := range sessions {
+		if i == maxListed {
+			fmt.Fprintf(&b, "\n  ...and %d more (watchy chat list)", len(sessions)-maxListed)
+			break
+		}
+		marker := " "
+		if s.ID == m.conversation.Session() {
+			marker = "*"
+		}
+		fmt.Fprintf(&b, "\n%s %3d  %s  %-16s %s (%d messages)",
+			marker, s.ID, s.UpdatedAt.Format("Jan 02 15:04"), m.taskLabel(s.TaskID), s.Title, s.MessageCount)
+	}
+	m.chatHistory = append(m.chatHistory, chatMessage{role: "agent", content: b.String()})
+}
+
+// resumeSession replaces the conversation with a saved session, and selects
+// the task it was focused on
+func (m *Model) resumeSession(id int) error {
+	cs, err := m.mgr.GetChatSession(id)
+	if err != nil {
+		return err
+	}
+	conv, err := m.agent.ResumeConversation(cs)
+	if err != nil {
+		return err
+	}
+	m.conversation = conv
+	m.chatHistory = chatHistoryFrom(cs)
 	m.chatHistory = append(m.chatHistory, chatMessage{
-		role: "agent", content: fmt.Sprintf("saved tick %q: %s", name, command),
+		role: "agent", content: fmt.Sprintf("resumed chat %d: %s", cs.ID, cs.Title),
 	})
+	if cs.TaskID != 0 {
+		if len(m.tasks) > 0 {
+			m.selectTask(cs.TaskID)
+		} else {
+			m.focusTask = cs.TaskID
+		}
+	}
+	m.updateChatViewport()
+	return nil
+}
+
+// selectTask moves the selection to a task, if it is in the list
+func (m *Model) selectTask(id int) {
+	for i, t := range m.tasks {
+		if t.ID == id {
+			m.selectedIdx = i
+			return
+		}
+	}
+}
+
+// taskLabel names a task for the session list
+func (m *Model) taskLabel(id int) string {
+	if id == 0 {
+		return "-"
+	}
+	for _, t := range m.tasks {
+		if t.ID == id {
+			return fmt.Sprintf("[%d] %s", t.ID, t.Name)
+		}
+	}
+	return fmt.Sprintf("[%d]", id)
+}
+
+// noteSaveErr tells the user when the conversation couldn't be saved
+func (m *Model) noteSaveErr() {
+	if err := m.conversation.SaveErr(); err != nil {
+		m.chatHistory = append(m.chatHistory, chatMessage{
+			role: "tool", content: fmt.Sprintf("chat not saved: %s", err),
+		})
+	}
+}
+
+// chatHistoryFrom renders a saved session the way the chat pane shows a live
+// one
+func chatHistoryFrom(cs *task.ChatSession) []chatMessage {
+	var history []chatMessage
+	for _, msg := range cs.Messages {
+		switch msg.Role {
+		case "user":
+			history = append(history, chatMessage{role: "user", content: msg.Content})
+		case "assistant":
+			if msg.Content != "" || msg.Thinking != "" {
+				history = append(history, chatMessage{role: "agent", content: msg.Content, thinking: msg.Thinking})
+			}
+			var calls []struct {
+				Function struct {
+					Name      string          `json:"name"`
+					Arguments json.RawMessage `json:"arguments"`
+				} `json:"function"`
+			}
+			json.Unmarshal(msg.ToolCalls, &calls)
+			for _, call := range calls {
+				history = append(history, chatMessage{
+					role:    "tool",
+					content: fmt.Sprintf("[%s] %s", call.Function.Name, call.Function.Arguments),
+				})
+			}
+		case "tool":
+			history = append(history, chatMessage{role: "tool", content: toolResultLine(msg.Content)})
+		}
+	}
+	return history
+}
+
+// toolResultLine shows a tool result in the chat pane, shortened
+func toolResultLine(result string) string {
+	if len(result) > 300 {
+		result = result[:300] + "..."
+	}
+	return fmt.Sprintf("-> %s", result)
 }
 
 // findLastStartTaskCommand scans chat history backwards for the last start_task tool call
@@ -553,15 +848,53 @@ func (m *Model) updateChatViewport() {
 		case "tool":
 			content += "  " + msg.content
 		default:
+			if msg.thinking != "" {
+				content += m.renderThinking(msg)
+				if msg.content != "" {
+					content += "\n"
+				}
+			}
 			content += msg.content
 		}
 	}
 	if m.agentBusy {
-		if content != "" {
-			content += "\n\n"
+		n := len(m.chatHistory)
+		streaming := n > 0 && m.chatHistory[n-1].streaming
+		if m.approval != nil {
+			content += "\n\n" + fmt.Sprintf("allow %s %s?  y:yes  n:no  a:always", m.approval.req.Tool, m.approval.req.Args)
+		} else if !streaming {
+			if content != "" {
+				content += "\n\n"
+			}
+			content += "thinking..."
 		}
-		content += "thinking..."
 	}
 	m.chatViewport.SetContent(content)
 	m.chatViewport.GotoBottom()
 }
+
+// renderThinking renders a reply's thinking as a dim block, collapsed to
+// one line unless showThinking is on
+func (m *Model) renderThinking(msg chatMessage) string {
+	dim := lipgloss.NewStyle().Foreground(dimGray)
+	if !m.showThinking {
+		label := "thought"
+		if msg.streaming && msg.content == "" {
+			label = "thinking..."
+		}
+		lines := strings.Count(strings.TrimSpace(msg.thinking), "\n") + 1
+		unit := "lines"
+		if lines == 1 {
+			unit = "line"
+		}
+		return dim.Render(fmt.Sprintf("▸ %s (%d %s, ctrl+t to expand)", label, lines, unit))
+	}
+	return dim.Render("▾ thinking (ctrl+t to collapse)\n" + strings.TrimSpace(msg.thinking))
+}
+
+// endStream marks the agent reply being streamed, if any, as complete
+func (m *Model) endStream() {
+	if n := len(m.chatHistory); n > 0 {
+		m.chatHistory[n-1].streaming = false
+	}
+}
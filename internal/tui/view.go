@@ -2,9 +2,14 @@ package tui
 
 import (
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/parth/watchy/internal/logcolor"
+	"github.com/parth/watchy/internal/sparkline"
+	"github.com/parth/watchy/internal/task"
 )
 
 type theme struct {
@@ -26,6 +31,7 @@ var themes = []theme{
 
 var (
 	errorColor = lipgloss.Color("124")
+	warnColor  = lipgloss.Color("214")
 	dimGray    = lipgloss.Color("240")
 )
 
@@ -61,6 +67,9 @@ func (m Model) View() string {
 		if len(m.tasks) > 0 && m.selectedIdx < len(m.tasks) {
 			rightTitle = fmt.Sprintf("Logs [%d: %s]", m.tasks[m.selectedIdx].ID, m.tasks[m.selectedIdx].Name)
 		}
+		if f := m.logFilterLabel(); f != "" {
+			rightTitle += " " + f
+		}
 		if m.searchTerm != "" && !m.searchMode {
 			rightTitle += fmt.Sprintf(" [%q %d/%d]", m.searchTerm, m.matchIndex+1, len(m.searchMatches))
 		}
@@ -88,6 +97,39 @@ func (m Model) View() string {
 	return main + "\n" + statusBar
 }
 
+// logFilterLabel describes the active log filter for the pane title
+func (m Model) logFilterLabel() string {
+	var parts []string
+	if m.logStream != "" {
+		parts = append(parts, m.logStream)
+	}
+	if m.logWindow > 0 {
+		parts = append(parts, "last "+strings.TrimSuffix(strings.TrimSuffix(m.logWindow.String(), "0s"), "0m"))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// renderLogLine formats a stream log line for the log pane. When all streams
+// are shown, stderr lines get a red marker and watchy notices are dimmed.
+func renderLogLine(l task.LogLine, v logView) string {
+	dimStyle := lipgloss.NewStyle().Foreground(dimGray)
+
+	text := logcolor.Colorize(l.Text)
+	if l.Stream == task.StreamWatchy {
+		text = dimStyle.Render(l.Text)
+	}
+	if v.stream == "" && l.Stream == task.StreamStderr {
+		text = lipgloss.NewStyle().Foreground(errorColor).Render("▌") + text
+	}
+	if v.timestamps && !l.Time.IsZero() {
+		text = dimStyle.Render(l.Time.Format("15:04:05.000")) + " " + text
+	}
+	return text
+}
+
 func (m Model) applyBorder(p pane, width, height int, title, content string) string {
 	t := m.theme()
 	borderColor := dimGray
@@ -108,24 +150,50 @@ func (m Model) renderTaskList(width, height int) string {
 	t := m.theme()
 	dimStyle := lipgloss.NewStyle().Foreground(dimGray)
 
+	var lines []string
 	if len(m.tasks) == 0 {
-		return dimStyle.Render("No tasks. Use chat to start one.")
+		lines = append(lines, dimStyle.Render("No tasks. Use chat to start one."))
 	}
-
-	var lines []string
 	for i, task := range m.tasks {
+		if task.Options.Stack != "" && (i == 0 || m.tasks[i-1].Options.Stack != task.Options.Stack) {
+			lines = append(lines, dimStyle.Render("── "+task.Options.Stack))
+		}
+
 		var indicator string
 		switch task.Status {
-		case "running":
+		case "running", "ready":
 			indicator = lipgloss.NewStyle().Foreground(t.bright).Render("[R]")
+		case "starting":
+			indicator = lipgloss.NewStyle().Foreground(warnColor).Render("[…]")
+		case "unhealthy":
+			indicator = lipgloss.NewStyle().Foreground(errorColor).Render("[!]")
+		case "stopping":
+			indicator = lipgloss.NewStyle().Foreground(warnColor).Render("[S]")
+		case "restarting":
+			indicator = lipgloss.NewStyle().Foreground(warnColor).Render("[~]")
 		case "crashed":
 			indicator = lipgloss.NewStyle().Foreground(errorColor).Render("[X]")
+		case "timed_out":
+			indicator = lipgloss.NewStyle().Foreground(warnColor).Render("[T]")
 		default:
 			indicator = dimStyle.Render("[-]")
 		}
 
+		exit := task.ExitSummary()
+		if exit != "" {
+			exit = " " + exit
+		}
+		if task.RestartCount > 0 {
+			exit += fmt.Sprintf(" ↻%d", task.RestartCount)
+		}
+		if deadline, ok := task.Deadline(); ok && (task.Running() || task.Status == "restarting") {
+			exit += " " + formatRemaining(time.Until(deadline)) + " left"
+		}
+
+		usage := m.renderUsage(task.ID)
+
 		name := task.Name
-		maxName := width - 10
+		maxName := width - 10 - lipgloss.Width(exit) - lipgloss.Width(usage)
 		if maxName < 10 {
 			maxName = 10
 		}
@@ -133,7 +201,7 @@ func (m Model) renderTaskList(width, height int) string {
 			name = name[:maxName-3] + "..."
 		}
 
-		line := fmt.Sprintf(" %s %-3d %s", indicator, task.ID, name)
+		line := fmt.Sprintf(" %s %-3d %s%s%s", indicator, task.ID, name, dimStyle.Render(exit), dimStyle.Render(usage))
 
 		if i == m.selectedIdx {
 			selectedStyle := lipgloss.NewStyle().Background(t.dim).Bold(true).Foreground(t.bright)
@@ -143,9 +211,61 @@ func (m Model) renderTaskList(width, height int) string {
 		lines = append(lines, line)
 	}
 
+	if len(m.schedules) > 0 {
+		lines = append(lines, dimStyle.Render("── scheduled"))
+	}
+	for _, e := range m.schedules {
+		next := "never"
+		if e.Queued {
+			next = "queued"
+		} else if !e.Next.IsZero() {
+			next = "in " + formatRemaining(time.Until(e.Next))
+		}
+		line := fmt.Sprintf("  %s %s", e.Name, next)
+		if e.Last != "" {
+			line += " · last " + e.Last
+		}
+		if r := []rune(line); len(r) > width {
+			line = string(r[:max(width-3, 0)]) + "..."
+		}
+		lines = append(lines, dimStyle.Render(line))
+	}
+
 	return strings.Join(lines, "\n")
 }
 
+// formatRemaining formats the time left before a task's deadline, e.g.
+// "1h05m", "14m30s" or "42s"
+func formatRemaining(d time.Duration) string {
+	d = max(d, 0).Round(time.Second)
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
+
+// sparkWidth is how many samples the task list sparklines show
+const sparkWidth = 8
+
+// renderUsage shows a running task's recent CPU as a sparkline followed by
+// its current memory, or "" if there are no samples yet
+func (m Model) renderUsage(id int) string {
+	samples := m.metrics[id]
+	if len(samples) == 0 {
+		return ""
+	}
+	cpu := make([]float64, len(samples))
+	for i, s := range samples {
+		cpu[i] = s.CPU
+	}
+	last := samples[len(samples)-1]
+	// Scale to at least one full core so an idle task doesn't look busy
+	return fmt.Sprintf(" %s %s", sparkline.Render(cpu, max(100, slices.Max(cpu)), sparkWidth), task.FormatBytes(last.RSS))
+}
+
 func (m Model) renderSlashPicker() string {
 	if !m.showSlashPicker() {
 		return ""
@@ -186,11 +306,13 @@ func (m Model) renderStatusBar() string {
 
 	var parts []string
 
-	if m.agentBusy {
+	if m.approval != nil {
+		parts = append(parts, lipgloss.NewStyle().Foreground(t.bright).Render("[allow tool call? y:yes n:no a:always esc:cancel]"))
+	} else if m.agentBusy {
 		parts = append(parts, lipgloss.NewStyle().Foreground(t.bright).Render("[agent working... esc:cancel]"))
 	}
 
-	keys := fmt.Sprintf("j/k:nav  g/G:top/bottom  /:search  n/N:match  tab:pane  l:logs  c:chat  h:hide  t:theme(%s)  x:stop  r:restart  q:quit", t.name)
+	keys := fmt.Sprintf("j/k:nav  g/G:top/bottom  /:search  n/N:match  tab:pane  s:stream  w:window  T:time  l:logs  c:chat  h:hide  t:theme(%s)  x:stop  r:restart  q:quit", t.name)
 	parts = append(parts, dimStyle.Render(keys))
 
 	return strings.Join(parts, "  ")